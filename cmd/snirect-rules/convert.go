@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/xihale/snirect-shared/rules"
+	"github.com/xihale/snirect-shared/rules/cealing"
+)
+
+type convertResult struct {
+	Input  string `json:"input"`
+	From   string `json:"from"`
+	Output string `json:"output"`
+	To     string `json:"to"`
+	// Warnings lists the rules the output format could not hold.
+	Warnings []string `json:"warnings"`
+}
+
+// convert rewrites a rule file in another format.
+func (c *cli) convert(args []string) error {
+	fs := c.newFlagSet("convert")
+	from := fs.String("from", "", "input format (default: detected)")
+	to := fs.String("to", "", "output format")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("%w: convert takes an input and an output file", errUsage)
+	}
+	if err := checkFormat(*to); err != nil {
+		return err
+	}
+
+	r, format, err := readRules(fs.Arg(0), *from)
+	if err != nil {
+		return err
+	}
+	res := convertResult{Input: fs.Arg(0), From: format, Output: fs.Arg(1), To: *to, Warnings: []string{}}
+	warnDropped := func(section rules.Section) {
+		if n := len(r.Keys(section)); n > 0 {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("%d %s rules are not supported by the %s format", n, section, *to))
+		}
+	}
+
+	var buf bytes.Buffer
+	switch *to {
+	case formatTOML:
+		if format == formatCealing {
+			// Keep the layout of fetched.toml, with keys as written upstream.
+			err = cealing.WriteTOML(&buf, r)
+		} else {
+			var data []byte
+			data, err = r.ToTOML()
+			buf.Write(data)
+		}
+	case formatJSON:
+		warnDropped(rules.SectionHosts)
+		var data []byte
+		data, err = r.ToJSON()
+		buf.Write(data)
+	case formatCealing:
+		warnDropped(rules.SectionCertVerify)
+		err = cealing.WriteList(&buf, r)
+	case formatHosts:
+		warnDropped(rules.SectionAlterHostname)
+		warnDropped(rules.SectionCertVerify)
+		var skipped []string
+		_, skipped, err = r.ToHostsFile(&buf)
+		for _, k := range skipped {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("hosts rule %q is not expressible in the hosts format", k))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(fs.Arg(1), buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+
+	return c.output(res, func(w io.Writer) {
+		for _, warning := range res.Warnings {
+			fmt.Fprintf(c.stderr, "warning: %s\n", warning)
+		}
+		fmt.Fprintf(w, "converted %s (%s) to %s (%s)\n", res.Input, res.From, res.Output, res.To)
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/xihale/snirect-shared/rules"
+)
+
+type diffResult struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+	*rules.DiffReport
+}
+
+// diff compares two rule files with rules.Diff and estimates the affected hosts.
+func (c *cli) diff(args []string) error {
+	fs := c.newFlagSet("diff")
+	from := fs.String("from", "", "format of both files (default: detected)")
+	hostsFile := fs.String("hosts", "", "file of sample hosts, one per line (default: examples of every rule)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("%w: diff takes two files", errUsage)
+	}
+	a, err := loadRules(fs.Arg(0), *from)
+	if err != nil {
+		return err
+	}
+	b, err := loadRules(fs.Arg(1), *from)
+	if err != nil {
+		return err
+	}
+
+	sample := rules.SampleHosts(a, b)
+	if *hostsFile != "" {
+		if sample, err = readHostList(*hostsFile); err != nil {
+			return err
+		}
+	}
+	d := rules.Diff(a, b)
+	d.Estimate(sample)
+
+	err = c.output(diffResult{Old: fs.Arg(0), New: fs.Arg(1), DiffReport: d}, func(w io.Writer) {
+		fmt.Fprint(w, d.String())
+	})
+	if err == nil && !d.Empty() {
+		err = errFailed
+	}
+	return err
+}
+
+// readHostList reads one host per line, skipping blank lines and # comments.
+func readHostList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var hosts []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			hosts = append(hosts, line)
+		}
+	}
+	return hosts, sc.Err()
+}
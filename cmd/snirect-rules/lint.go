@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/xihale/snirect-shared/rules"
+)
+
+type lintResult struct {
+	Layers   []string        `json:"layers"`
+	Findings []rules.Finding `json:"findings"`
+	Errors   int             `json:"errors"`
+	OK       bool            `json:"ok"`
+}
+
+// lint loads the files as layers and reports rules.Analyze findings on the
+// merged rules. Invalid keys are errors; with -strict every finding is.
+func (c *cli) lint(args []string) error {
+	fs := c.newFlagSet("lint")
+	strict := fs.Bool("strict", false, "fail on any finding, not just invalid keys")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	layers, err := loadLayers(fs.Args())
+	if err != nil {
+		return err
+	}
+	rep := rules.Analyze(mergeLayers(layers), layers...)
+
+	res := lintResult{Findings: rep.Findings}
+	if res.Findings == nil {
+		res.Findings = []rules.Finding{}
+	}
+	for _, l := range layers {
+		res.Layers = append(res.Layers, l.Name)
+	}
+	for _, f := range rep.Findings {
+		if *strict || f.Kind == rules.FindingInvalid {
+			res.Errors++
+		}
+	}
+	res.OK = res.Errors == 0
+
+	err = c.output(res, func(w io.Writer) {
+		fmt.Fprint(w, rep.String())
+		if res.OK {
+			fmt.Fprintf(w, "ok: %d findings, no errors\n", len(rep.Findings))
+		} else {
+			fmt.Fprintf(w, "%d errors, %d findings\n", res.Errors, len(rep.Findings))
+		}
+	})
+	if err == nil && !res.OK {
+		err = errFailed
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xihale/snirect-shared/rules"
+	"github.com/xihale/snirect-shared/rules/cealing"
+)
+
+// Rule file formats.
+const (
+	formatTOML    = "toml"
+	formatJSON    = "json"
+	formatCealing = "cealing"
+	formatHosts   = "hosts"
+)
+
+var formats = []string{formatTOML, formatJSON, formatCealing, formatHosts}
+
+func checkFormat(f string) error {
+	for _, known := range formats {
+		if f == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: unknown format %q (want one of %s)", errUsage, f, strings.Join(formats, ", "))
+}
+
+// detectFormat guesses the format of a file from its extension and, for JSON,
+// whether it holds a Cealing-Host array or a rules object.
+func detectFormat(path string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return formatTOML
+	case ".json":
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+			return formatCealing
+		}
+		return formatJSON
+	}
+	return formatHosts
+}
+
+// readRules reads a rule file in the given format, or a detected one if format
+// is empty. Cealing-Host lists are returned uninitialized so their keys stay as
+// written upstream; use loadRules for rules ready for lookups.
+func readRules(path, format string) (*rules.Rules, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if format == "" {
+		format = detectFormat(path, data)
+	}
+
+	r := rules.NewRules()
+	switch format {
+	case formatTOML:
+		err = r.FromTOML(data)
+	case formatJSON:
+		err = r.FromJSON(data)
+	case formatCealing:
+		var res *cealing.Result
+		if res, err = cealing.Parse(bytes.NewReader(data)); err == nil {
+			r = res.Rules
+		}
+	case formatHosts:
+		err = r.FromHostsFile(bytes.NewReader(data))
+	default:
+		return nil, "", checkFormat(format)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", path, err)
+	}
+	return r, format, nil
+}
+
+// loadRules reads a rule file and initializes it for lookups.
+func loadRules(path, format string) (*rules.Rules, error) {
+	r, _, err := readRules(path, format)
+	if err != nil {
+		return nil, err
+	}
+	r.Init()
+	return r, nil
+}
+
+// loadLayers reads rule files as layers in merge order, or returns the
+// embedded layers if no files are given.
+func loadLayers(files []string) ([]rules.Layer, error) {
+	if len(files) == 0 {
+		return rules.LoadLayers()
+	}
+	layers := make([]rules.Layer, len(files))
+	for i, f := range files {
+		r, err := loadRules(f, "")
+		if err != nil {
+			return nil, err
+		}
+		layers[i] = rules.Layer{Name: f, Rules: r}
+	}
+	return layers, nil
+}
+
+// mergeLayers merges layers in order; later layers override earlier ones.
+func mergeLayers(layers []rules.Layer) *rules.Rules {
+	r := rules.NewRules()
+	for _, l := range layers {
+		r.Merge(l.Rules)
+	}
+	return r
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xihale/snirect-shared/rules"
+)
+
+// certPolicy is the JSON form of rules.CertPolicy.
+type certPolicy struct {
+	Verify bool     `json:"verify"`
+	Allow  []string `json:"allow,omitempty"`
+}
+
+type testEntry struct {
+	Section rules.Section `json:"section"`
+	Matched bool          `json:"matched"`
+	Key     string        `json:"key,omitempty"`
+	// Value is the target SNI or address, or a certPolicy for cert_verify.
+	Value any `json:"value,omitempty"`
+}
+
+type testResult struct {
+	Host    string      `json:"host"`
+	Port    int         `json:"port,omitempty"`
+	App     string      `json:"app,omitempty"`
+	Results []testEntry `json:"results"`
+}
+
+// lookupArgs parses the flags shared by test and explain.
+func (c *cli) lookupArgs(name string, args []string) (ctx rules.LookupContext, layers []rules.Layer, err error) {
+	fs := c.newFlagSet(name)
+	fs.IntVar(&ctx.Port, "port", 0, "destination port; 0 ignores port-restricted rules")
+	fs.StringVar(&ctx.App, "app", "", "application package name or executable path; empty ignores app-scoped rules")
+	var files fileList
+	fs.Var(&files, "rules", "rule file to layer on the previous ones (repeatable; default: embedded rules)")
+	if err := parseFlags(fs, args); err != nil {
+		return ctx, nil, err
+	}
+	if fs.NArg() != 1 {
+		return ctx, nil, fmt.Errorf("%w: %s takes exactly one host", errUsage, name)
+	}
+	if ctx.Port < 0 || ctx.Port > 65535 {
+		return ctx, nil, fmt.Errorf("%w: invalid port %d", errUsage, ctx.Port)
+	}
+	ctx.Host = fs.Arg(0)
+	layers, err = loadLayers(files)
+	return ctx, layers, err
+}
+
+// test prints what the rule lookups return for a host.
+func (c *cli) test(args []string) error {
+	ctx, layers, err := c.lookupArgs("test", args)
+	if err != nil {
+		return err
+	}
+	r := mergeLayers(layers)
+
+	res := testResult{Host: ctx.Host, Port: ctx.Port, App: ctx.App}
+	add := func(section rules.Section, value any, ok bool) {
+		e := testEntry{Section: section, Matched: ok}
+		if ok {
+			e.Key, _ = r.LookupKeyContext(section, ctx)
+			e.Value = value
+		}
+		res.Results = append(res.Results, e)
+	}
+	alt, ok := r.LookupAlterHostnameContext(ctx)
+	add(rules.SectionAlterHostname, alt, ok)
+	ip, ok := r.LookupHostContext(ctx)
+	add(rules.SectionHosts, ip, ok)
+	policy, ok := r.LookupCertVerifyContext(ctx)
+	add(rules.SectionCertVerify, certPolicy(policy), ok)
+
+	return c.output(res, func(w io.Writer) {
+		for _, e := range res.Results {
+			if !e.Matched {
+				fmt.Fprintf(w, "%-15s no match\n", e.Section)
+				continue
+			}
+			fmt.Fprintf(w, "%-15s %s (rule %q)\n", e.Section, formatValue(e.Value), e.Key)
+		}
+	})
+}
+
+type explainLayer struct {
+	Layer string `json:"layer"`
+	// Key is the key this layer alone would use for the host.
+	Key   string `json:"key,omitempty"`
+	Value any    `json:"value,omitempty"`
+	// Defines reports whether the layer sets the winning key.
+	Defines bool `json:"defines"`
+}
+
+type explainEntry struct {
+	Section rules.Section `json:"section"`
+	Matched bool          `json:"matched"`
+	Key     string        `json:"key,omitempty"`
+	Value   any           `json:"value,omitempty"`
+	// Layer is the last layer setting Key, whose value is used.
+	Layer  string         `json:"layer,omitempty"`
+	Layers []explainLayer `json:"layers"`
+}
+
+type explainResult struct {
+	Host     string         `json:"host"`
+	Port     int            `json:"port,omitempty"`
+	App      string         `json:"app,omitempty"`
+	Sections []explainEntry `json:"sections"`
+}
+
+// explain shows, per section, the winning key and value and how each layer
+// contributes to it.
+func (c *cli) explain(args []string) error {
+	ctx, layers, err := c.lookupArgs("explain", args)
+	if err != nil {
+		return err
+	}
+	r := mergeLayers(layers)
+
+	res := explainResult{Host: ctx.Host, Port: ctx.Port, App: ctx.App}
+	for _, section := range rules.Sections {
+		e := explainEntry{Section: section, Layers: []explainLayer{}}
+		e.Key, e.Matched = r.LookupKeyContext(section, ctx)
+		if e.Matched {
+			e.Value, _ = ruleValue(r, section, e.Key)
+		}
+		for _, l := range layers {
+			el := explainLayer{Layer: l.Name}
+			if _, ok := ruleValue(l.Rules, section, e.Key); ok && e.Matched {
+				el.Defines = true
+				e.Layer = l.Name
+			}
+			if k, ok := l.Rules.LookupKeyContext(section, ctx); ok {
+				el.Key = k
+				el.Value, _ = ruleValue(l.Rules, section, k)
+			}
+			e.Layers = append(e.Layers, el)
+		}
+		res.Sections = append(res.Sections, e)
+	}
+
+	return c.output(res, func(w io.Writer) {
+		for _, e := range res.Sections {
+			if !e.Matched {
+				fmt.Fprintf(w, "%s: no match\n", e.Section)
+				continue
+			}
+			fmt.Fprintf(w, "%s: %q = %s (from %s)\n", e.Section, e.Key, formatValue(e.Value), e.Layer)
+			for _, l := range e.Layers {
+				var note string
+				switch {
+				case l.Key == "":
+					note = "no match"
+				case l.Defines && l.Layer == e.Layer:
+					note = fmt.Sprintf("%q = %s, used", e.Key, formatValue(l.Value))
+				case l.Defines:
+					note = fmt.Sprintf("%q = %s, overridden by a later layer", e.Key, formatValue(l.Value))
+				default:
+					note = fmt.Sprintf("%q = %s, loses to %q", l.Key, formatValue(l.Value), e.Key)
+				}
+				fmt.Fprintf(w, "  %-10s %s\n", l.Layer, note)
+			}
+		}
+	})
+}
+
+// ruleValue returns the value of a key in a section.
+func ruleValue(r *rules.Rules, section rules.Section, key string) (any, bool) {
+	var v any
+	var ok bool
+	switch section {
+	case rules.SectionAlterHostname:
+		v, ok = r.AlterHostname[key]
+	case rules.SectionCertVerify:
+		v, ok = r.CertVerify[key]
+	case rules.SectionHosts:
+		v, ok = r.Hosts[key]
+	}
+	return v, ok
+}
+
+// formatValue renders a rule value for text output.
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case certPolicy:
+		if v.Verify {
+			return "verify"
+		}
+		if len(v.Allow) == 0 {
+			return "skip verification"
+		}
+		return "allow " + strings.Join(v.Allow, ", ")
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,142 @@
+// Command snirect-rules inspects and converts Snirect rule files.
+//
+//	snirect-rules [-json] <command> [arguments]
+//
+// Commands:
+//
+//	lint     validate rule files and report keys that never take effect
+//	test     print the alter_hostname, hosts and cert_verify result for a host
+//	explain  show which layer and key is behind each result for a host
+//	diff     compare two rule files
+//	convert  convert between TOML, JSON, Cealing-Host and hosts files
+//
+// Commands that read rules take the embedded layers (fetched, default, user)
+// when no files are given. With -json every command writes a single JSON
+// document to stdout. The exit status is 0 on success, 1 when lint finds
+// errors or diff finds differences, and 2 for usage or I/O errors.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `Usage: snirect-rules [-json] <command> [arguments]
+
+Commands:
+  lint [-strict] [file...]                    validate rule files
+  test [-port N] [-app name] [-rules file]... <host>
+                                              print lookup results for a host
+  explain [-port N] [-app name] [-rules file]... <host>
+                                              show the layers behind each result
+  diff [-from format] <old> <new>             compare two rule files
+  convert [-from format] -to format <in> <out>
+                                              convert between formats
+  migrate [-from format] [-auto-marker m] <in> <out>
+                                              upgrade a toml or json file to the
+                                              current format version
+
+Formats: toml, json, cealing, hosts (default: by extension and content).
+Without files, lint, test and explain use the embedded rules.`
+
+// Exit statuses.
+const (
+	exitOK    = 0
+	exitFail  = 1
+	exitUsage = 2
+)
+
+// errUsage reports invalid arguments; the usage text is printed.
+var errUsage = errors.New("invalid arguments")
+
+// errFailed makes the command exit with exitFail after its output is written.
+var errFailed = errors.New("check failed")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// cli carries the output settings shared by every command.
+type cli struct {
+	stdout, stderr io.Writer
+	json           bool
+}
+
+// output writes v as JSON in -json mode, and calls text otherwise.
+func (c *cli) output(v any, text func(w io.Writer)) error {
+	if !c.json {
+		text(c.stdout)
+		return nil
+	}
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	c := &cli{stdout: stdout, stderr: stderr}
+	fs := flag.NewFlagSet("snirect-rules", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprintln(stderr, usage) }
+	fs.BoolVar(&c.json, "json", false, "write machine-readable JSON to stdout")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, usage)
+		return exitUsage
+	}
+
+	commands := map[string]func(*cli, []string) error{
+		"lint":    (*cli).lint,
+		"test":    (*cli).test,
+		"explain": (*cli).explain,
+		"diff":    (*cli).diff,
+		"convert": (*cli).convert,
+		"migrate": (*cli).migrate,
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "snirect-rules: unknown command %q\n%s\n", fs.Arg(0), usage)
+		return exitUsage
+	}
+
+	switch err := cmd(c, fs.Args()[1:]); {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errFailed):
+		return exitFail
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		fmt.Fprintln(stderr, usage)
+		return exitUsage
+	default:
+		fmt.Fprintf(stderr, "snirect-rules %s: %v\n", fs.Arg(0), err)
+		return exitUsage
+	}
+}
+
+// newFlagSet returns a flag set for a command that reports errors through run.
+func (c *cli) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {}
+	return fs
+}
+
+// parseFlags parses a command's flags, turning flag errors into errUsage.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	return nil
+}
+
+// fileList is a repeatable string flag.
+type fileList []string
+
+func (f *fileList) String() string     { return fmt.Sprint(*f) }
+func (f *fileList) Set(v string) error { *f = append(*f, v); return nil }
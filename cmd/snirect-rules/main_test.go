@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xihale/snirect-shared/rules"
+)
+
+const baseTOML = `[alter_hostname]
+"*.example.com" = "front.example.net"
+"*github.com" = "g"
+
+[hosts]
+"*.example.com" = "192.0.2.1"
+`
+
+const overrideTOML = `[alter_hostname]
+"*.example.com" = "other.example.net"
+"api.github.com" = ""
+
+[cert_verify]
+"*.example.com" = ["front.example.net"]
+`
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func runCLI(t *testing.T, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	code = run(args, &out, &errOut)
+	return out.String(), errOut.String(), code
+}
+
+func decode[T any](t *testing.T, s string) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, s)
+	}
+	return v
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{nil, {"nope"}, {"test"}, {"convert", "-to", "yaml", "a", "b"}, {"lint", "-bogus"}} {
+		if _, _, code := runCLI(t, args...); code != exitUsage {
+			t.Errorf("run(%q) = %d, want %d", args, code, exitUsage)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	good := writeFile(t, "good.toml", baseTOML)
+	bad := writeFile(t, "bad.toml", "[hosts]\n\"bad:port\" = \"192.0.2.1\"\n")
+
+	if out, _, code := runCLI(t, "lint", good); code != exitOK || !strings.Contains(out, "ok:") {
+		t.Errorf("lint good = %d\n%s", code, out)
+	}
+	out, _, code := runCLI(t, "-json", "lint", good, bad)
+	if code != exitFail {
+		t.Errorf("lint bad = %d, want %d", code, exitFail)
+	}
+	res := decode[lintResult](t, out)
+	if res.OK || res.Errors != 1 || len(res.Layers) != 2 {
+		t.Errorf("lint bad = %+v", res)
+	}
+	if _, _, code := runCLI(t, "lint"); code != exitOK {
+		t.Errorf("lint of the embedded rules = %d, want %d", code, exitOK)
+	}
+}
+
+func TestTest(t *testing.T) {
+	base := writeFile(t, "base.toml", baseTOML)
+	override := writeFile(t, "override.toml", overrideTOML)
+
+	out, _, code := runCLI(t, "-json", "test", "-rules", base, "-rules", override, "www.example.com")
+	if code != exitOK {
+		t.Fatalf("test = %d", code)
+	}
+	res := decode[struct {
+		Host    string
+		Results []struct {
+			Section string
+			Matched bool
+			Key     string
+			Value   any
+		}
+	}](t, out)
+	got := make(map[string]string)
+	for _, e := range res.Results {
+		got[e.Section] = e.Key
+		if e.Section == "alter_hostname" && e.Value != "other.example.net" {
+			t.Errorf("alter_hostname value = %v", e.Value)
+		}
+	}
+	want := map[string]string{"alter_hostname": "*.example.com", "hosts": "*.example.com", "cert_verify": "*.example.com"}
+	if res.Host != "www.example.com" || !maps.Equal(got, want) {
+		t.Errorf("test = %s", out)
+	}
+
+	out, _, _ = runCLI(t, "test", "-rules", base, "unknown.org")
+	if strings.Count(out, "no match") != 3 {
+		t.Errorf("test unknown.org =\n%s", out)
+	}
+
+	scoped := writeFile(t, "scoped.toml", "[alter_hostname]\n\"www.example.com\" = { sni = \"app.example.net\", apps = [\"com.example.app\"] }\n")
+	out, _, _ = runCLI(t, "test", "-rules", base, "-rules", scoped, "-app", "com.example.app", "www.example.com")
+	if !strings.Contains(out, `"app.example.net"`) {
+		t.Errorf("test -app =\n%s", out)
+	}
+	out, _, _ = runCLI(t, "test", "-rules", base, "-rules", scoped, "www.example.com")
+	if strings.Contains(out, `"app.example.net"`) {
+		t.Errorf("test without -app used an app-scoped rule:\n%s", out)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	base := writeFile(t, "base.toml", baseTOML)
+	override := writeFile(t, "override.toml", overrideTOML)
+
+	out, _, code := runCLI(t, "explain", "-rules", base, "-rules", override, "api.github.com")
+	if code != exitOK {
+		t.Fatalf("explain = %d", code)
+	}
+	for _, want := range []string{
+		`alter_hostname: "api.github.com" = "" (from ` + override + `)`,
+		`"*github.com" = "g", loses to "api.github.com"`,
+		"cert_verify: no match",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("explain output lacks %q:\n%s", want, out)
+		}
+	}
+
+	out, _, _ = runCLI(t, "-json", "explain", "-rules", base, "-rules", override, "www.example.com")
+	res := decode[explainResult](t, out)
+	alt := res.Sections[0]
+	if alt.Layer != override || len(alt.Layers) != 2 || !alt.Layers[0].Defines || alt.Layers[0].Value != "front.example.net" {
+		t.Errorf("explain alter_hostname = %+v", alt)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	base := writeFile(t, "base.toml", baseTOML)
+	override := writeFile(t, "override.toml", overrideTOML)
+
+	if _, _, code := runCLI(t, "diff", base, base); code != exitOK {
+		t.Errorf("diff of identical files = %d, want %d", code, exitOK)
+	}
+	out, _, code := runCLI(t, "diff", base, override)
+	if code != exitFail {
+		t.Errorf("diff = %d, want %d", code, exitFail)
+	}
+	for _, line := range []string{
+		"2 added, 2 removed, 1 changed; 5 of 5 sample hosts affected",
+		`~ "*.example.com": "front.example.net" -> "other.example.net"`,
+		`+ "api.github.com" = ""`,
+		"[hosts]\n- \"*.example.com\" = \"192.0.2.1\"",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("diff output lacks %q:\n%s", line, out)
+		}
+	}
+
+	sample := writeFile(t, "sample.txt", "# review hosts\nwww.example.com\n\nunrelated.org\n")
+	out, _, _ = runCLI(t, "-json", "diff", "-hosts", sample, base, override)
+	res := decode[struct {
+		Old     string
+		Changes []rules.Change
+		Sampled int
+		Impact  []rules.HostImpact
+	}](t, out)
+	if res.Old != base || len(res.Changes) != 5 || res.Sampled != 2 || len(res.Impact) != 3 {
+		t.Errorf("diff -json = %s", out)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	list := writeFile(t, "list.json", `[
+  [["*pixiv.net", "#off.example"], "pixivision.net", "210.140.139.155"],
+  [["$legacy.example"], null, "192.0.2.9"]
+]`)
+	dir := t.TempDir()
+	toml := filepath.Join(dir, "out.toml")
+	hosts := filepath.Join(dir, "hosts")
+	back := filepath.Join(dir, "back.json")
+
+	if _, errOut, code := runCLI(t, "convert", "-to", "toml", list, toml); code != exitOK {
+		t.Fatalf("convert to toml = %d: %s", code, errOut)
+	}
+	data, _ := os.ReadFile(toml)
+	if !strings.Contains(string(data), `"$legacy.example" = "192.0.2.9"`) {
+		t.Errorf("cealing to toml =\n%s", data)
+	}
+
+	out, _, code := runCLI(t, "-json", "convert", "-to", "hosts", toml, hosts)
+	if code != exitOK {
+		t.Fatalf("convert to hosts = %d", code)
+	}
+	res := decode[convertResult](t, out)
+	if res.From != formatTOML || len(res.Warnings) != 2 {
+		t.Errorf("convert to hosts = %+v", res)
+	}
+
+	if _, errOut, code := runCLI(t, "convert", "-to", "cealing", toml, back); code != exitOK {
+		t.Fatalf("convert to cealing = %d: %s", code, errOut)
+	}
+	data, _ = os.ReadFile(back)
+	if !strings.Contains(string(data), `[["*pixiv.net"],"pixivision.net","210.140.139.155"]`) || strings.Contains(string(data), "#off.example") {
+		t.Errorf("toml to cealing =\n%s", data)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	legacy := writeFile(t, "legacy.toml", "# overrides\n[hosts]\n\"$github.com\" = \"AUTO\" # keep\n")
+	out := filepath.Join(t.TempDir(), "out.toml")
+
+	stdout, errOut, code := runCLI(t, "-json", "migrate", "-auto-marker", "AUTO", legacy, out)
+	if code != exitOK {
+		t.Fatalf("migrate = %d: %s", code, errOut)
+	}
+	res := decode[migrateResult](t, stdout)
+	if res.From != 0 || res.To != rules.SchemaVersion || len(res.Changes) != 1 {
+		t.Errorf("migrate -json = %s", stdout)
+	}
+	data, _ := os.ReadFile(out)
+	if want := "version = 1\n\n# overrides\n[hosts]\n\"github.com\" = \"__AUTO__\" # keep\n"; string(data) != want {
+		t.Errorf("migrated file =\n%s\nwant\n%s", data, want)
+	}
+
+	newer := writeFile(t, "newer.json", `{"version": 99, "rules": []}`)
+	if _, errOut, code := runCLI(t, "migrate", newer, out); code == exitOK || !strings.Contains(errOut, "newer") {
+		t.Errorf("migrate of a newer file = %d: %s", code, errOut)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/xihale/snirect-shared/rules"
+)
+
+type migrateResult struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	*rules.MigrationReport
+}
+
+// migrate upgrades a TOML or JSON rule file to the current format version.
+func (c *cli) migrate(args []string) error {
+	fs := c.newFlagSet("migrate")
+	from := fs.String("from", "", "format of the file, toml or json (default: detected)")
+	marker := fs.String("auto-marker", "", "custom auto marker the file was written for")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("%w: migrate takes an input and an output file", errUsage)
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	format := *from
+	if format == "" {
+		format = detectFormat(fs.Arg(0), data)
+	}
+	opts := rules.MigrateOptions{AutoMarker: *marker}
+	var out []byte
+	var rep *rules.MigrationReport
+	switch format {
+	case formatTOML:
+		out, rep, err = rules.MigrateTOML(data, opts)
+	case formatJSON:
+		out, rep, err = rules.MigrateJSON(data, opts)
+	default:
+		return fmt.Errorf("%w: migrate supports the toml and json formats, not %q", errUsage, format)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+	if err := os.WriteFile(fs.Arg(1), out, 0o644); err != nil {
+		return err
+	}
+
+	res := migrateResult{Input: fs.Arg(0), Output: fs.Arg(1), MigrationReport: rep}
+	return c.output(res, func(w io.Writer) {
+		fmt.Fprintf(w, "%s -> %s: %s", res.Input, res.Output, rep)
+	})
+}
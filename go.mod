@@ -1,5 +1,10 @@
 module github.com/xihale/snirect-shared
 
-go 1.25
+go 1.25.0
 
 require github.com/pelletier/go-toml/v2 v2.2.4
+
+require (
+	golang.org/x/net v0.50.0
+	golang.org/x/text v0.34.0 // indirect
+)
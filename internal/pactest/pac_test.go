@@ -0,0 +1,179 @@
+// Package pactest runs the PAC scripts generated by rules.GeneratePAC in a
+// JavaScript engine and checks them against Go lookups. It is a module of its
+// own so the engine is not a dependency of the library.
+package pactest
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/xihale/snirect-shared/pattern"
+	"github.com/xihale/snirect-shared/rules"
+)
+
+// pacRunner evaluates a generated PAC script.
+type pacRunner func(url, host string) string
+
+func loadPAC(t *testing.T, r *rules.Rules, proxy string) pacRunner {
+	t.Helper()
+	script, err := rules.GeneratePAC(r, proxy)
+	if err != nil {
+		t.Fatalf("rules.GeneratePAC() error = %v", err)
+	}
+	vm := goja.New()
+	if _, err := vm.RunString(script); err != nil {
+		t.Fatalf("running PAC script: %v\n%s", err, script)
+	}
+	var find func(string, string) string
+	if err := vm.ExportTo(vm.Get("FindProxyForURL"), &find); err != nil {
+		t.Fatalf("FindProxyForURL: %v", err)
+	}
+	return find
+}
+
+// pacURL builds the URL a browser would pass for host and port.
+func pacURL(host string, port int) string {
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	switch port {
+	case 0:
+		return "foo://" + host + "/"
+	case 443:
+		return "https://" + host + "/"
+	case 80:
+		return "http://" + host + "/"
+	}
+	return "https://" + net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(port)) + "/"
+}
+
+// proxied is the Go reference: a host is proxied when either section matches.
+func proxied(r *rules.Rules, host string, port int) bool {
+	_, alt := r.LookupAlterHostname(host, port)
+	_, ip := r.LookupHost(host, port)
+	return alt || ip
+}
+
+func TestGeneratePAC(t *testing.T) {
+	r := rules.NewRules()
+	r.AlterHostname["*.example.com^*.direct.example.com^login.example.com"] = "sni.example.net"
+	r.AlterHostname["*github.com"] = "g"
+	r.AlterHostname["cdn?.{foo,bar}.net"] = ""
+	r.AlterHostname["[ab]*.class.org"] = ""
+	r.AlterHostname[`re:^(www|api)\.re-?test\.io$`] = ""
+	r.AlterHostname["ported.example.org:8443"] = ""
+	r.AlterHostname["*.range.example.org:8000-8100^skip.range.example.org"] = ""
+	r.AlterHostname["#*disabled.example*"] = ""
+	r.Hosts["203.0.113.0/24^203.0.113.7"] = "203.0.113.1"
+	r.Hosts["ip:2001:db8::/32"] = "2001:db8::1"
+	r.Hosts["exact.example.net"] = "192.0.2.1"
+	r.Init()
+
+	tests := []struct {
+		host string
+		port int
+		want bool
+	}{
+		{"www.example.com", 443, true},
+		{"example.com", 443, true},
+		{"WWW.Example.COM", 443, true},
+		{"www.example.com.", 443, true},
+		{"a.direct.example.com", 443, false},
+		{"direct.example.com", 443, false},
+		{"login.example.com", 443, false},
+		{"example.community", 443, false},
+		{"github.com", 443, true},
+		{"mygithub.com", 80, true},
+		{"github.com.evil.net", 443, false},
+		{"cdn1.foo.net", 443, true},
+		{"cdnx.bar.net", 443, true},
+		{"cdn.foo.net", 443, false},
+		{"cdn12.foo.net", 443, false},
+		{"apple.class.org", 443, true},
+		{"cherry.class.org", 443, false},
+		{"www.retest.io", 443, true},
+		{"API.re-test.io", 443, true},
+		{"web.retest.io", 443, false},
+		{"ported.example.org", 8443, true},
+		{"ported.example.org", 443, false},
+		{"ported.example.org", 0, false},
+		{"a.range.example.org", 8050, true},
+		{"a.range.example.org", 8101, false},
+		{"skip.range.example.org", 8050, false},
+		{"disabled.example.net", 443, false},
+		{"203.0.113.9", 443, true},
+		{"203.0.113.7", 443, false},
+		{"203.0.114.9", 443, false},
+		{"2001:db8::5", 443, true},
+		{"2001:0db8:0:0::5", 443, true},
+		{"2001:db9::5", 443, false},
+		{"::ffff:203.0.113.9", 443, true},
+		{"exact.example.net", 80, true},
+		{"sub.exact.example.net", 80, false},
+		{"unrelated.org", 443, false},
+	}
+
+	find := loadPAC(t, r, "127.0.0.1:7654")
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s:%d", tt.host, tt.port), func(t *testing.T) {
+			if ref := proxied(r, tt.host, tt.port); ref != tt.want {
+				t.Fatalf("reference lookup = %v, want %v", ref, tt.want)
+			}
+			want := "DIRECT"
+			if tt.want {
+				want = "PROXY 127.0.0.1:7654"
+			}
+			if got := find(pacURL(tt.host, tt.port), tt.host); got != want {
+				t.Errorf("FindProxyForURL() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestGeneratePACProxy(t *testing.T) {
+	r := rules.NewRules()
+	r.Hosts["example.com"] = "192.0.2.1"
+	r.Init()
+	for _, proxy := range []string{"PROXY 127.0.0.1:1", "HTTPS proxy.example:443; DIRECT"} {
+		if got := loadPAC(t, r, proxy)("https://example.com/", "example.com"); got != proxy {
+			t.Errorf("FindProxyForURL() with proxy %q = %q", proxy, got)
+		}
+	}
+	if _, err := rules.GeneratePAC(r, " "); err == nil {
+		t.Error("rules.GeneratePAC() with an empty proxy succeeded")
+	}
+}
+
+// TestGeneratePACEmbeddedRules checks the PAC agrees with Go lookups on the
+// embedded rules, probing every example host of every key.
+func TestGeneratePACEmbeddedRules(t *testing.T) {
+	r, err := rules.LoadDefaultRules()
+	if err != nil {
+		t.Fatalf("rules.LoadDefaultRules() error = %v", err)
+	}
+	find := loadPAC(t, r, "PROXY 127.0.0.1:1")
+
+	probes := []string{"example.com", "www.google.com.hk", "github.com"}
+	for _, section := range []rules.Section{rules.SectionAlterHostname, rules.SectionHosts} {
+		for _, k := range r.Keys(section) {
+			if p, err := pattern.Compile(k); err == nil {
+				probes = append(probes, p.Examples()...)
+			}
+		}
+	}
+	for _, host := range probes {
+		for _, port := range []int{443, 80} {
+			want := "DIRECT"
+			if proxied(r, host, port) {
+				want = "PROXY 127.0.0.1:1"
+			}
+			if got := find(pacURL(host, port), host); got != want {
+				t.Errorf("FindProxyForURL(%s:%d) = %q, want %q", host, port, got, want)
+			}
+		}
+	}
+}
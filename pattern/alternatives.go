@@ -0,0 +1,136 @@
+package pattern
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// AltKind classifies an Alternative by the simplest form that describes it.
+type AltKind int
+
+const (
+	AltExact  AltKind = iota // a literal host: "www.example.com"
+	AltSuffix                // a domain and its subdomains: "*.example.com"
+	AltGlob                  // any other glob: "*example.com", "cdn?.example.com"
+	AltIP                    // an IP address or CIDR range
+	AltRegex                 // a regex term
+)
+
+// Alternative is one expanded alternative of a term, for tools that translate
+// patterns into other rule formats. "*.{a,b}.com" has the alternatives
+// "*.a.com" and "*.b.com".
+type Alternative struct {
+	Kind AltKind
+	// Host is the literal host (AltExact) or the domain (AltSuffix), in A-labels.
+	Host string
+	// Glob is the A-label glob (AltExact, AltSuffix, AltGlob).
+	Glob string
+	// Prefix is the address range (AltIP).
+	Prefix netip.Prefix
+	// Regexp is an anchored RE2 expression matching the same hosts (all kinds
+	// but AltIP).
+	Regexp string
+	// Literal is the longest literal substring every matching host contains,
+	// e.g. "example.com" for "*example.com" (AltGlob, AltRegex).
+	Literal string
+}
+
+// Alternatives returns the alternatives of the include term; use Exclusions
+// for those of the exclusion terms. Ignored patterns have none.
+func (p *Pattern) Alternatives() []Alternative {
+	if p == nil || p.ignored {
+		return nil
+	}
+	out := make([]Alternative, len(p.include.atoms))
+	for i, a := range p.include.atoms {
+		out[i] = a.alternative()
+	}
+	return out
+}
+
+func (a atom) alternative() Alternative {
+	switch {
+	case a.isIP:
+		return Alternative{Kind: AltIP, Prefix: a.ip}
+	case a.re != nil:
+		alt := Alternative{Kind: AltRegex, Regexp: a.re.String()}
+		if re, err := syntax.Parse(a.re.String(), syntax.Perl); err == nil {
+			alt.Literal = strings.ToLower(regexLiteralSuffix(re.Simplify()))
+		}
+		return alt
+	}
+
+	alt := Alternative{Glob: a.glob, Regexp: globRegexp(a.glob)}
+	switch rest, ok := strings.CutPrefix(a.glob, "*."); {
+	case !strings.ContainsAny(a.glob, globMeta):
+		alt.Kind, alt.Host = AltExact, a.glob
+	case ok && !strings.ContainsAny(rest, globMeta):
+		alt.Kind, alt.Host = AltSuffix, rest
+	default:
+		alt.Kind = AltGlob
+		for _, tok := range strings.FieldsFunc(a.glob, func(r rune) bool { return strings.ContainsRune(globMeta, r) }) {
+			if len(tok) > len(alt.Literal) {
+				alt.Literal = tok
+			}
+		}
+	}
+	return alt
+}
+
+// globRegexp translates a glob into an anchored regex with the same matches on
+// hostnames, including the bare domain matched by "*.domain".
+func globRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteByte('^')
+	tokens := tokenizeGlob(glob)
+	if rest, ok := strings.CutPrefix(glob, "*."); ok && !strings.ContainsAny(rest, globMeta) {
+		// "*.example.com" also matches example.com itself
+		b.WriteString(`(?:[^/]*\.)?`)
+		tokens = tokens[2:]
+	}
+	for _, tok := range tokens {
+		switch tok.kind {
+		case tokStar:
+			b.WriteString(`[^/]*`)
+		case tokAny:
+			b.WriteString(`[^/]`)
+		case tokClass:
+			b.WriteString(classRegexp(tok.class))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(tok.b)))
+		}
+	}
+	b.WriteByte('$')
+	return b.String()
+}
+
+// classRegexp translates a path.Match class body such as "^a-z0" into an RE2 class.
+func classRegexp(body string) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	if rest, ok := strings.CutPrefix(body, "^"); ok {
+		b.WriteByte('^')
+		body = rest
+	}
+	char := func(i int) (byte, int) {
+		if body[i] == '\\' && i+1 < len(body) {
+			return body[i+1], i + 2
+		}
+		return body[i], i + 1
+	}
+	for i := 0; i < len(body); {
+		var lo byte
+		lo, i = char(i)
+		fmt.Fprintf(&b, `\x{%x}`, lo)
+		if i+1 < len(body) && body[i] == '-' {
+			var hi byte
+			hi, i = char(i + 1)
+			fmt.Fprintf(&b, `-\x{%x}`, hi)
+		}
+	}
+	b.WriteByte(']')
+	return b.String()
+}
@@ -0,0 +1,69 @@
+package pattern
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestAlternatives(t *testing.T) {
+	tests := []struct {
+		pattern string
+		kind    AltKind
+		host    string
+		literal string
+	}{
+		{"www.example.com", AltExact, "www.example.com", ""},
+		{"*.example.com", AltSuffix, "example.com", ""},
+		{"*example.com", AltGlob, "", "example.com"},
+		{"cdn[0-9]?.example.com", AltGlob, "", ".example.com"},
+		{"10.0.0.0/8", AltIP, "", ""},
+		{`/cdn[0-9]+\.example\.com/`, AltRegex, "", ".example.com"},
+		{"*.例え.jp", AltSuffix, "xn--r8jz45g.jp", ""},
+	}
+	for _, tt := range tests {
+		alts := MustCompile(tt.pattern).Alternatives()
+		if len(alts) != 1 {
+			t.Fatalf("Alternatives(%q) = %d alternatives, want 1", tt.pattern, len(alts))
+		}
+		a := alts[0]
+		if a.Kind != tt.kind || a.Host != tt.host || a.Literal != tt.literal {
+			t.Errorf("Alternatives(%q) = %+v, want kind %d host %q literal %q", tt.pattern, a, tt.kind, tt.host, tt.literal)
+		}
+	}
+
+	if alts := MustCompile("*.{google,youtube}.com").Alternatives(); len(alts) != 2 || alts[1].Host != "youtube.com" {
+		t.Errorf("alternation = %+v", alts)
+	}
+	if alts := MustCompile("#*.example.com").Alternatives(); alts != nil {
+		t.Errorf("ignored pattern has alternatives %+v", alts)
+	}
+}
+
+// TestAlternativeRegexp checks that the regex of each glob alternative agrees
+// with the glob on a range of hosts.
+func TestAlternativeRegexp(t *testing.T) {
+	patterns := []string{
+		"www.example.com", "*.example.com", "*example.com", "a*b.example.com",
+		"cdn?.example.com", "cdn[0-9].example.com", "cdn[^0].example.com", "x[a\\-c].com",
+		"*", "*.*.example.com",
+	}
+	hosts := []string{
+		"example.com", "www.example.com", "a.b.example.com", "notexample.com", "axb.example.com",
+		"ab.example.com", "cdn1.example.com", "cdn0.example.com", "cdnx.example.com",
+		"x-.com", "xb.com", "xa.com", "example.org", "",
+	}
+	for _, p := range patterns {
+		c := MustCompile(p)
+		for _, alt := range c.Alternatives() {
+			re := regexp.MustCompile(alt.Regexp)
+			for _, h := range hosts {
+				if h == "" {
+					continue
+				}
+				if got, want := re.MatchString(h), c.Match(h); got != want {
+					t.Errorf("%q: regexp %s matches %q = %v, pattern says %v", p, alt.Regexp, h, got, want)
+				}
+			}
+		}
+	}
+}
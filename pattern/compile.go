@@ -0,0 +1,157 @@
+package pattern
+
+import (
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// Pattern is a compiled host pattern. Compiling once avoids re-parsing the
+// pattern string, port suffixes and IDN labels on every match.
+type Pattern struct {
+	raw     string
+	ignored bool
+	include term
+	exclude []term
+}
+
+// term is a single include or exclude part of a pattern.
+// It matches if any of its atoms (expanded alternatives) matches.
+type term struct {
+	text  string // source text, used when a term is split out of its pattern
+	atoms []atom
+	ports portRange
+}
+
+// atom is a glob, an IP prefix or an anchored regex.
+type atom struct {
+	glob string
+	ip   netip.Prefix
+	isIP bool
+	re   *regexp.Regexp
+}
+
+// Compile parses a pattern string. See MatchPattern for the supported syntax and
+// the grammar comment in parse.go for the precise rules; parse failures are
+// reported as *SyntaxError.
+//
+// Literal labels are normalized to A-labels with UTS-46 mapping, so "*.例え.jp"
+// and "*.xn--r8jz45g.jp" compile to the same pattern. Regex terms ("re:..." or
+// "/.../") are matched against the whole A-label host. Patterns starting with an
+// ignore prefix (#, $, ^) compile successfully but never match.
+func Compile(s string) (*Pattern, error) {
+	p := &Pattern{raw: s}
+
+	s = strings.TrimSpace(s)
+	s = strings.Trim(s, "\"")
+	s = strings.Trim(s, "'")
+	s = strings.TrimSpace(s)
+
+	if err := parse(p, s); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// MustCompile is like Compile but panics if the pattern cannot be parsed.
+func MustCompile(s string) *Pattern {
+	p, err := Compile(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Include returns the include term as a pattern of its own, without exclusions.
+func (p *Pattern) Include() *Pattern {
+	if p.ignored {
+		return p
+	}
+	return &Pattern{raw: p.include.text, include: p.include}
+}
+
+// Exclusions returns each exclusion term as a pattern of its own.
+func (p *Pattern) Exclusions() []*Pattern {
+	out := make([]*Pattern, len(p.exclude))
+	for i, t := range p.exclude {
+		out[i] = &Pattern{raw: t.text, include: t}
+	}
+	return out
+}
+
+// Ports returns the inclusive port range of the include term, or 0, 0 if the
+// pattern applies to every port.
+func (p *Pattern) Ports() (lo, hi int) {
+	return p.include.ports.lo, p.include.ports.hi
+}
+
+// Ignored reports whether the pattern starts with an ignore prefix and never matches.
+func (p *Pattern) Ignored() bool {
+	return p.ignored
+}
+
+// String returns the source text of the pattern.
+func (p *Pattern) String() string {
+	return p.raw
+}
+
+// Match reports whether host matches the pattern, ignoring port-restricted terms.
+func (p *Pattern) Match(host string) bool {
+	return p.MatchPort(host, 0)
+}
+
+// MatchPort reports whether host and port match the pattern.
+// A port of 0 means unknown: port-restricted terms then neither include nor exclude.
+func (p *Pattern) MatchPort(host string, port int) bool {
+	if p == nil || p.ignored {
+		return false
+	}
+	return p.matchNormalized(NormalizeHost(host), port)
+}
+
+// matchNormalized is MatchPort for a host already passed through NormalizeHost.
+func (p *Pattern) matchNormalized(host string, port int) bool {
+	if p.ignored || host == "" {
+		return false
+	}
+
+	// If the host doesn't match the include part, no match
+	if !p.include.match(host, port) {
+		return false
+	}
+
+	// If host matches an exclude part, it's excluded
+	for _, t := range p.exclude {
+		if t.match(host, port) {
+			return false
+		}
+	}
+
+	// Host matches include part and is not excluded
+	return true
+}
+
+// match reports whether a normalized host and port match the term.
+func (t term) match(host string, port int) bool {
+	if !t.ports.contains(port) {
+		return false
+	}
+	for _, a := range t.atoms {
+		if a.match(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether a normalized host matches the atom.
+func (a atom) match(host string) bool {
+	if a.isIP {
+		addr, ok := parseIPLiteral(host)
+		return ok && a.ip.Contains(addr)
+	}
+	if a.re != nil {
+		return a.re.MatchString(host)
+	}
+	return matchGlob(a.glob, host)
+}
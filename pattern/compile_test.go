@@ -0,0 +1,184 @@
+package pattern
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompileIDN(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		host    string
+		want    bool
+	}{
+		{name: "U-label pattern matches A-label host", pattern: "*.例え.jp", host: "xn--r8jz45g.jp", want: true},
+		{name: "A-label pattern matches U-label host", pattern: "*.xn--r8jz45g.jp", host: "www.例え.jp", want: true},
+		{name: "Mixed script labels", pattern: "shop.bücher.example", host: "SHOP.xn--bcher-kva.example", want: true},
+		{name: "Full-width characters are mapped", pattern: "ｅｘａｍｐｌｅ.com", host: "example.com", want: true},
+		{name: "Cyrillic lookalike does not match Latin", pattern: "*.xn--80ak6aa92e.com", host: "apple.com", want: false},
+		{name: "Cyrillic U-label host", pattern: "*.xn--80ak6aa92e.com", host: "www.аррӏе.com", want: true},
+		{name: "Non-transitional sharp s", pattern: "faß.de", host: "xn--fa-hia.de", want: true},
+		{name: "Wildcard mixed with U-label never matches", pattern: "*中国*", host: "xn--fiqs8s", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchPattern(tt.pattern, tt.host); got != tt.want {
+				t.Errorf("MatchPattern(%q, %q) = %v, want %v", tt.pattern, tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	valid := []string{
+		"*.example.com",
+		"*wik*.org^*wiki*edia.org",
+		"*example.com^",
+		"#*google*",
+		"$*google.com",
+		"*.例え.jp",
+		"ip:203.0.113.0/24",
+		"example.com:8000-8999",
+	}
+	for _, s := range valid {
+		if _, err := Compile(s); err != nil {
+			t.Errorf("Compile(%q) error = %v", s, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"*.xn--zz.com",
+		"*例え.jp",
+		"ip:example.com",
+		"example.com:https",
+		"example.com:0",
+		"[abc.com",
+	}
+	for _, s := range invalid {
+		if _, err := Compile(s); err == nil {
+			t.Errorf("Compile(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	tests := []struct {
+		pattern string
+		offset  int
+		msg     string
+	}{
+		{pattern: "*.yahoo.com^^*.media.yahoo.com", offset: 12, msg: "empty exclusion"},
+		{pattern: "*.{google,youtube.com", offset: 2, msg: "unterminated alternation"},
+		{pattern: "*.google}.com", offset: 8, msg: "unexpected '}'"},
+		{pattern: "*.{a,{b,c}}.com", offset: 5, msg: "nested alternation"},
+		{pattern: "*.{a^b,c}.com", offset: 4, msg: "exclusion inside alternation"},
+		{pattern: "{a:443,b}.com", offset: 2, msg: "':' inside alternation"},
+		{pattern: "*.{}.com", offset: 2, msg: "empty alternation"},
+		{pattern: "cdn[0-9.example.com", offset: 3, msg: "unterminated character class"},
+		{pattern: "*.com^example.com:http", offset: 18, msg: "invalid port in \"example.com:http\""},
+		{pattern: "{a,b,c,d}{a,b,c,d}{a,b,c,d}{a,b,c,d}{a,b}", offset: 0, msg: "alternation expands to more than 256 globs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			_, err := Compile(tt.pattern)
+			var serr *SyntaxError
+			if !errors.As(err, &serr) {
+				t.Fatalf("Compile(%q) error = %v, want *SyntaxError", tt.pattern, err)
+			}
+			if serr.Offset != tt.offset || serr.Msg != tt.msg {
+				t.Errorf("Compile(%q) = %q at %d, want %q at %d", tt.pattern, serr.Msg, serr.Offset, tt.msg, tt.offset)
+			}
+		})
+	}
+}
+
+func TestCompileRegex(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		host    string
+		port    int
+		want    bool
+	}{
+		{name: "re: prefix match", pattern: `re:cdn[0-9]+\.example\.com`, host: "cdn42.example.com", want: true},
+		{name: "re: prefix anchored", pattern: `re:cdn[0-9]+\.example\.com`, host: "xcdn42.example.com.evil", want: false},
+		{name: "re: prefix needs digits", pattern: `re:cdn[0-9]+\.example\.com`, host: "cdn.example.com", want: false},
+		{name: "re: prefix keeps escapes", pattern: `RE:\D+\.example\.com`, host: "www.example.com", want: true},
+		{name: "re: prefix is case-insensitive", pattern: `re:CDN\d\.example\.com`, host: "cdn1.example.com", want: true},
+		{name: "Slash regex match", pattern: `/r[0-9]+---sn-[a-z0-9]+\.googlevideo\.com/`, host: "r3---sn-a5mekn7s.googlevideo.com", want: true},
+		{name: "Slash regex with exclusion", pattern: `/cdn[0-9]+\.example\.com/^cdn0.example.com`, host: "cdn0.example.com", want: false},
+		{name: "Slash regex with exclusion allowed", pattern: `/cdn[0-9]+\.example\.com/^cdn0.example.com`, host: "cdn7.example.com", want: true},
+		{name: "Regex exclusion of glob", pattern: `*.example.com^/cdn[0-9]+\.example\.com/`, host: "cdn7.example.com", want: false},
+		{name: "Slash regex with port", pattern: `/.+\.example\.com/:443`, host: "a.example.com", port: 443, want: true},
+		{name: "Slash regex with other port", pattern: `/.+\.example\.com/:443`, host: "a.example.com", port: 80, want: false},
+		{name: "Escaped slash in regex", pattern: `/a\/?b\.com/`, host: "ab.com", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchPatternPort(tt.pattern, tt.host, tt.port); got != tt.want {
+				t.Errorf("MatchPatternPort(%q, %q, %d) = %v, want %v", tt.pattern, tt.host, tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileRegexErrors(t *testing.T) {
+	tests := []struct {
+		pattern string
+		offset  int
+	}{
+		{pattern: "re:", offset: 3},
+		{pattern: "re:cdn[0-9", offset: 3},
+		{pattern: "re:(a{1000}){1000}", offset: 3},
+		{pattern: "/cdn[0-9]+", offset: 0},
+		{pattern: "/cdn/x", offset: 5},
+		{pattern: "*.com^/a(/", offset: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			_, err := Compile(tt.pattern)
+			var serr *SyntaxError
+			if !errors.As(err, &serr) {
+				t.Fatalf("Compile(%q) error = %v, want *SyntaxError", tt.pattern, err)
+			}
+			if serr.Offset != tt.offset {
+				t.Errorf("Compile(%q) offset = %d (%s), want %d", tt.pattern, serr.Offset, serr.Msg, tt.offset)
+			}
+		})
+	}
+}
+
+func TestExamples(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{pattern: "*.example.com", want: []string{"example.com", "x.example.com"}},
+		{pattern: "*pixiv.net", want: []string{"xpixiv.net", "pixiv.net"}},
+		{pattern: "cdn[0-9].example.com", want: []string{"cdn0.example.com"}},
+		{pattern: "*.yahoo.com^*.yahoo.com", want: nil},
+		{pattern: `re:cdn[0-9]+\.example\.com`, want: []string{"cdn0.example.com"}},
+		{pattern: "ip:203.0.113.0/24", want: []string{"203.0.113.0"}},
+		{pattern: "#example.com", want: nil},
+	}
+
+	for _, tt := range tests {
+		got := MustCompile(tt.pattern).Examples()
+		if len(got) != len(tt.want) {
+			t.Errorf("Examples(%q) = %q, want %q", tt.pattern, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Examples(%q) = %q, want %q", tt.pattern, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package pattern
+
+import (
+	"regexp/syntax"
+	"strings"
+)
+
+// Examples returns a few hosts matched by the pattern, derived from its include
+// term with wildcards filled in. Hosts removed by an exclusion are dropped, so an
+// empty result for a non-ignored pattern suggests it can never match. The
+// examples are a sample, not an enumeration.
+func (p *Pattern) Examples() []string {
+	if p == nil || p.ignored {
+		return nil
+	}
+
+	port := p.include.ports.lo
+	seen := make(map[string]bool)
+	var out []string
+	for _, a := range p.include.atoms {
+		for _, host := range a.examples() {
+			if host == "" || seen[host] {
+				continue
+			}
+			seen[host] = true
+			if p.matchNormalized(host, port) {
+				out = append(out, host)
+			}
+		}
+	}
+	return out
+}
+
+// examples returns candidate hosts for an atom; callers filter them with match.
+func (a atom) examples() []string {
+	switch {
+	case a.isIP:
+		return []string{a.ip.Addr().String()}
+	case a.re != nil:
+		re, err := syntax.Parse(a.re.String(), syntax.Perl)
+		if err != nil {
+			return nil
+		}
+		var b strings.Builder
+		regexExample(&b, re.Simplify())
+		return []string{strings.ToLower(b.String())}
+	}
+
+	var out []string
+	if rest, ok := strings.CutPrefix(a.glob, "*."); ok {
+		// "*.example.com" also matches the bare domain.
+		out = append(out, globExample(rest, ""))
+	}
+	out = append(out, globExample(a.glob, "x"), globExample(a.glob, ""))
+	return out
+}
+
+// globExample fills each "*" with star, each "?" with "x" and each class with
+// its first member, then tidies up empty labels.
+func globExample(glob, star string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString(star)
+		case '?':
+			b.WriteByte('x')
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteByte(glob[i])
+			}
+		case '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end == -1 {
+				return ""
+			}
+			b.WriteByte(classExample(glob[i+1 : i+end]))
+			i += end
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	labels := strings.Split(b.String(), ".")
+	kept := labels[:0]
+	for _, l := range labels {
+		if l != "" {
+			kept = append(kept, l)
+		}
+	}
+	return strings.Join(kept, ".")
+}
+
+// classExample picks a byte accepted by a character class body such as "^0-9" or "a-z".
+func classExample(body string) byte {
+	if negated, ok := strings.CutPrefix(body, "^"); ok {
+		for _, c := range []byte("xq7-") {
+			if !strings.ContainsRune(negated, rune(c)) && !classHasRange(negated, c) {
+				return c
+			}
+		}
+		return 'x'
+	}
+	if body == "" {
+		return 'x'
+	}
+	if body[0] == '\\' && len(body) > 1 {
+		return body[1]
+	}
+	return body[0]
+}
+
+// classHasRange reports whether c falls in one of the "a-z" ranges of a class body.
+func classHasRange(body string, c byte) bool {
+	for i := 0; i+2 < len(body); i++ {
+		if body[i+1] == '-' && body[i] <= c && c <= body[i+2] {
+			return true
+		}
+	}
+	return false
+}
+
+// regexExample writes one short string matched by re.
+func regexExample(b *strings.Builder, re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		b.WriteString(strings.ToLower(string(re.Rune)))
+	case syntax.OpCharClass:
+		b.WriteRune(regexClassExample(re.Rune))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteByte('x')
+	case syntax.OpCapture, syntax.OpPlus:
+		regexExample(b, re.Sub[0])
+	case syntax.OpRepeat:
+		for i := 0; i < re.Min; i++ {
+			regexExample(b, re.Sub[0])
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			regexExample(b, sub)
+		}
+	case syntax.OpAlternate:
+		regexExample(b, re.Sub[0])
+	}
+}
+
+// regexClassExample picks a printable rune from a regex class given as range pairs,
+// preferring 'x' and '0'.
+func regexClassExample(ranges []rune) rune {
+	for _, want := range []rune{'x', '0'} {
+		for i := 0; i+1 < len(ranges); i += 2 {
+			if ranges[i] <= want && want <= ranges[i+1] {
+				return want
+			}
+		}
+	}
+	for i := 0; i+1 < len(ranges); i += 2 {
+		if ranges[i+1] > ' ' {
+			return max(ranges[i], '!')
+		}
+	}
+	return 'x'
+}
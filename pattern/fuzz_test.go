@@ -0,0 +1,185 @@
+package pattern_test
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/xihale/snirect-shared/pattern"
+	"github.com/xihale/snirect-shared/rules"
+)
+
+// embeddedKeys returns every rule key of the embedded TOML layers.
+func embeddedKeys(tb testing.TB) []string {
+	layers, err := rules.LoadLayers()
+	if err != nil {
+		tb.Fatalf("LoadLayers() error = %v", err)
+	}
+	var keys []string
+	for _, l := range layers {
+		for k := range l.Rules.AlterHostname {
+			keys = append(keys, k)
+		}
+		for k := range l.Rules.CertVerify {
+			keys = append(keys, k)
+		}
+		for k := range l.Rules.Hosts {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// seedHosts returns hosts worth matching against p: its examples plus
+// variations with glob metacharacters, which path.Match treats specially.
+func seedHosts(p string) []string {
+	hosts := []string{"example.com", "a[b.example.com", `a\b.example.com`, "*.example.com"}
+	if c, err := pattern.Compile(p); err == nil {
+		hosts = append(hosts, c.Examples()...)
+	}
+	return hosts
+}
+
+// referenceMatch is the original string-based matcher: "^" separates the
+// include glob from exclusion globs, "*.d" also matches d, and otherwise
+// path.Match decides, with literal equality as a fallback. It is an oracle for
+// the part of the grammar it understands; ok is false for anything else.
+func referenceMatch(p, host string) (matched, ok bool) {
+	p = strings.TrimSpace(p)
+	p = strings.Trim(p, "\"")
+	p = strings.Trim(p, "'")
+	p = strings.TrimSpace(p)
+	if p == "" || !isLegacySubset(p) || !isLegacySubset(host) {
+		return false, false
+	}
+	if strings.HasPrefix(p, "#") || strings.HasPrefix(p, "$") || strings.HasPrefix(p, "^") {
+		return false, true
+	}
+
+	p = strings.ToLower(strings.TrimSuffix(p, "."))
+	host = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+	if host == "" {
+		return false, true
+	}
+
+	globMatch := func(glob string) bool {
+		if domain, ok := strings.CutPrefix(glob, "*."); ok {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		}
+		if m, _ := path.Match(glob, host); m {
+			return true
+		}
+		return host == glob
+	}
+
+	parts := strings.Split(strings.TrimSuffix(p, "^"), "^")
+	if !globMatch(parts[0]) {
+		return false, true
+	}
+	for _, ex := range parts[1:] {
+		if globMatch(ex) {
+			return false, true
+		}
+	}
+	return true, true
+}
+
+// isLegacySubset reports whether s only uses syntax the reference matcher
+// shares with the current grammar: no ports, IPs, regexes, alternation or
+// escapes, and no "^" inside character classes.
+func isLegacySubset(s string) bool {
+	inClass := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case c == '^' && inClass:
+			return false
+		case c == '.' || c == '-' || c == '*' || c == '?' || c == '^' || c == '#' || c == '$' || c == '_':
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		default:
+			// Digits are left out so hosts never parse as IP literals.
+			return false
+		}
+	}
+	return true
+}
+
+func FuzzMatchPattern(f *testing.F) {
+	for _, k := range embeddedKeys(f) {
+		for _, host := range seedHosts(k) {
+			f.Add(k, host, 0)
+			f.Add(k, host, 443)
+		}
+	}
+	f.Add("*.yahoo.com^*.media.yahoo.com^", "media.yahoo.com", 0)
+	f.Add("[a-c]?.example.com", "b[.example.com", 0)
+	f.Add(`a\*b.example.com`, "a*b.example.com", 0)
+
+	f.Fuzz(func(t *testing.T, p, host string, port int) {
+		got := pattern.MatchPatternPort(p, host, port)
+
+		c, err := pattern.Compile(p)
+		if err != nil {
+			if got {
+				t.Fatalf("MatchPatternPort(%q, %q, %d) = true for an invalid pattern", p, host, port)
+			}
+			return
+		}
+		if c.MatchPort(host, port) != got {
+			t.Fatalf("Compile(%q).MatchPort(%q, %d) disagrees with MatchPatternPort", p, host, port)
+		}
+		if port == 0 && c.Match(host) != got {
+			t.Fatalf("Compile(%q).Match(%q) disagrees with MatchPattern", p, host)
+		}
+
+		if want, ok := referenceMatch(p, host); ok && port == 0 && got != want {
+			t.Fatalf("MatchPattern(%q, %q) = %v, reference matcher says %v", p, host, got, want)
+		}
+
+		if !c.Subsumes(c) {
+			t.Fatalf("%q does not subsume itself", p)
+		}
+	})
+}
+
+func FuzzSet(f *testing.F) {
+	keys := embeddedKeys(f)
+	for i, k := range keys {
+		list := strings.Join(keys[i:min(i+8, len(keys))], "\n")
+		for _, host := range seedHosts(k) {
+			f.Add(list, host, 0)
+		}
+	}
+	f.Add("*.example.com:443\n*.example.com\n10.0.0.0/8", "www.example.com", 443)
+	f.Add("re:.*\n#*\n*example.com^www.example.com", "www.example.com", 0)
+
+	f.Fuzz(func(t *testing.T, list, host string, port int) {
+		var patterns []*pattern.Pattern
+		for _, line := range strings.Split(list, "\n") {
+			p, _ := pattern.Compile(line) // invalid lines stay nil and never match
+			patterns = append(patterns, p)
+		}
+		set := pattern.NewSet(patterns)
+
+		want := -1
+		for i, p := range patterns {
+			if p != nil && p.MatchPort(host, port) {
+				want = i
+				break
+			}
+		}
+		got, ok := set.Match(host, port)
+		if !ok {
+			got = -1
+		}
+		if got != want {
+			t.Fatalf("Set.Match(%q, %d) = %d, linear scan says %d for patterns %q", host, port, got, want, list)
+		}
+	})
+}
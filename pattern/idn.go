@@ -0,0 +1,69 @@
+package pattern
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile maps labels to A-labels using UTS-46 non-transitional processing.
+// Hyphen and STD3 checks are relaxed because real-world hostnames (CDN shards,
+// underscored service names) routinely violate them.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+	idna.CheckHyphens(false),
+)
+
+// toASCIIHost converts a hostname to its A-label form.
+// Hosts that fail IDNA processing are returned lowercased but otherwise unchanged,
+// since a malformed SNI should simply not match rather than fail the lookup.
+func toASCIIHost(host string) string {
+	if isASCII(host) {
+		return strings.ToLower(host)
+	}
+	if ascii, err := idnaProfile.ToASCII(host); err == nil {
+		return ascii
+	}
+	return strings.ToLower(host)
+}
+
+// toASCIIGlob converts each literal label of a glob to its A-label form.
+// Labels containing wildcard metacharacters must be ASCII, because a partial
+// U-label has no well-defined punycode encoding.
+func toASCIIGlob(glob string) (string, error) {
+	labels := strings.Split(glob, ".")
+	for i, label := range labels {
+		if strings.ContainsAny(label, globMeta) {
+			if !isASCII(label) {
+				return "", fmt.Errorf("label %q mixes wildcards with non-ASCII characters", label)
+			}
+			labels[i] = strings.ToLower(label)
+			continue
+		}
+		if label == "" {
+			continue
+		}
+		ascii, err := idnaProfile.ToASCII(label)
+		if err != nil {
+			return "", fmt.Errorf("invalid label %q: %w", label, err)
+		}
+		labels[i] = ascii
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// globMeta lists the characters with special meaning to path.Match.
+const globMeta = `*?[]\`
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package pattern
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// ipPrefix marks a pattern term that must be interpreted as an IP address or CIDR range.
+const ipPrefix = "ip:"
+
+// NormalizeHost lowercases a host, strips surrounding whitespace and the trailing dot,
+// canonicalizes IP literals (e.g. "[2001:DB8::1]" becomes "2001:db8::1") and converts
+// internationalized names to A-labels (e.g. "例え.jp" becomes "xn--r8jz45g.jp").
+func NormalizeHost(host string) string {
+	host = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(host), "."))
+	if addr, ok := parseIPLiteral(host); ok {
+		return addr.String()
+	}
+	return toASCIIHost(host)
+}
+
+// parseIPLiteral parses an IPv4 or IPv6 literal, accepting IPv6 in brackets.
+// IPv4-mapped IPv6 addresses are unmapped so they compare equal to their IPv4 form.
+func parseIPLiteral(s string) (netip.Addr, bool) {
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		s = s[1 : len(s)-1]
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
+
+// parseIPTerm parses an IP-literal or CIDR pattern term.
+// Terms with the "ip:" prefix are always treated as IP terms; bare terms are treated
+// as IP terms only if they parse as an address or prefix.
+// isIP reports whether the term is an IP term; ok reports whether it is well-formed.
+func parseIPTerm(term string) (prefix netip.Prefix, isIP bool, ok bool) {
+	rest, explicit := strings.CutPrefix(term, ipPrefix)
+	if strings.HasPrefix(rest, "[") {
+		rest = strings.Replace(rest[1:], "]", "", 1)
+	}
+	if strings.Contains(rest, "/") {
+		p, err := netip.ParsePrefix(rest)
+		if err != nil {
+			return netip.Prefix{}, explicit, false
+		}
+		addr := p.Addr().Unmap()
+		bits := p.Bits()
+		if p.Addr().Is4In6() {
+			bits -= 96
+			if bits < 0 {
+				return netip.Prefix{}, explicit, false
+			}
+		}
+		return netip.PrefixFrom(addr, bits).Masked(), true, true
+	}
+	addr, ok := parseIPLiteral(rest)
+	if !ok {
+		return netip.Prefix{}, explicit, false
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), true, true
+}
@@ -3,54 +3,75 @@ package pattern
 import (
 	"path"
 	"strings"
+	"sync"
 )
 
 // MatchPattern checks if a host matches a pattern with support for:
 // - Wildcards: *.example.com, example*, *example.com
-// - Exclusion operator: pattern^exclude (e.g., *.yahoo.com^*.media.yahoo.com)
+// - Exclusion operator: pattern^exclude[^exclude...] (e.g., *.yahoo.com^*.media.yahoo.com)
+// - Alternation: *.{google,youtube}.com
+// - IP literals and CIDR ranges: 203.0.113.7, 203.0.113.0/24, ip:2001:db8::/32
+// - Internationalized names: *.例え.jp is equivalent to *.xn--r8jz45g.jp
+// - Regular expressions: re:cdn[0-9]+\.example\.com or /cdn[0-9]+\.example\.com/
 // - Ignore prefixes: #, $, ^ at the start
+//
+// IP-literal hosts are normalized first, so "[2001:DB8::1]" matches "2001:db8::/32".
+// Port-restricted terms never match here; use MatchPatternPort when the port is known.
+// Invalid patterns never match; use Compile to get the parse error.
+//
+// Compiled patterns are cached by pattern string (see cacheSize), so repeated
+// calls with the same few patterns do not recompile them; code matching many
+// distinct patterns should Compile them once, or use a Set.
 func MatchPattern(pattern, host string) bool {
-	host = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(host, ".")))
-	pattern = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(pattern, ".")))
-
-	pattern = strings.Trim(pattern, "\"")
-	pattern = strings.Trim(pattern, "'")
-	pattern = strings.TrimSpace(pattern)
-
-	if pattern == "" || host == "" {
-		return false
-	}
-
-	// Comment/Ignore prefixes: #, $, or ^ at the start means ignore this pattern
-	if strings.HasPrefix(pattern, "#") || strings.HasPrefix(pattern, "$") || strings.HasPrefix(pattern, "^") {
-		return false
-	}
+	return MatchPatternPort(pattern, host, 0)
+}
 
-	// Handle exclusion operator (^) in the middle of the pattern
-	// e.g., "*wik*.org^*wiki*edia.org" matches wikinews.org but excludes wikipedia.org
-	if idx := strings.Index(pattern, "^"); idx != -1 {
-		includePart := pattern[:idx]
-		excludePart := pattern[idx+1:]
+// MatchPatternPort is like MatchPattern but also honors port suffixes on pattern terms:
+// - Single port: example.com:443, [2001:db8::1]:443
+// - Port range: *.example.com:8000-8999
+//
+// Each term carries its own port restriction, so "*.example.com^api.example.com:8443"
+// only excludes api.example.com on port 8443. Terms without a port match every port.
+// A port of 0 means unknown: port-restricted terms then neither include nor exclude.
+func MatchPatternPort(pattern, host string, port int) bool {
+	p := cached(pattern)
+	return p != nil && p.MatchPort(host, port)
+}
 
-		// If the host doesn't match the include part, no match
-		if !matchInclude(includePart, host) {
-			return false
-		}
+// cacheSize bounds the patterns cached by MatchPattern and MatchPatternPort.
+const cacheSize = 256
 
-		// If host matches the exclude part, it's excluded
-		if excludePart != "" && matchInclude(excludePart, host) {
-			return false
-		}
+var cache = struct {
+	sync.Mutex
+	patterns map[string]*Pattern // nil for invalid patterns
+}{patterns: make(map[string]*Pattern)}
 
-		// Host matches include part and is not excluded
-		return true
+// cached returns the compiled pattern, or nil if it is invalid. When the cache
+// is full it is emptied rather than tracking recency, which keeps lookups cheap
+// for the common case of a small working set.
+func cached(pattern string) *Pattern {
+	cache.Lock()
+	p, ok := cache.patterns[pattern]
+	cache.Unlock()
+	if ok {
+		return p
 	}
 
-	return matchInclude(pattern, host)
+	p, err := Compile(pattern)
+	if err != nil {
+		p = nil
+	}
+	cache.Lock()
+	if len(cache.patterns) >= cacheSize {
+		clear(cache.patterns)
+	}
+	cache.patterns[pattern] = p
+	cache.Unlock()
+	return p
 }
 
-// matchInclude performs the actual pattern matching without exclusion logic
-func matchInclude(pattern, host string) bool {
+// matchGlob performs the actual pattern matching without exclusion logic
+func matchGlob(pattern, host string) bool {
 	// Special case: *.example.com matches the domain and all subdomains
 	if strings.HasPrefix(pattern, "*.") {
 		domain := pattern[2:]
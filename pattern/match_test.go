@@ -1,6 +1,7 @@
 package pattern
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -258,6 +259,182 @@ func TestMatchPattern(t *testing.T) {
 			host:    "yahoo.com",
 			want:    false,
 		},
+
+		// Multiple exclusions
+		{
+			name:    "Multiple exclusions match allowed",
+			pattern: "*.yahoo.com^*.media.yahoo.com^*.news.yahoo.com",
+			host:    "www.yahoo.com",
+			want:    true,
+		},
+		{
+			name:    "Multiple exclusions first excluded",
+			pattern: "*.yahoo.com^*.media.yahoo.com^*.news.yahoo.com",
+			host:    "images.media.yahoo.com",
+			want:    false,
+		},
+		{
+			name:    "Multiple exclusions second excluded",
+			pattern: "*.yahoo.com^*.media.yahoo.com^*.news.yahoo.com",
+			host:    "news.yahoo.com",
+			want:    false,
+		},
+		{
+			name:    "Character class negation is not an exclusion",
+			pattern: "cdn[^0].example.com",
+			host:    "cdn1.example.com",
+			want:    true,
+		},
+		{
+			name:    "Character class negation excludes class member",
+			pattern: "cdn[^0].example.com",
+			host:    "cdn0.example.com",
+			want:    false,
+		},
+
+		// Glob metacharacters in hosts are plain characters
+		{
+			name:    "Bracket in host matched by ?",
+			pattern: "a?b.example.com",
+			host:    "a[b.example.com",
+			want:    true,
+		},
+		{
+			name:    "Backslash in host matched by *",
+			pattern: "*.example.com",
+			host:    `a\b.example.com`,
+			want:    true,
+		},
+		{
+			name:    "Escaped star matches only a literal star",
+			pattern: `a\*b.example.com`,
+			host:    "axb.example.com",
+			want:    false,
+		},
+		{
+			name:    "Escaped star matches literal star",
+			pattern: `a\*b.example.com`,
+			host:    "a*b.example.com",
+			want:    true,
+		},
+
+		// Alternation
+		{
+			name:    "Alternation match first",
+			pattern: "*.{google,youtube}.com",
+			host:    "www.google.com",
+			want:    true,
+		},
+		{
+			name:    "Alternation match second root",
+			pattern: "*.{google,youtube}.com",
+			host:    "youtube.com",
+			want:    true,
+		},
+		{
+			name:    "Alternation no match",
+			pattern: "*.{google,youtube}.com",
+			host:    "www.gmail.com",
+			want:    false,
+		},
+		{
+			name:    "Alternation with empty choice",
+			pattern: "{www.,}example.com",
+			host:    "example.com",
+			want:    true,
+		},
+		{
+			name:    "Alternation in exclusion",
+			pattern: "*.yahoo.com^*.{media,news}.yahoo.com",
+			host:    "news.yahoo.com",
+			want:    false,
+		},
+		{
+			name:    "Ambiguous empty exclusion never matches",
+			pattern: "*.yahoo.com^^*.media.yahoo.com",
+			host:    "www.yahoo.com",
+			want:    false,
+		},
+
+		// IP literals and CIDR ranges
+		{
+			name:    "IPv4 literal match",
+			pattern: "203.0.113.7",
+			host:    "203.0.113.7",
+			want:    true,
+		},
+		{
+			name:    "Bare CIDR match",
+			pattern: "203.0.113.0/24",
+			host:    "203.0.113.99",
+			want:    true,
+		},
+		{
+			name:    "Bare CIDR no match",
+			pattern: "203.0.113.0/24",
+			host:    "203.0.114.1",
+			want:    false,
+		},
+		{
+			name:    "ip: prefix CIDR match",
+			pattern: "ip:203.0.113.0/24",
+			host:    "203.0.113.1",
+			want:    true,
+		},
+		{
+			name:    "ip: prefix never matches hostname",
+			pattern: "ip:203.0.113.0/24",
+			host:    "example.com",
+			want:    false,
+		},
+		{
+			name:    "Malformed ip: term never matches",
+			pattern: "ip:example.com",
+			host:    "example.com",
+			want:    false,
+		},
+		{
+			name:    "IPv6 CIDR match bracketed host",
+			pattern: "2001:db8::/32",
+			host:    "[2001:DB8::1]",
+			want:    true,
+		},
+		{
+			name:    "Bracketed IPv6 pattern match",
+			pattern: "ip:[2001:db8::1]",
+			host:    "2001:0db8:0000::1",
+			want:    true,
+		},
+		{
+			name:    "IPv4-mapped IPv6 host matches IPv4 CIDR",
+			pattern: "10.0.0.0/8",
+			host:    "[::ffff:10.1.2.3]",
+			want:    true,
+		},
+		{
+			name:    "IPv4 CIDR does not match IPv6 host",
+			pattern: "10.0.0.0/8",
+			host:    "2001:db8::1",
+			want:    false,
+		},
+		{
+			name:    "CIDR exclusion match",
+			pattern: "ip:10.0.0.0/8^10.1.0.0/16",
+			host:    "10.2.0.1",
+			want:    true,
+		},
+		{
+			name:    "CIDR exclusion excluded",
+			pattern: "ip:10.0.0.0/8^10.1.0.0/16",
+			host:    "10.1.0.1",
+			want:    false,
+		},
+		{
+			name:    "IPv4 glob still works",
+			pattern: "192.168.*",
+			host:    "192.168.1.1",
+			want:    true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -269,3 +446,82 @@ func TestMatchPattern(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "Example.COM.", want: "example.com"},
+		{host: " 203.0.113.7 ", want: "203.0.113.7"},
+		{host: "[2001:DB8:0::1]", want: "2001:db8::1"},
+		{host: "::ffff:192.0.2.1", want: "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeHost(tt.host); got != tt.want {
+			t.Errorf("NormalizeHost(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestMatchPatternPort(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		host    string
+		port    int
+		want    bool
+	}{
+		{name: "Port-less pattern matches any port", pattern: "*.example.com", host: "www.example.com", port: 8443, want: true},
+		{name: "Single port match", pattern: "example.com:443", host: "example.com", port: 443, want: true},
+		{name: "Single port no match", pattern: "example.com:443", host: "example.com", port: 8443, want: false},
+		{name: "Unknown port ignores port rule", pattern: "example.com:443", host: "example.com", port: 0, want: false},
+		{name: "Port range match", pattern: "*.example.com:8000-8999", host: "api.example.com", port: 8443, want: true},
+		{name: "Port range no match", pattern: "*.example.com:8000-8999", host: "api.example.com", port: 443, want: false},
+		{name: "Reversed port range never matches", pattern: "example.com:9000-8000", host: "example.com", port: 8443, want: false},
+		{name: "Invalid port never matches", pattern: "example.com:https", host: "example.com", port: 443, want: false},
+		{name: "Out of range port never matches", pattern: "example.com:70000", host: "example.com", port: 443, want: false},
+		{name: "Exclusion on other port does not exclude", pattern: "*.example.com^api.example.com:8443", host: "api.example.com", port: 443, want: true},
+		{name: "Exclusion on same port excludes", pattern: "*.example.com^api.example.com:8443", host: "api.example.com", port: 8443, want: false},
+		{name: "Port exclusion with unknown port does not exclude", pattern: "*.example.com^api.example.com:8443", host: "api.example.com", port: 0, want: true},
+		{name: "Port-less exclusion excludes every port", pattern: "*.example.com:443^api.example.com", host: "api.example.com", port: 443, want: false},
+		{name: "CIDR with port", pattern: "ip:10.0.0.0/8:443", host: "10.1.2.3", port: 443, want: true},
+		{name: "Bare IPv6 literal has no port", pattern: "2001:db8::443", host: "2001:db8::443", port: 80, want: true},
+		{name: "Bracketed IPv6 with port", pattern: "[2001:db8::1]:443", host: "[2001:db8::1]", port: 443, want: true},
+		{name: "Bracketed IPv6 CIDR with port", pattern: "[2001:db8::]/32:443", host: "2001:db8::1", port: 80, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchPatternPort(tt.pattern, tt.host, tt.port); got != tt.want {
+				t.Errorf("MatchPatternPort(%q, %q, %d) = %v, want %v",
+					tt.pattern, tt.host, tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchPatternCache(t *testing.T) {
+	for i := range cacheSize + 10 {
+		host := fmt.Sprintf("h%d.example.com", i)
+		if !MatchPattern(host, host) || MatchPattern(host, "other.example.com") {
+			t.Fatalf("MatchPattern(%q) is wrong", host)
+		}
+		if !MatchPattern(host, host) {
+			t.Fatalf("cached MatchPattern(%q) = false", host)
+		}
+	}
+	cache.Lock()
+	n := len(cache.patterns)
+	cache.Unlock()
+	if n > cacheSize {
+		t.Errorf("cache holds %d patterns, want at most %d", n, cacheSize)
+	}
+
+	for range 2 {
+		if MatchPattern("*.example.com:99999", "www.example.com") {
+			t.Error("invalid pattern matched")
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package pattern
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Pattern grammar
+//
+//	pattern     = ignore any-text                 ; the pattern never matches
+//	            | "re:" regex                     ; the whole rest is one regex
+//	            | term { "^" term } [ "^" ]
+//	ignore      = "#" | "$" | "^"
+//	term        = host [ ":" port [ "-" port ] ]
+//	host        = [ "ip:" ] ( ipv4 | "[" ipv6 "]" | ipv6 ) [ "/" bits ]
+//	            | "/" regex "/"                   ; "\/" escapes a slash
+//	            | glob
+//	glob        = { literal | "*" | "?" | class | alternation }
+//	class       = "[" [ "^" ] { char | char "-" char } "]"
+//	alternation = "{" alt { "," alt } "}"        ; alt is a glob without "{}^:"
+//
+// The first term is the include term; every following term is an exclusion, so
+// "*.yahoo.com^*.media.yahoo.com^*.news.yahoo.com" matches yahoo.com and its
+// subdomains except the media and news subtrees. A single trailing "^" is tolerated
+// for compatibility with older rule files ("*example.com^" == "*example.com").
+//
+// Regexes use Go RE2 syntax, are anchored to the whole host and match
+// case-insensitively. The "re:" form consumes the rest of the pattern, so it cannot
+// carry exclusions or ports; the "/.../" form is a term and can, e.g.
+// "/cdn[0-9]+\.example\.com/^cdn0.example.com". Regexes whose compiled program
+// exceeds a fixed size are rejected.
+//
+// Alternations expand into separate globs before matching: "*.{google,youtube}.com"
+// is "*.google.com" or "*.youtube.com". A "^" inside a class ("[^a]") negates the
+// class and does not start an exclusion.
+//
+// Input the grammar cannot read unambiguously is rejected with a *SyntaxError:
+// empty exclusions ("a^^b"), "^" or nested braces inside an alternation, ports
+// inside an alternation, and unterminated classes or alternations.
+
+// maxAlternatives bounds the expansion of alternations within a single term.
+const maxAlternatives = 256
+
+// SyntaxError describes a pattern that cannot be parsed.
+type SyntaxError struct {
+	Pattern string // pattern after trimming whitespace and quotes
+	Offset  int    // byte offset of the problem within Pattern
+	Msg     string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("pattern %q: %s at offset %d", e.Pattern, e.Msg, e.Offset)
+}
+
+// span is a slice of the pattern text together with its offset.
+type span struct {
+	text   string
+	offset int
+}
+
+// parse parses a trimmed pattern into p.
+func parse(p *Pattern, s string) error {
+	fail := func(offset int, format string, args ...any) error {
+		return &SyntaxError{Pattern: s, Offset: offset, Msg: fmt.Sprintf(format, args...)}
+	}
+
+	if s == "" {
+		return fail(0, "empty pattern")
+	}
+
+	// Comment/Ignore prefixes: #, $, or ^ at the start means ignore this pattern
+	if strings.HasPrefix(s, "#") || strings.HasPrefix(s, "$") || strings.HasPrefix(s, "^") {
+		p.ignored = true
+		return nil
+	}
+
+	if hasRegexPrefix(s) {
+		re, err := compileRegex(s[len(regexPrefix):])
+		if err != nil {
+			return fail(len(regexPrefix), "%v", err)
+		}
+		p.include = term{text: s, atoms: []atom{{re: re}}}
+		return nil
+	}
+
+	s = strings.TrimSuffix(s, ".")
+	terms, err := splitTerms(s, fail)
+	if err != nil {
+		return err
+	}
+
+	for i, sp := range terms {
+		t, err := parseTerm(sp, fail)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			p.include = t
+		} else {
+			p.exclude = append(p.exclude, t)
+		}
+	}
+	return nil
+}
+
+// splitTerms splits a pattern at top-level "^" operators, skipping "^" inside
+// character classes and regex terms and rejecting it inside alternations.
+func splitTerms(s string, fail func(int, string, ...any) error) ([]span, error) {
+	var terms []span
+	start := 0
+	braceStart := -1
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '/':
+			if i != start {
+				continue // CIDR prefix length
+			}
+			end := regexTermEnd(s[i:])
+			if end == -1 {
+				return nil, fail(i, "unterminated regex")
+			}
+			i += end - 1
+		case '[':
+			end := strings.IndexByte(s[i+1:], ']')
+			if end == -1 {
+				return nil, fail(i, "unterminated character class")
+			}
+			i += end + 1
+		case '{':
+			if braceStart != -1 {
+				return nil, fail(i, "nested alternation")
+			}
+			braceStart = i
+		case '}':
+			if braceStart == -1 {
+				return nil, fail(i, "unexpected '}'")
+			}
+			braceStart = -1
+		case ':':
+			if braceStart != -1 {
+				return nil, fail(i, "':' inside alternation")
+			}
+		case '^':
+			if braceStart != -1 {
+				return nil, fail(i, "exclusion inside alternation")
+			}
+			if i == start {
+				return nil, fail(i, "empty exclusion")
+			}
+			terms = append(terms, span{text: s[start:i], offset: start})
+			start = i + 1
+		}
+	}
+	if braceStart != -1 {
+		return nil, fail(braceStart, "unterminated alternation")
+	}
+	if start < len(s) {
+		terms = append(terms, span{text: s[start:], offset: start})
+	}
+	return terms, nil
+}
+
+// parseTerm parses the port suffix and host part of a single term.
+func parseTerm(sp span, fail func(int, string, ...any) error) (term, error) {
+	if strings.HasPrefix(sp.text, "/") {
+		return parseRegexTerm(sp, fail)
+	}
+
+	sp.text = strings.ToLower(sp.text)
+	head, ports, err := splitPort(sp.text)
+	if err != nil {
+		return term{}, fail(sp.offset+strings.LastIndexByte(sp.text, ':')+1, "%v in %q", err, sp.text)
+	}
+	t := term{text: sp.text, ports: ports}
+
+	alts, err := expandAlternation(span{text: head, offset: sp.offset}, fail)
+	if err != nil {
+		return term{}, err
+	}
+
+	for _, alt := range alts {
+		a, err := parseAtom(alt)
+		if err != nil {
+			return term{}, fail(sp.offset, "%v", err)
+		}
+		t.atoms = append(t.atoms, a)
+	}
+	return t, nil
+}
+
+// parseRegexTerm parses a "/regex/" term with an optional port suffix.
+func parseRegexTerm(sp span, fail func(int, string, ...any) error) (term, error) {
+	end := regexTermEnd(sp.text)
+	t := term{text: sp.text}
+	if rest := sp.text[end:]; rest != "" {
+		spec, ok := strings.CutPrefix(rest, ":")
+		if !ok {
+			return term{}, fail(sp.offset+end, "unexpected %q after regex", rest)
+		}
+		ports, err := parsePortRange(spec)
+		if err != nil {
+			return term{}, fail(sp.offset+end+1, "%v in %q", err, sp.text)
+		}
+		t.ports = ports
+	}
+
+	re, err := compileRegex(sp.text[1 : end-1])
+	if err != nil {
+		return term{}, fail(sp.offset+1, "%v", err)
+	}
+	t.atoms = []atom{{re: re}}
+	return t, nil
+}
+
+// parseAtom parses one expanded alternative as an IP term or a glob.
+func parseAtom(s string) (atom, error) {
+	// IP literal or CIDR range (bare or with the "ip:" prefix)
+	prefix, isIP, ok := parseIPTerm(s)
+	if isIP {
+		if !ok {
+			return atom{}, fmt.Errorf("invalid IP address or CIDR %q", s)
+		}
+		return atom{ip: prefix, isIP: true}, nil
+	}
+
+	glob, err := toASCIIGlob(s)
+	if err != nil {
+		return atom{}, err
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return atom{}, fmt.Errorf("invalid glob %q: %w", s, err)
+	}
+	return atom{glob: glob}, nil
+}
+
+// expandAlternation expands every "{a,b}" group of a term into the cartesian
+// product of its alternatives.
+func expandAlternation(sp span, fail func(int, string, ...any) error) ([]string, error) {
+	s := sp.text
+	open := indexUnquoted(s, '{')
+	if open == -1 {
+		return []string{s}, nil
+	}
+	// splitTerms guarantees the group is closed and not nested.
+	end := open + indexUnquoted(s[open:], '}')
+	body := s[open+1 : end]
+	if body == "" {
+		return nil, fail(sp.offset+open, "empty alternation")
+	}
+
+	rest, err := expandAlternation(span{text: s[end+1:], offset: sp.offset + end + 1}, fail)
+	if err != nil {
+		return nil, err
+	}
+	prefix := s[:open]
+	choices := strings.Split(body, ",")
+	if len(choices)*len(rest) > maxAlternatives {
+		return nil, fail(sp.offset+open, "alternation expands to more than %d globs", maxAlternatives)
+	}
+
+	out := make([]string, 0, len(choices)*len(rest))
+	for _, c := range choices {
+		for _, r := range rest {
+			out = append(out, prefix+c+r)
+		}
+	}
+	return out, nil
+}
+
+// indexUnquoted returns the index of the first c in s that is neither escaped
+// nor inside a character class, or -1.
+func indexUnquoted(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			if end := strings.IndexByte(s[i+1:], ']'); end != -1 {
+				i += end + 1
+			}
+		case c:
+			return i
+		}
+	}
+	return -1
+}
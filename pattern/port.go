@@ -0,0 +1,88 @@
+package pattern
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// portRange is an inclusive port range parsed from a ":port" or ":lo-hi" suffix.
+// The zero value means the term applies to every port.
+type portRange struct {
+	lo, hi int
+}
+
+// any reports whether the range places no restriction on the port.
+func (p portRange) any() bool {
+	return p.lo == 0 && p.hi == 0
+}
+
+// contains reports whether port falls in the range.
+// An unknown port (0) only satisfies an unrestricted range.
+func (p portRange) contains(port int) bool {
+	if p.any() {
+		return true
+	}
+	return port >= p.lo && port <= p.hi
+}
+
+var errInvalidPort = errors.New("invalid port")
+
+// splitPort separates an optional ":port" or ":lo-hi" suffix from a pattern term.
+//
+// IPv6 literals are only given a port when bracketed ("[2001:db8::1]:443"), since
+// a bare IPv6 literal already ends in a colon-separated group. The "ip:" prefix is
+// kept on the returned head.
+func splitPort(term string) (string, portRange, error) {
+	body, explicitIP := strings.CutPrefix(term, ipPrefix)
+
+	idx := strings.LastIndex(body, ":")
+	if idx == -1 {
+		return term, portRange{}, nil
+	}
+	head, spec := body[:idx], body[idx+1:]
+	bracketed := strings.HasPrefix(head, "[") && strings.Contains(head, "]")
+	if strings.Contains(head, ":") && !bracketed {
+		// Bare IPv6 literal or CIDR: there is no port.
+		return term, portRange{}, nil
+	}
+
+	ports, err := parsePortRange(spec)
+	if err != nil {
+		return term, portRange{}, err
+	}
+	if explicitIP {
+		head = ipPrefix + head
+	}
+	return head, ports, nil
+}
+
+// parsePortRange parses "443" or "8000-8999".
+func parsePortRange(spec string) (portRange, error) {
+	loStr, hiStr, isRange := strings.Cut(spec, "-")
+	lo, err := parsePort(loStr)
+	if err != nil {
+		return portRange{}, err
+	}
+	hi := lo
+	if isRange {
+		if hi, err = parsePort(hiStr); err != nil {
+			return portRange{}, err
+		}
+	}
+	if lo > hi {
+		return portRange{}, errInvalidPort
+	}
+	return portRange{lo: lo, hi: hi}, nil
+}
+
+func parsePort(s string) (int, error) {
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return 0, errInvalidPort
+	}
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, errInvalidPort
+	}
+	return port, nil
+}
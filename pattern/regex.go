@@ -0,0 +1,64 @@
+package pattern
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// regexPrefix marks a pattern whose remainder is a single regular expression.
+const regexPrefix = "re:"
+
+// Limits for regex patterns. RE2 matching is linear in the input, but large
+// programs still cost memory and time per lookup, so rule files are kept small.
+const (
+	maxRegexLen   = 1024
+	maxRegexInsts = 2000
+)
+
+// compileRegex compiles a host regex anchored to the full host and checks it
+// against the complexity limits. Matching is case-insensitive like globs; hosts
+// are matched in their A-label form, so IDN labels must be written as punycode.
+func compileRegex(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, fmt.Errorf("empty regex")
+	}
+	if len(expr) > maxRegexLen {
+		return nil, fmt.Errorf("regex longer than %d bytes", maxRegexLen)
+	}
+
+	anchored := `^(?i:` + expr + `)$`
+	tree, err := syntax.Parse(anchored, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %w", expr, err)
+	}
+	prog, err := syntax.Compile(tree.Simplify())
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %w", expr, err)
+	}
+	if len(prog.Inst) > maxRegexInsts {
+		return nil, fmt.Errorf("regex %q too complex (%d instructions, limit %d)", expr, len(prog.Inst), maxRegexInsts)
+	}
+
+	return regexp.Compile(anchored)
+}
+
+// regexTermEnd returns the index just past the closing "/" of a regex term that
+// starts at s[0], or -1 if the term is unterminated. "\/" escapes a slash.
+func regexTermEnd(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '/':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// hasRegexPrefix reports whether s starts with the case-insensitive "re:" prefix.
+func hasRegexPrefix(s string) bool {
+	return len(s) >= len(regexPrefix) && strings.EqualFold(s[:len(regexPrefix)], regexPrefix)
+}
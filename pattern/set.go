@@ -0,0 +1,164 @@
+package pattern
+
+import (
+	"strings"
+)
+
+// Set is an ordered list of compiled patterns that finds the first pattern
+// matching a host. Patterns are indexed in a trie of reversed labels by the
+// literal labels their include globs end with ("*.example.com" under "com",
+// then "example"), so a lookup only evaluates the patterns along the host's own
+// labels plus the unindexed ones: regexes, IP ranges and globs with a wildcard
+// in the last label. Set is immutable and safe for concurrent use.
+type Set struct {
+	patterns  []*Pattern
+	root      labelNode
+	unindexed []int
+}
+
+// labelNode is a trie node for one label of a literal suffix.
+type labelNode struct {
+	children map[string]*labelNode
+	// patterns are the ascending indexes of the patterns with a glob whose
+	// literal suffix ends at this node.
+	patterns []int
+}
+
+// NewSet builds a Set. Priority follows slice order: the earliest matching
+// pattern wins. Nil and ignored patterns never match.
+func NewSet(patterns []*Pattern) *Set {
+	s := &Set{patterns: patterns}
+	for i, p := range patterns {
+		if p == nil || p.ignored {
+			continue
+		}
+		suffixes, ok := p.indexSuffixes()
+		if !ok {
+			s.unindexed = append(s.unindexed, i)
+			continue
+		}
+		for _, labels := range suffixes {
+			n := &s.root
+			for _, label := range labels {
+				child := n.children[label]
+				if child == nil {
+					if n.children == nil {
+						n.children = make(map[string]*labelNode)
+					}
+					child = &labelNode{}
+					n.children[label] = child
+				}
+				n = child
+			}
+			// Alternatives of one pattern can share a suffix.
+			if len(n.patterns) == 0 || n.patterns[len(n.patterns)-1] != i {
+				n.patterns = append(n.patterns, i)
+			}
+		}
+	}
+	return s
+}
+
+// Len returns the number of patterns in the set, including ones that never match.
+func (s *Set) Len() int {
+	return len(s.patterns)
+}
+
+// Pattern returns the i-th pattern of the set.
+func (s *Set) Pattern(i int) *Pattern {
+	return s.patterns[i]
+}
+
+// Match returns the index of the first pattern matching host and port.
+// A port of 0 means unknown, as in Pattern.MatchPort.
+func (s *Set) Match(host string, port int) (int, bool) {
+	return s.MatchFunc(host, port, nil)
+}
+
+// MatchFunc is like Match but skips matching patterns for which accept returns
+// false, e.g. rules that are switched off. A nil accept accepts every pattern.
+func (s *Set) MatchFunc(host string, port int, accept func(i int) bool) (int, bool) {
+	host = NormalizeHost(host)
+	if host == "" {
+		return -1, false
+	}
+
+	// The candidate lists are those of the nodes along the host's labels,
+	// last label first, and the unindexed patterns; each is ascending.
+	var buf [8][]int
+	lists := append(buf[:0], s.unindexed)
+	n, rest := &s.root, host
+	for n.children != nil {
+		i := strings.LastIndexByte(rest, '.')
+		if n = n.children[rest[i+1:]]; n == nil {
+			break
+		}
+		if len(n.patterns) > 0 {
+			lists = append(lists, n.patterns)
+		}
+		if i < 0 {
+			break
+		}
+		rest = rest[:i]
+	}
+
+	// Merge the lists so priority order is preserved.
+	last := -1
+	for {
+		next := -1
+		for j, l := range lists {
+			if len(l) > 0 && (next < 0 || l[0] < lists[next][0]) {
+				next = j
+			}
+		}
+		if next < 0 {
+			return -1, false
+		}
+		i := lists[next][0]
+		lists[next] = lists[next][1:]
+		if i == last {
+			continue
+		}
+		last = i
+		if s.patterns[i].matchNormalized(host, port) && (accept == nil || accept(i)) {
+			return i, true
+		}
+	}
+}
+
+// indexSuffixes returns, for each glob of the include term, the literal labels
+// every host it matches must end with, last label first. It returns false if
+// the term has a regex or IP atom or a glob without a literal last label.
+func (p *Pattern) indexSuffixes() ([][]string, bool) {
+	suffixes := make([][]string, 0, len(p.include.atoms))
+	for _, a := range p.include.atoms {
+		if a.isIP || a.re != nil {
+			return nil, false
+		}
+		labels := literalSuffix(a.glob)
+		if len(labels) == 0 {
+			return nil, false
+		}
+		suffixes = append(suffixes, labels)
+	}
+	return suffixes, len(suffixes) > 0
+}
+
+// literalSuffix returns the labels of glob after its last wildcard label,
+// last label first.
+func literalSuffix(glob string) []string {
+	var labels []string
+	for rest := glob; ; {
+		i := strings.LastIndexByte(rest, '.')
+		label := rest[i+1:]
+		if label == "" || strings.ContainsAny(label, globMeta) {
+			break
+		}
+		labels = append(labels, label)
+		if i < 0 {
+			break
+		}
+		rest = rest[:i]
+	}
+	return labels
+}
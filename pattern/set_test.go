@@ -0,0 +1,149 @@
+package pattern
+
+import (
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	sources := []string{
+		"#*google*",
+		"gemini.google.com",
+		`re:r[0-9]+---sn-[a-z0-9]+\.googlevideo\.com`,
+		"*.googlevideo.com",
+		"*google.com",
+		"ip:203.0.113.0/24",
+		"example*",
+		"*.{youtube,ytimg}.com",
+		"*.com^*.yahoo.com",
+	}
+	patterns := make([]*Pattern, len(sources))
+	for i, s := range sources {
+		patterns[i] = MustCompile(s)
+	}
+	set := NewSet(patterns)
+
+	tests := []struct {
+		host string
+		want int
+	}{
+		{host: "gemini.google.com", want: 1},
+		{host: "www.google.com", want: 4},
+		{host: "r3---sn-a5mekn7s.googlevideo.com", want: 2},
+		{host: "redirector.googlevideo.com", want: 3},
+		{host: "203.0.113.9", want: 5},
+		{host: "example.org", want: 6},
+		{host: "i.ytimg.com", want: 7},
+		{host: "www.github.com", want: 8},
+		{host: "www.yahoo.com", want: -1},
+		{host: "example.net.cn", want: 6},
+		{host: "localhost", want: -1},
+	}
+
+	for _, tt := range tests {
+		got, ok := set.Match(tt.host, 0)
+		if !ok {
+			got = -1
+		}
+		if got != tt.want {
+			t.Errorf("Set.Match(%q) = %d, want %d", tt.host, got, tt.want)
+		}
+
+		// The index must agree with a linear scan in priority order.
+		linear := -1
+		for i, p := range patterns {
+			if p.Match(tt.host) {
+				linear = i
+				break
+			}
+		}
+		if got != linear {
+			t.Errorf("Set.Match(%q) = %d, linear scan = %d", tt.host, got, linear)
+		}
+	}
+}
+
+func TestSetMatchFunc(t *testing.T) {
+	set := NewSet([]*Pattern{
+		MustCompile("gemini.google.com"),
+		MustCompile("*.google.com"),
+		MustCompile("*google.com"),
+	})
+	skip := func(skipped ...int) func(int) bool {
+		return func(i int) bool {
+			for _, s := range skipped {
+				if i == s {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	tests := []struct {
+		accept func(int) bool
+		want   int
+	}{
+		{accept: nil, want: 0},
+		{accept: skip(0), want: 1},
+		{accept: skip(0, 1), want: 2},
+		{accept: skip(0, 1, 2), want: -1},
+	}
+	for _, tt := range tests {
+		got, ok := set.MatchFunc("gemini.google.com", 0, tt.accept)
+		if !ok {
+			got = -1
+		}
+		if got != tt.want {
+			t.Errorf("Set.MatchFunc() = %d, want %d", got, tt.want)
+		}
+	}
+}
+
+func TestSetIndex(t *testing.T) {
+	sources := []string{
+		"www.example.com",
+		"*.example.com",
+		"a*.example.com",
+		"*.{example,example2}.{com,org}",
+		"mail.*.example.org",
+		"*example.org",
+		"*.co.uk",
+		"bbc.co.uk",
+		"*.b*.co.uk",
+		"example.*",
+		"re:^[a-z]+\\.example\\.net$",
+		"*.example.com^www.example.com",
+		"*.example.net:8443",
+	}
+	patterns := make([]*Pattern, len(sources))
+	for i, s := range sources {
+		patterns[i] = MustCompile(s)
+	}
+	set := NewSet(patterns)
+
+	hosts := []string{
+		"www.example.com", "example.com", "api.example.com", "abc.example.com",
+		"x.example2.org", "example2.com", "mail.x.example.org", "myexample.org",
+		"example.org", "bbc.co.uk", "www.bbc.co.uk", "news.bar.co.uk", "co.uk",
+		"example.jp", "www.example.net", "a.b.example.net", "com", "uk",
+		"WWW.Example.COM.", "localhost",
+	}
+	for _, host := range hosts {
+		for _, port := range []int{0, 443, 8443} {
+			got, ok := set.Match(host, port)
+			if !ok {
+				got = -1
+			}
+			linear := -1
+			for i, p := range patterns {
+				if p.MatchPort(host, port) {
+					linear = i
+					break
+				}
+			}
+			if got != linear {
+				t.Errorf("Set.Match(%q, %d) = %d, linear scan = %d", host, port, got, linear)
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package pattern
+
+import (
+	"cmp"
+	"regexp/syntax"
+	"strings"
+)
+
+// Tier is the coarse class of a pattern's include term, from least to most specific.
+type Tier int
+
+const (
+	TierNever  Tier = iota // ignored patterns, which never match
+	TierGlob               // infix globs (*pixiv.net, a*b) and regexes
+	TierSuffix             // *.example.com and CIDR ranges
+	TierExact              // literal hosts and single IP addresses
+)
+
+// Specificity summarizes how narrowly a pattern matches. Fields are compared in
+// declaration order, see CompareSpecificity.
+type Specificity struct {
+	Tier       Tier
+	Labels     int  // literal labels in the include term, e.g. 2 for *.example.com
+	Literals   int  // literal bytes in the include term, or prefix bits for IP ranges
+	Port       bool // the include term is port-restricted
+	Exclusions int  // number of exclusion terms
+}
+
+// Specificity returns the specificity of the pattern. For alternations the
+// least specific alternative counts, so "{www,*}.example.com" ranks as a suffix.
+func (p *Pattern) Specificity() Specificity {
+	if p == nil || p.ignored {
+		return Specificity{}
+	}
+
+	s := Specificity{
+		Tier:       TierExact,
+		Port:       !p.include.ports.any(),
+		Exclusions: len(p.exclude),
+	}
+	for i, a := range p.include.atoms {
+		as := a.specificity()
+		if i == 0 || CompareSpecificity(as, s) > 0 {
+			s.Tier, s.Labels, s.Literals = as.Tier, as.Labels, as.Literals
+		}
+	}
+	return s
+}
+
+// CompareSpecificity returns a negative number if a is more specific than b,
+// a positive number if it is less specific, and zero if they rank equally,
+// so sorting with it puts the most specific patterns first.
+func CompareSpecificity(a, b Specificity) int {
+	if c := cmp.Compare(b.Tier, a.Tier); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(b.Labels, a.Labels); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(b.Literals, a.Literals); c != 0 {
+		return c
+	}
+	if a.Port != b.Port {
+		if a.Port {
+			return -1
+		}
+		return 1
+	}
+	return cmp.Compare(b.Exclusions, a.Exclusions)
+}
+
+// Compare orders two patterns by specificity, most specific first, breaking
+// ties by source text so the order is deterministic. It computes both
+// specificities on every call; when sorting many patterns, compute each
+// Specificity once and compare with CompareSpecificity.
+func Compare(a, b *Pattern) int {
+	if c := CompareSpecificity(a.Specificity(), b.Specificity()); c != 0 {
+		return c
+	}
+	return strings.Compare(a.String(), b.String())
+}
+
+// specificity ranks a single atom; only Tier, Labels and Literals are set.
+func (a atom) specificity() Specificity {
+	switch {
+	case a.isIP:
+		if a.ip.IsSingleIP() {
+			return Specificity{Tier: TierExact, Literals: a.ip.Bits()}
+		}
+		return Specificity{Tier: TierSuffix, Literals: a.ip.Bits()}
+	case a.re != nil:
+		return regexSpecificity(a.re.String())
+	}
+
+	s := Specificity{Tier: TierGlob}
+	if !strings.ContainsAny(a.glob, globMeta) {
+		s.Tier = TierExact
+	} else if rest, ok := strings.CutPrefix(a.glob, "*."); ok && !strings.ContainsAny(rest, globMeta) {
+		s.Tier = TierSuffix
+	}
+	for _, label := range strings.Split(a.glob, ".") {
+		if label != "" && !strings.ContainsAny(label, globMeta) {
+			s.Labels++
+		}
+	}
+	s.Literals = len(a.glob) - strings.Count(a.glob, "*") - strings.Count(a.glob, "?")
+	return s
+}
+
+// regexSpecificity ranks a regex by its literal text: complete labels are
+// counted in the literal suffix, e.g. 2 for `cdn[0-9]+\.example\.com`.
+func regexSpecificity(expr string) Specificity {
+	s := Specificity{Tier: TierGlob}
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return s
+	}
+	re = re.Simplify()
+	s.Literals = regexLiterals(re)
+
+	suffix := regexLiteralSuffix(re)
+	if i := strings.IndexByte(suffix, '.'); i != -1 {
+		for _, label := range strings.Split(suffix[i+1:], ".") {
+			if label != "" {
+				s.Labels++
+			}
+		}
+	}
+	return s
+}
+
+// regexLiterals counts the runes every match must contain literally.
+func regexLiterals(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return len(re.Rune)
+	case syntax.OpCapture, syntax.OpPlus:
+		return regexLiterals(re.Sub[0])
+	case syntax.OpConcat:
+		n := 0
+		for _, sub := range re.Sub {
+			n += regexLiterals(sub)
+		}
+		return n
+	}
+	return 0
+}
+
+// regexLiteralSuffix returns the literal text at the end of every match,
+// ignoring anchors.
+func regexLiteralSuffix(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return string(re.Rune)
+	case syntax.OpCapture:
+		return regexLiteralSuffix(re.Sub[0])
+	case syntax.OpConcat:
+		var suffix string
+	loop:
+		for i := len(re.Sub) - 1; i >= 0; i-- {
+			sub := re.Sub[i]
+			switch sub.Op {
+			case syntax.OpBeginText, syntax.OpEndText, syntax.OpBeginLine, syntax.OpEndLine:
+				continue
+			case syntax.OpLiteral:
+				suffix = string(sub.Rune) + suffix
+				continue
+			case syntax.OpCapture:
+				suffix = regexLiteralSuffix(sub) + suffix
+			}
+			break loop
+		}
+		return suffix
+	}
+	return ""
+}
+
+// Scopes returns, for each wildcard or regex alternative of the include term, the
+// literal host suffix every match ends with, without a leading dot: "example.com"
+// for "*.example.com", "co.uk" for "*co.uk" and "" for "*". Literal hosts and IP
+// terms are omitted, as are ignored patterns.
+func (p *Pattern) Scopes() []string {
+	if p == nil || p.ignored {
+		return nil
+	}
+	var scopes []string
+	for _, a := range p.include.atoms {
+		switch {
+		case a.isIP:
+			continue
+		case a.re != nil:
+			re, err := syntax.Parse(a.re.String(), syntax.Perl)
+			if err != nil {
+				continue
+			}
+			suffix := strings.ToLower(regexLiteralSuffix(re.Simplify()))
+			scopes = append(scopes, strings.TrimPrefix(suffix, "."))
+		case strings.ContainsAny(a.glob, globMeta):
+			suffix := a.glob[strings.LastIndexAny(a.glob, globMeta)+1:]
+			scopes = append(scopes, strings.TrimPrefix(suffix, "."))
+		}
+	}
+	return scopes
+}
@@ -0,0 +1,85 @@
+package pattern
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompareOrder(t *testing.T) {
+	// Expected order, most specific first.
+	want := []string{
+		"gemini.google.com",
+		"203.0.113.7",
+		"*.mail.google.com:443",
+		"*.mail.google.com",
+		"*.google.com^*.mail.google.com",
+		"*.google.com",
+		"203.0.113.0/24",
+		"10.0.0.0/8",
+		"disney.*.edge.bamgrid.com",
+		`re:r[0-9]+\.googlevideo\.com`,
+		"*google.com",
+		"*pixiv.net",
+		"*.google.*",
+		"*a*b*c*",
+		"#*google*",
+	}
+
+	got := make([]*Pattern, len(want))
+	for i, s := range want {
+		got[len(want)-1-i] = MustCompile(s)
+	}
+	slices.SortFunc(got, Compare)
+
+	for i, p := range got {
+		if p.String() != want[i] {
+			t.Errorf("position %d = %q, want %q", i, p.String(), want[i])
+		}
+	}
+}
+
+func TestSpecificity(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    Specificity
+	}{
+		{pattern: "i.pximg.net", want: Specificity{Tier: TierExact, Labels: 3, Literals: 11}},
+		{pattern: "*.pixiv.net", want: Specificity{Tier: TierSuffix, Labels: 2, Literals: 10}},
+		{pattern: "*pixiv.net", want: Specificity{Tier: TierGlob, Labels: 1, Literals: 9}},
+		{pattern: "$*pixiv.net", want: Specificity{}},
+		{pattern: "*.{pixiv,pximg}.net", want: Specificity{Tier: TierSuffix, Labels: 2, Literals: 10}},
+		{pattern: "{i.pximg,*.pixiv}.net", want: Specificity{Tier: TierSuffix, Labels: 2, Literals: 10}},
+		{pattern: "example.com:443^www.example.com", want: Specificity{Tier: TierExact, Labels: 2, Literals: 11, Port: true, Exclusions: 1}},
+		{pattern: `re:cdn[0-9]+\.example\.com`, want: Specificity{Tier: TierGlob, Labels: 2, Literals: 15}},
+		{pattern: "ip:2001:db8::/32", want: Specificity{Tier: TierSuffix, Literals: 32}},
+	}
+
+	for _, tt := range tests {
+		if got := MustCompile(tt.pattern).Specificity(); got != tt.want {
+			t.Errorf("Specificity(%q) = %+v, want %+v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestScopes(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*.example.com", []string{"example.com"}},
+		{"*co.uk", []string{"co.uk"}},
+		{"a*.com^www.com", []string{"com"}},
+		{"*.{google,youtube}.com", []string{"google.com", "youtube.com"}},
+		{"{www,*}.example.com", []string{"example.com"}},
+		{`/cdn[0-9]+\.Example\.com/`, []string{"example.com"}},
+		{"*", []string{""}},
+		{"example.com", nil},
+		{"10.0.0.0/8", nil},
+		{"#*.example.com", nil},
+	}
+	for _, tt := range tests {
+		if got := MustCompile(tt.pattern).Scopes(); !slices.Equal(got, tt.want) {
+			t.Errorf("Scopes(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package pattern
+
+import (
+	"strings"
+)
+
+// Subsumes reports whether pattern a matches every host (and port) that pattern b
+// matches. The answer is conservative: true is always correct, while false may
+// also mean "could not prove it", e.g. for regexes that are not identical.
+// Invalid patterns subsume nothing.
+func Subsumes(a, b string) bool {
+	pa, err := Compile(a)
+	if err != nil {
+		return false
+	}
+	pb, err := Compile(b)
+	if err != nil {
+		return false
+	}
+	return pa.Subsumes(pb)
+}
+
+// Equivalent reports whether a and b match exactly the same hosts, under the
+// same conservative rules as Subsumes.
+func Equivalent(a, b string) bool {
+	return Subsumes(a, b) && Subsumes(b, a)
+}
+
+// Disjoint reports whether no host can match both a and b. Like Subsumes it is
+// conservative: false may mean "could not prove it".
+func Disjoint(a, b string) bool {
+	pa, err := Compile(a)
+	if err != nil {
+		return true
+	}
+	pb, err := Compile(b)
+	if err != nil {
+		return true
+	}
+	return pa.Disjoint(pb)
+}
+
+// Subsumes reports whether p matches every host that q matches. See Subsumes.
+func (p *Pattern) Subsumes(q *Pattern) bool {
+	if q.ignored {
+		return true // q matches nothing
+	}
+	if p.ignored || !p.include.subsumes(q.include) {
+		return false
+	}
+
+	// Every host p excludes must also be outside q: either q excludes it as
+	// well, or it never matches q's include term.
+	for _, e := range p.exclude {
+		covered := e.disjoint(q.include)
+		for _, f := range q.exclude {
+			if covered {
+				break
+			}
+			covered = f.subsumes(e)
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// Equivalent reports whether p and q match the same hosts. See Equivalent.
+func (p *Pattern) Equivalent(q *Pattern) bool {
+	return p.Subsumes(q) && q.Subsumes(p)
+}
+
+// Disjoint reports whether no host matches both p and q. See Disjoint.
+func (p *Pattern) Disjoint(q *Pattern) bool {
+	if p.ignored || q.ignored {
+		return true
+	}
+	if p.include.disjoint(q.include) {
+		return true
+	}
+	// An exclusion of either side covering the other side's include term
+	// leaves nothing in common.
+	for _, e := range p.exclude {
+		if e.subsumes(q.include) {
+			return true
+		}
+	}
+	for _, e := range q.exclude {
+		if e.subsumes(p.include) {
+			return true
+		}
+	}
+	return false
+}
+
+// subsumes reports whether t matches every (host, port) that u matches.
+func (t term) subsumes(u term) bool {
+	if !t.ports.any() && (u.ports.any() || u.ports.lo < t.ports.lo || u.ports.hi > t.ports.hi) {
+		return false
+	}
+	for _, b := range u.atoms {
+		covered := false
+		for _, a := range t.atoms {
+			if a.subsumes(b) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// disjoint reports whether no (host, port) matches both t and u.
+func (t term) disjoint(u term) bool {
+	if !t.ports.any() && !u.ports.any() && (t.ports.hi < u.ports.lo || u.ports.hi < t.ports.lo) {
+		return true
+	}
+	for _, a := range t.atoms {
+		for _, b := range u.atoms {
+			if !a.disjoint(b) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// subsumes reports whether atom a matches every host that atom b matches.
+func (a atom) subsumes(b atom) bool {
+	// A literal host or single address is decided by matching it.
+	if host, ok := b.literal(); ok {
+		return a.match(host)
+	}
+
+	switch {
+	case a.isIP && b.isIP:
+		return a.ip.Addr().BitLen() == b.ip.Addr().BitLen() &&
+			a.ip.Bits() <= b.ip.Bits() && a.ip.Contains(b.ip.Addr())
+	case a.re != nil || b.re != nil:
+		return a.re != nil && b.re != nil && a.re.String() == b.re.String()
+	case a.isIP || b.isIP:
+		return false
+	}
+
+	if a.glob == b.glob {
+		return true
+	}
+	// "*.example.com" also matches "example.com" itself, and every glob matches
+	// its own text.
+	if root, ok := strings.CutPrefix(b.glob, "*."); ok && !a.match(root) {
+		return false
+	}
+	if !a.match(b.glob) {
+		return false
+	}
+	return globContains(tokenizeGlob(a.glob), tokenizeGlob(b.glob))
+}
+
+// disjoint reports whether no host matches both atoms.
+func (a atom) disjoint(b atom) bool {
+	if host, ok := a.literal(); ok {
+		return !b.match(host)
+	}
+	if host, ok := b.literal(); ok {
+		return !a.match(host)
+	}
+
+	switch {
+	case a.isIP && b.isIP:
+		return !a.ip.Overlaps(b.ip)
+	case a.isIP:
+		return !b.mayMatchIP()
+	case b.isIP:
+		return !a.mayMatchIP()
+	case a.re != nil || b.re != nil:
+		return false
+	}
+
+	// Compare the literal prefixes and suffixes of both globs, including the
+	// bare root matched by the "*." form and the glob text itself.
+	if a.match(b.glob) || b.match(a.glob) {
+		return false
+	}
+	for _, x := range a.globForms() {
+		for _, y := range b.globForms() {
+			if !globsDisjoint(x, y) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// literal returns the single host an atom matches, if it matches only one.
+func (a atom) literal() (string, bool) {
+	switch {
+	case a.isIP:
+		if a.ip.IsSingleIP() {
+			return a.ip.Addr().String(), true
+		}
+		return "", false
+	case a.re != nil:
+		return "", false
+	}
+	if strings.ContainsAny(a.glob, globMeta) {
+		return "", false
+	}
+	return a.glob, true
+}
+
+// mayMatchIP reports whether a glob or regex atom could match an IP literal.
+// A glob with a literal byte that never occurs in IP literals cannot.
+func (a atom) mayMatchIP() bool {
+	if a.re != nil {
+		return true
+	}
+	for _, tok := range tokenizeGlob(a.glob) {
+		if tok.kind == tokLiteral && !strings.ContainsRune("0123456789abcdef.:", rune(tok.b)) {
+			return false
+		}
+	}
+	return true
+}
+
+// globForms returns the path.Match globs equivalent to a glob atom, expanding
+// "*.example.com" to itself plus "example.com".
+func (a atom) globForms() []string {
+	if root, ok := strings.CutPrefix(a.glob, "*."); ok {
+		return []string{a.glob, root}
+	}
+	return []string{a.glob}
+}
+
+// globsDisjoint reports whether two path.Match globs cannot match the same
+// host because their literal prefixes or suffixes conflict.
+func globsDisjoint(x, y string) bool {
+	tx, ty := tokenizeGlob(x), tokenizeGlob(y)
+
+	for i := 0; i < len(tx) && i < len(ty); i++ {
+		if tx[i].kind == tokStar || ty[i].kind == tokStar {
+			break
+		}
+		if tokensDisjoint(tx[i], ty[i]) {
+			return true
+		}
+	}
+	for i, j := len(tx)-1, len(ty)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if tx[i].kind == tokStar || ty[j].kind == tokStar {
+			break
+		}
+		if tokensDisjoint(tx[i], ty[j]) {
+			return true
+		}
+	}
+
+	// Without stars, globs of different lengths never match the same host.
+	if !hasStar(tx) && !hasStar(ty) && len(tx) != len(ty) {
+		return true
+	}
+	return false
+}
+
+// tokensDisjoint reports whether two single-character tokens share no byte.
+func tokensDisjoint(x, y globToken) bool {
+	for c := 0; c < 256; c++ {
+		if x.accepts(byte(c)) && y.accepts(byte(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasStar(tokens []globToken) bool {
+	for _, t := range tokens {
+		if t.kind == tokStar {
+			return true
+		}
+	}
+	return false
+}
+
+// globToken is one element of a path.Match glob.
+type globToken struct {
+	kind  int
+	b     byte   // tokLiteral
+	class string // tokClass: body between the brackets
+}
+
+const (
+	tokLiteral = iota
+	tokAny     // ?
+	tokStar    // *
+	tokClass   // [...]
+)
+
+// accepts reports whether a single-character token matches byte c.
+func (t globToken) accepts(c byte) bool {
+	switch t.kind {
+	case tokLiteral:
+		return t.b == c
+	case tokAny, tokStar:
+		return c != '/'
+	case tokClass:
+		return classAccepts(t.class, c)
+	}
+	return false
+}
+
+// tokenizeGlob splits a valid glob into tokens.
+func tokenizeGlob(glob string) []globToken {
+	var tokens []globToken
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			tokens = append(tokens, globToken{kind: tokStar})
+		case '?':
+			tokens = append(tokens, globToken{kind: tokAny})
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+			}
+			tokens = append(tokens, globToken{kind: tokLiteral, b: glob[i]})
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end == -1 {
+				end = len(glob) - i - 1
+			}
+			tokens = append(tokens, globToken{kind: tokClass, class: glob[i+1 : i+1+end]})
+			i += end + 1
+		default:
+			tokens = append(tokens, globToken{kind: tokLiteral, b: c})
+		}
+	}
+	return tokens
+}
+
+// classAccepts evaluates a path.Match character class body such as "^0-9" for byte c.
+func classAccepts(body string, c byte) bool {
+	negated := false
+	if strings.HasPrefix(body, "^") {
+		negated, body = true, body[1:]
+	}
+	matched := false
+	for i := 0; i < len(body); i++ {
+		lo := body[i]
+		if lo == '\\' && i+1 < len(body) {
+			i++
+			lo = body[i]
+		}
+		hi := lo
+		if i+2 < len(body) && body[i+1] == '-' {
+			hi = body[i+2]
+			if hi == '\\' && i+3 < len(body) {
+				hi = body[i+3]
+				i++
+			}
+			i += 2
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+	}
+	return matched != negated
+}
+
+// globContains reports whether every string matched by glob y is matched by
+// glob x. y's "*" can only be absorbed by a "*" in x, which makes the check
+// sound; it is exact for the globs used in rule files.
+func globContains(x, y []globToken) bool {
+	memo := make(map[[2]int]bool)
+	var covers func(i, j int) bool
+	covers = func(i, j int) bool {
+		key := [2]int{i, j}
+		if v, ok := memo[key]; ok {
+			return v
+		}
+		var result bool
+		switch {
+		case i == len(x):
+			result = j == len(y)
+		case x[i].kind == tokStar:
+			result = covers(i+1, j) || (j < len(y) && covers(i, j+1))
+		case j == len(y) || y[j].kind == tokStar:
+			result = false
+		default:
+			result = tokenCovers(x[i], y[j]) && covers(i+1, j+1)
+		}
+		memo[key] = result
+		return result
+	}
+	return covers(0, 0)
+}
+
+// tokenCovers reports whether single-character token x accepts every byte y accepts.
+func tokenCovers(x, y globToken) bool {
+	for c := 0; c < 256; c++ {
+		if y.accepts(byte(c)) && !x.accepts(byte(c)) {
+			return false
+		}
+	}
+	return true
+}
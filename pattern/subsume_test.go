@@ -0,0 +1,130 @@
+package pattern
+
+import "testing"
+
+func TestSubsumes(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "example.com", true},
+		{"*.example.com", "*.cdn.example.com", true},
+		{"*.example.com", "a*.example.com", true},
+		{"*example.com", "*.example.com", true},
+		{"*.example.com", "*example.com", false},
+		{"*.cdn.example.com", "*.example.com", false},
+		{"*", "*.example.com", true},
+		{"*.example.com", "*.example.org", false},
+		{"a?c.example.com", "abc.example.com", true},
+		{"a?c.example.com", "a[bc]c.example.com", false}, // the glob also matches its own text
+		{"a[a-z]c.example.com", "abc.example.com", true},
+
+		// Alternation: every alternative of b needs a covering alternative of a
+		{"*.{google,youtube}.com", "www.google.com", true},
+		{"*.{google,youtube}.com", "*.{youtube,google}.com", true},
+		{"*.google.com", "*.{google,youtube}.com", false},
+
+		// Exclusions
+		{"*.example.com", "*.example.com^www.example.com", true},
+		{"*.example.com^www.example.com", "*.example.com", false},
+		{"*.example.com^www.example.com", "*.example.com^*.www.example.com", true},
+		{"*.example.com^www.example.com", "api.example.com", true},
+		{"*.example.com^www.example.com", "www.example.com", false},
+		{"*.example.com^*.example.org", "*.cdn.example.com", true},
+
+		// IPs and ports
+		{"10.0.0.0/8", "10.1.0.0/16", true},
+		{"10.1.0.0/16", "10.0.0.0/8", false},
+		{"10.0.0.0/8", "10.1.2.3", true},
+		{"*.example.com", "*.example.com:443", true},
+		{"*.example.com:443", "*.example.com", false},
+		{"*.example.com:1-1024", "www.example.com:443", true},
+		{"*.example.com:443", "www.example.com:80", false},
+
+		// Regexes are only compared by their source
+		{`/cdn[0-9]+\.example\.com/`, `/cdn[0-9]+\.example\.com/`, true},
+		{`/cdn[0-9]+\.example\.com/`, "cdn1.example.com", true},
+		{"*.example.com", `/cdn[0-9]+\.example\.com/`, false},
+
+		// Ignored and invalid patterns
+		{"*.example.com", "#*.example.org", true},
+		{"#*", "example.com", false},
+		{"*.xn--zz.com", "*.xn--zz.com", false},
+	}
+	for _, tt := range tests {
+		if got := Subsumes(tt.a, tt.b); got != tt.want {
+			t.Errorf("Subsumes(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestEquivalent(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"*.example.com", "*.EXAMPLE.com.", true},
+		{"*.{a,b}.com", "*.{b,a}.com", true},
+		{"*.例え.jp", "*.xn--r8jz45g.jp", true},
+		{"10.0.0.1", "10.0.0.1/32", true},
+		{"*.example.com", "*example.com", false},
+		{"*.example.com^www.example.com", "*.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := Equivalent(tt.a, tt.b); got != tt.want {
+			t.Errorf("Equivalent(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDisjoint(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"*.example.com", "*.example.org", true},
+		{"*.example.com", "www.example.com", false},
+		{"*.example.com", "example.com", false},
+		{"www.*", "api.*", true},
+		{"www.*", "*.com", false},
+		{"10.0.0.0/8", "192.168.0.0/16", true},
+		{"10.0.0.0/8", "*.example.com", true},
+		{"10.0.0.0/8", "*", false},
+		{"*.example.com:443", "*.example.com:80", true},
+		{"*.example.com^www.example.com", "www.example.com", true},
+		{`/cdn[0-9]+\.example\.com/`, "*.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := Disjoint(tt.a, tt.b); got != tt.want {
+			t.Errorf("Disjoint(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := Disjoint(tt.b, tt.a); got != tt.want {
+			t.Errorf("Disjoint(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+// TestSubsumesSound checks proven answers against the sample hosts of each pattern.
+func TestSubsumesSound(t *testing.T) {
+	patterns := []string{
+		"*.example.com", "*example.com", "www.example.com", "example.com", "a*.example.com",
+		"*.example.com^www.example.com", "*.{www,api}.example.com", "ww?.example.com",
+		"*.example.com:443", "10.0.0.0/8", "10.1.2.3", "*", "*.com", "*.org",
+	}
+	for _, a := range patterns {
+		pa := MustCompile(a)
+		for _, b := range patterns {
+			pb := MustCompile(b)
+			lo, _ := pb.Ports()
+			for _, host := range pb.Examples() {
+				if pa.Subsumes(pb) && !pa.MatchPort(host, lo) {
+					t.Errorf("Subsumes(%q, %q) but %q does not match %s", a, b, a, host)
+				}
+				if pa.Disjoint(pb) && pa.MatchPort(host, lo) {
+					t.Errorf("Disjoint(%q, %q) but both match %s", a, b, host)
+				}
+			}
+		}
+	}
+}
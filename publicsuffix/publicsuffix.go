@@ -0,0 +1,200 @@
+// Package publicsuffix answers Public Suffix List questions such as "is co.uk a
+// public suffix" and "which site does www.example.co.uk belong to".
+//
+// A snapshot of the list is embedded; Parse and SetDefault replace it with a
+// newer copy from https://publicsuffix.org/list/public_suffix_list.dat.
+package publicsuffix
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/idna"
+)
+
+//go:embed public_suffix_list.dat
+var embeddedList string
+
+// List is a parsed Public Suffix List. It is safe for concurrent use.
+type List struct {
+	rules map[string]rule
+}
+
+// rule is one list entry, keyed by its A-label suffix without "*." or "!".
+type rule struct {
+	normal    bool // "co.uk"
+	wildcard  bool // "*.ck": every direct child is a public suffix
+	exception bool // "!www.ck": not a public suffix despite a wildcard
+	icann     bool // listed in the ICANN section rather than the private one
+}
+
+var (
+	defaultList atomic.Pointer[List]
+	loadOnce    sync.Once
+)
+
+// Default returns the list set with SetDefault, or the embedded snapshot.
+func Default() *List {
+	loadOnce.Do(func() {
+		if defaultList.Load() != nil {
+			return
+		}
+		l, err := Parse(strings.NewReader(embeddedList))
+		if err != nil {
+			panic(fmt.Sprintf("publicsuffix: embedded list: %v", err))
+		}
+		defaultList.CompareAndSwap(nil, l)
+	})
+	return defaultList.Load()
+}
+
+// SetDefault replaces the list used by the package-level functions.
+func SetDefault(l *List) {
+	defaultList.Store(l)
+}
+
+// Parse reads a list in the publicsuffix.org format. Internationalized entries
+// are stored as A-labels.
+func Parse(r io.Reader) (*List, error) {
+	l := &List{rules: make(map[string]rule)}
+	icann := false
+
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.Contains(text, "===BEGIN ICANN DOMAINS==="):
+			icann = true
+			continue
+		case strings.Contains(text, "===END ICANN DOMAINS==="):
+			icann = false
+			continue
+		case text == "" || strings.HasPrefix(text, "//"):
+			continue
+		}
+		// Only the first whitespace-separated field is significant.
+		text, _, _ = strings.Cut(text, " ")
+
+		var kind rule
+		switch {
+		case strings.HasPrefix(text, "!"):
+			text, kind.exception = text[1:], true
+		case strings.HasPrefix(text, "*."):
+			text, kind.wildcard = text[2:], true
+		default:
+			kind.normal = true
+		}
+		name, err := toASCII(text)
+		if err != nil || name == "" {
+			return nil, fmt.Errorf("publicsuffix: line %d: invalid rule %q", line, sc.Text())
+		}
+
+		existing := l.rules[name]
+		existing.normal = existing.normal || kind.normal
+		existing.wildcard = existing.wildcard || kind.wildcard
+		existing.exception = existing.exception || kind.exception
+		existing.icann = existing.icann || icann
+		l.rules[name] = existing
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("publicsuffix: %w", err)
+	}
+	if len(l.rules) == 0 {
+		return nil, fmt.Errorf("publicsuffix: list has no rules")
+	}
+	return l, nil
+}
+
+// Len returns the number of distinct suffixes in the list.
+func (l *List) Len() int {
+	return len(l.rules)
+}
+
+// PublicSuffix returns the public suffix of domain and whether it comes from
+// the ICANN section of the list. Domains under no listed suffix fall back to
+// their last label with icann false, as the list's implicit "*" rule requires.
+func (l *List) PublicSuffix(domain string) (suffix string, icann bool) {
+	labels := strings.Split(normalize(domain), ".")
+
+	// The first match from the left is the longest.
+	for i := range labels {
+		name := strings.Join(labels[i:], ".")
+		if r, ok := l.rules[name]; ok && r.exception {
+			return strings.Join(labels[i+1:], "."), r.icann
+		}
+		if r, ok := l.rules[name]; ok && r.normal {
+			return name, r.icann
+		}
+		if i+1 < len(labels) {
+			if r, ok := l.rules[strings.Join(labels[i+1:], ".")]; ok && r.wildcard {
+				return name, r.icann
+			}
+		}
+	}
+	return labels[len(labels)-1], false
+}
+
+// IsPublicSuffix reports whether domain is itself a public suffix.
+func (l *List) IsPublicSuffix(domain string) bool {
+	suffix, _ := l.PublicSuffix(domain)
+	return suffix == normalize(domain)
+}
+
+// EffectiveTLDPlusOne returns the registrable domain ("site") of domain: its
+// public suffix plus one more label. It fails for public suffixes themselves.
+func (l *List) EffectiveTLDPlusOne(domain string) (string, error) {
+	domain = normalize(domain)
+	if domain == "" || strings.HasPrefix(domain, ".") || strings.Contains(domain, "..") {
+		return "", fmt.Errorf("publicsuffix: empty label in domain %q", domain)
+	}
+	suffix, _ := l.PublicSuffix(domain)
+	if len(domain) <= len(suffix) {
+		return "", fmt.Errorf("publicsuffix: cannot derive eTLD+1 for domain %q", domain)
+	}
+	i := len(domain) - len(suffix) - 1
+	if domain[i] != '.' {
+		return "", fmt.Errorf("publicsuffix: invalid public suffix %q for domain %q", suffix, domain)
+	}
+	return domain[1+strings.LastIndexByte(domain[:i], '.'):], nil
+}
+
+// PublicSuffix calls PublicSuffix on the default list.
+func PublicSuffix(domain string) (suffix string, icann bool) {
+	return Default().PublicSuffix(domain)
+}
+
+// IsPublicSuffix calls IsPublicSuffix on the default list.
+func IsPublicSuffix(domain string) bool {
+	return Default().IsPublicSuffix(domain)
+}
+
+// EffectiveTLDPlusOne calls EffectiveTLDPlusOne on the default list.
+func EffectiveTLDPlusOne(domain string) (string, error) {
+	return Default().EffectiveTLDPlusOne(domain)
+}
+
+// normalize lowercases domain, strips a trailing dot and converts it to A-labels.
+func normalize(domain string) string {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	if ascii, err := toASCII(domain); err == nil {
+		return ascii
+	}
+	return strings.ToLower(domain)
+}
+
+// toASCII converts a domain to lowercase A-labels.
+func toASCII(s string) (string, error) {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return idna.Lookup.ToASCII(s)
+		}
+	}
+	return strings.ToLower(s), nil
+}
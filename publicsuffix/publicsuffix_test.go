@@ -0,0 +1,115 @@
+package publicsuffix
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPublicSuffix(t *testing.T) {
+	tests := []struct {
+		domain string
+		suffix string
+		icann  bool
+	}{
+		{"example.com", "com", true},
+		{"www.example.co.uk", "co.uk", true},
+		{"co.uk", "co.uk", true},
+		{"WWW.Example.COM.", "com", true},
+		{"foo.bar.ck", "bar.ck", true}, // *.ck
+		{"www.ck", "ck", true},         // !www.ck
+		{"a.www.ck", "ck", true},       // !www.ck
+		{"user.github.io", "github.io", false},
+		{"example.unknowntld", "unknowntld", false},
+		{"食狮.公司.cn", "xn--55qx5d.cn", true},
+	}
+	for _, tt := range tests {
+		suffix, icann := PublicSuffix(tt.domain)
+		if suffix != tt.suffix || icann != tt.icann {
+			t.Errorf("PublicSuffix(%q) = %q, %v, want %q, %v", tt.domain, suffix, icann, tt.suffix, tt.icann)
+		}
+	}
+}
+
+func TestEffectiveTLDPlusOne(t *testing.T) {
+	tests := []struct {
+		domain  string
+		want    string
+		wantErr bool
+	}{
+		{"www.example.com", "example.com", false},
+		{"example.com", "example.com", false},
+		{"a.b.example.co.uk", "example.co.uk", false},
+		{"user.github.io", "user.github.io", false},
+		{"www.ck", "www.ck", false},
+		{"com", "", true},
+		{"co.uk", "", true},
+		{"", "", true},
+		{"a..com", "", true},
+	}
+	for _, tt := range tests {
+		got, err := EffectiveTLDPlusOne(tt.domain)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("EffectiveTLDPlusOne(%q) = %q, %v, want %q, error %v", tt.domain, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestIsPublicSuffix(t *testing.T) {
+	for domain, want := range map[string]bool{
+		"com":         true,
+		"co.uk":       true,
+		"com.hk":      true,
+		"github.io":   true,
+		"example.com": false,
+		"uk.com":      true,
+		"google.com":  false,
+	} {
+		if got := IsPublicSuffix(domain); got != want {
+			t.Errorf("IsPublicSuffix(%q) = %v, want %v", domain, got, want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	l, err := Parse(strings.NewReader(`// ===BEGIN ICANN DOMAINS===
+test
+*.wild.test
+!keep.wild.test
+// ===END ICANN DOMAINS===
+// ===BEGIN PRIVATE DOMAINS===
+pages.example
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if l.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", l.Len())
+	}
+	if s, icann := l.PublicSuffix("a.b.wild.test"); s != "b.wild.test" || !icann {
+		t.Errorf("PublicSuffix(a.b.wild.test) = %q, %v", s, icann)
+	}
+	if s, _ := l.PublicSuffix("keep.wild.test"); s != "wild.test" {
+		t.Errorf("PublicSuffix(keep.wild.test) = %q, want wild.test", s)
+	}
+	if s, icann := l.PublicSuffix("site.pages.example"); s != "pages.example" || icann {
+		t.Errorf("PublicSuffix(site.pages.example) = %q, %v", s, icann)
+	}
+
+	if _, err := Parse(strings.NewReader("// only comments\n")); err == nil {
+		t.Error("Parse() of an empty list should fail")
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+	old := Default()
+	defer SetDefault(old)
+
+	l, err := Parse(strings.NewReader("example\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDefault(l)
+	if !IsPublicSuffix("example") || IsPublicSuffix("co.uk") {
+		t.Error("package functions should use the list passed to SetDefault")
+	}
+}
@@ -0,0 +1,302 @@
+package rules
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/xihale/snirect-shared/pattern"
+	"github.com/xihale/snirect-shared/publicsuffix"
+)
+
+// FindingKind classifies an Analyze finding.
+type FindingKind string
+
+const (
+	// FindingInvalid: the key is not a valid pattern and never matches.
+	FindingInvalid FindingKind = "invalid"
+	// FindingDisabled: the key starts with an ignore prefix (# or ^) and never matches.
+	FindingDisabled FindingKind = "disabled"
+	// FindingShadowed: every host (or every sampled host) of the key is taken by a more specific key.
+	FindingShadowed FindingKind = "shadowed"
+	// FindingDuplicate: two keys normalize to the same pattern; only one is used.
+	FindingDuplicate FindingKind = "duplicate"
+	// FindingRedundant: a less specific key with the same value matches every host of the key.
+	FindingRedundant FindingKind = "redundant"
+	// FindingEmpty: the exclusions remove every host the include term matches.
+	FindingEmpty FindingKind = "empty"
+	// FindingPublicSuffix: a wildcard covers a whole public suffix such as co.uk.
+	FindingPublicSuffix FindingKind = "public-suffix"
+	// FindingDeadExclusion: an exclusion term never removes a host matched by the include term.
+	FindingDeadExclusion FindingKind = "dead-exclusion"
+	// FindingConflict: layers assign different values to the same key; the last layer wins.
+	FindingConflict FindingKind = "conflict"
+)
+
+// Finding is a single problem reported by Analyze.
+type Finding struct {
+	Kind    FindingKind `json:"kind"`
+	Section Section     `json:"section"`
+	// Key is the key as initialized, without the legacy "$" prefix, so it may
+	// differ from the key as written; Document.Remove accepts either.
+	Key string `json:"key"`
+	// Related is the shadowing key, the other duplicate key or the dead exclusion term.
+	Related string `json:"related,omitempty"`
+	Message string `json:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s %q: %s", f.Section, f.Kind, f.Key, f.Message)
+}
+
+// Report is the result of Analyze, sorted by section, key and kind.
+type Report struct {
+	Findings []Finding `json:"findings"`
+}
+
+// String renders the report one finding per line.
+func (rep *Report) String() string {
+	var b strings.Builder
+	for _, f := range rep.Findings {
+		b.WriteString(f.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Analyze inspects a rule set for keys that can never take effect: invalid and
+// disabled keys, keys shadowed by more specific ones, duplicate keys after `$`
+// and case/quote normalization, exclusions that never exclude anything, and
+// wildcards whose scope is an ICANN public suffix ("*co.uk", "*.com.hk").
+//
+// If layers are given (e.g. from LoadLayers), keys that several layers assign
+// different values to are reported as conflicts.
+//
+// Keys reported as redundant, empty, duplicate or shadowed with "every host" are
+// proven with pattern.Pattern.Subsumes and can be removed with Compact. Other
+// shadowed keys and dead exclusions are detected by matching sample hosts derived
+// from each pattern (see pattern.Pattern.Examples), so they are strong hints
+// rather than proofs.
+func Analyze(r *Rules, layers ...Layer) *Report {
+	rep := &Report{}
+
+	r.mu.RLock()
+	analyzeSection(rep, SectionAlterHostname, r.AlterHostname, r.alterHostnameRules)
+	analyzeSection(rep, SectionCertVerify, r.CertVerify, r.certVerifyRules)
+	analyzeSection(rep, SectionHosts, r.Hosts, r.hostsRules)
+	for _, d := range r.droppedKeys {
+		rep.Findings = append(rep.Findings, Finding{
+			Kind:    FindingDuplicate,
+			Section: d.section,
+			Key:     d.key,
+			Related: d.kept,
+			Message: fmt.Sprintf("legacy key normalizes to %q, which is also defined; this key was dropped", d.kept),
+		})
+	}
+	r.mu.RUnlock()
+
+	analyzeConflicts(rep, layers)
+
+	slices.SortStableFunc(rep.Findings, func(a, b Finding) int {
+		if c := cmp.Compare(slices.Index(Sections, a.Section), slices.Index(Sections, b.Section)); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Key, b.Key); c != 0 {
+			return c
+		}
+		return strings.Compare(string(a.Kind), string(b.Kind))
+	})
+	return rep
+}
+
+// analyzeSection reports findings for one section. Callers must hold r.mu.
+func analyzeSection[T any](rep *Report, section Section, m map[string]T, rules compiledRules) {
+	add := func(kind FindingKind, key, related, format string, args ...any) {
+		rep.Findings = append(rep.Findings, Finding{
+			Kind:    kind,
+			Section: section,
+			Key:     key,
+			Related: related,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	proven := make(map[string]bool)
+	for _, rm := range removableRules(m, rules) {
+		proven[rm.key] = true
+		add(rm.kind, rm.key, rm.related, "%s", rm.message)
+	}
+
+	for i, k := range rules.keys {
+		p := rules.set.Pattern(i)
+		switch {
+		case p == nil:
+			_, err := pattern.Compile(k)
+			add(FindingInvalid, k, "", "%v", err)
+			continue
+		case p.Ignored():
+			add(FindingDisabled, k, "", "ignore prefix; the rule never matches")
+			continue
+		}
+
+		if !proven[k] {
+			if by, ok := shadowedBy(m, rules, i); ok {
+				if canonicalKey(by) == canonicalKey(k) {
+					add(FindingDuplicate, k, by, "same pattern as %q, which takes precedence", by)
+				} else {
+					add(FindingShadowed, k, by, "every sampled host is matched first by %q", by)
+				}
+			}
+		}
+
+		for _, scope := range p.Scopes() {
+			if suffix, icann := publicsuffix.PublicSuffix(scope); icann && suffix == scope {
+				add(FindingPublicSuffix, k, scope, "matches every domain under the public suffix %q", scope)
+				break
+			}
+		}
+
+		include := p.Include()
+		for _, ex := range p.Exclusions() {
+			if ex.Disjoint(include) || !anyExampleMatches(ex, include) {
+				add(FindingDeadExclusion, k, ex.String(), "exclusion %q never overlaps the include term", ex.String())
+			}
+		}
+	}
+}
+
+// shadowedBy reports whether the i-th rule never wins a global lookup for any
+// of its sample hosts, returning the key that wins the first sample instead.
+// Rules that do not answer global lookups are not considered.
+func shadowedBy[T any](m map[string]T, rules compiledRules, i int) (string, bool) {
+	p := rules.set.Pattern(i)
+	port := examplePort(p)
+	examples := p.Examples()
+	if len(examples) == 0 || !rules.global(rules.keys[i]) {
+		return "", false
+	}
+
+	var first string
+	for _, host := range examples {
+		// Mirror lookup, skipping disabled, expired and app-scoped rules.
+		winner, ok := findKey(m, rules, host, port, rules.global)
+		if !ok || winner == rules.keys[i] {
+			return "", false
+		}
+		if first == "" {
+			first = winner
+		}
+	}
+	return first, true
+}
+
+// anyExampleMatches reports whether any sample host of ex matches include.
+func anyExampleMatches(ex, include *pattern.Pattern) bool {
+	for _, host := range ex.Examples() {
+		if include.MatchPort(host, examplePort(ex)) {
+			return true
+		}
+	}
+	return false
+}
+
+// examplePort returns a port accepted by the pattern's include term, or 0 if the
+// term matches every port.
+func examplePort(p *pattern.Pattern) int {
+	lo, _ := p.Ports()
+	return lo
+}
+
+// analyzeConflicts reports keys that layers assign different values to.
+func analyzeConflicts(rep *Report, layers []Layer) {
+	if len(layers) < 2 {
+		return
+	}
+	for _, section := range Sections {
+		type assignment struct {
+			layer string
+			key   string
+			value any
+		}
+		byKey := make(map[string][]assignment)
+		var order []string
+		for _, layer := range layers {
+			for k, v := range layer.Rules.values(section) {
+				ck := canonicalKey(k)
+				if _, ok := byKey[ck]; !ok {
+					order = append(order, ck)
+				}
+				byKey[ck] = append(byKey[ck], assignment{layer: layer.Name, key: k, value: v})
+			}
+		}
+
+		for _, ck := range order {
+			as := byKey[ck]
+			conflict := false
+			for _, a := range as[1:] {
+				if !reflect.DeepEqual(a.value, as[0].value) {
+					conflict = true
+					break
+				}
+			}
+			if !conflict {
+				continue
+			}
+			parts := make([]string, len(as))
+			for i, a := range as {
+				parts[i] = fmt.Sprintf("%s=%v", a.layer, formatValue(a.value))
+			}
+			last := as[len(as)-1]
+			rep.Findings = append(rep.Findings, Finding{
+				Kind:    FindingConflict,
+				Section: section,
+				Key:     last.key,
+				Message: fmt.Sprintf("%s; %s wins", strings.Join(parts, ", "), last.layer),
+			})
+		}
+	}
+}
+
+// values returns a copy of a section as key -> value.
+func (r *Rules) values(section Section) map[string]any {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make(map[string]any)
+	switch section {
+	case SectionAlterHostname:
+		for k, v := range r.AlterHostname {
+			out[k] = v
+		}
+	case SectionCertVerify:
+		for k, v := range r.CertVerify {
+			out[k] = v
+		}
+	case SectionHosts:
+		for k, v := range r.Hosts {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// canonicalKey folds the spelling differences MatchPattern ignores: case,
+// surrounding quotes and whitespace, the trailing dot and the legacy `$` prefix.
+func canonicalKey(k string) string {
+	k = strings.TrimSpace(k)
+	k = strings.Trim(k, "\"")
+	k = strings.Trim(k, "'")
+	k = strings.TrimSpace(k)
+	k = strings.TrimPrefix(k, "$")
+	return strings.ToLower(strings.TrimSuffix(k, "."))
+}
+
+// formatValue renders a rule value for messages.
+func formatValue(v any) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprintf("%v", v)
+}
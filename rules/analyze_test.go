@@ -0,0 +1,130 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyze(t *testing.T) {
+	r := NewRules()
+	r.AlterHostname["#*google*"] = "g.cn"
+	r.AlterHostname["*.xn--zz.com"] = "g.cn"
+	r.AlterHostname["*.example.com"] = "a"
+	r.AlterHostname["a*.example.com"] = "b"
+	r.AlterHostname["*.yahoo.com^*.example.org"] = "c"
+	r.AlterHostname["*co.uk"] = "d"
+	r.AlterHostname["*.{com.hk,example.hk}"] = "d"
+	r.AlterHostname["*.github.io"] = "d"
+	r.Hosts["$dup.example.net"] = "192.0.2.1"
+	r.Hosts["dup.example.net"] = "192.0.2.2"
+	r.CertVerify["Case.example.net"] = true
+	r.CertVerify["case.example.net"] = false
+	r.Init()
+
+	rep := Analyze(r)
+
+	want := []struct {
+		kind    FindingKind
+		section Section
+		key     string
+		related string
+	}{
+		{kind: FindingDisabled, section: SectionAlterHostname, key: "#*google*"},
+		{kind: FindingInvalid, section: SectionAlterHostname, key: "*.xn--zz.com"},
+		{kind: FindingShadowed, section: SectionAlterHostname, key: "a*.example.com", related: "*.example.com"},
+		{kind: FindingDeadExclusion, section: SectionAlterHostname, key: "*.yahoo.com^*.example.org", related: "*.example.org"},
+		{kind: FindingPublicSuffix, section: SectionAlterHostname, key: "*co.uk", related: "co.uk"},
+		{kind: FindingPublicSuffix, section: SectionAlterHostname, key: "*.{com.hk,example.hk}", related: "com.hk"},
+		{kind: FindingDuplicate, section: SectionHosts, key: "$dup.example.net", related: "dup.example.net"},
+		{kind: FindingDuplicate, section: SectionCertVerify, key: "Case.example.net", related: "case.example.net"},
+	}
+
+	for _, w := range want {
+		found := false
+		for _, f := range rep.Findings {
+			if f.Kind == w.kind && f.Section == w.section && f.Key == w.key && f.Related == w.related {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("missing finding %s %s %q (related %q) in:\n%s", w.section, w.kind, w.key, w.related, rep)
+		}
+	}
+	if len(rep.Findings) != len(want) {
+		t.Errorf("Analyze() returned %d findings, want %d:\n%s", len(rep.Findings), len(want), rep)
+	}
+
+	if got, _ := r.GetHost("dup.example.net"); got != "192.0.2.2" {
+		t.Errorf("plain key should win over legacy $ key, got %q", got)
+	}
+}
+
+func TestAnalyzeLayers(t *testing.T) {
+	base := NewRules()
+	base.Hosts["store.steampowered.com"] = "23.39.61.133"
+	base.Hosts["same.example.com"] = "192.0.2.1"
+	base.Init()
+
+	override := NewRules()
+	override.Hosts["store.steampowered.com"] = DefaultAutoMarker
+	override.Hosts["same.example.com"] = "192.0.2.1"
+	override.Init()
+
+	merged := NewRules()
+	merged.Merge(base)
+	merged.Merge(override)
+
+	rep := Analyze(merged, Layer{Name: LayerFetched, Rules: base}, Layer{Name: LayerDefault, Rules: override})
+	if len(rep.Findings) != 1 {
+		t.Fatalf("Analyze() = %d findings, want 1:\n%s", len(rep.Findings), rep)
+	}
+	f := rep.Findings[0]
+	if f.Kind != FindingConflict || f.Key != "store.steampowered.com" {
+		t.Fatalf("unexpected finding %s", f)
+	}
+	if !strings.Contains(f.Message, `default="__AUTO__"`) || !strings.Contains(f.Message, "default wins") {
+		t.Errorf("conflict message %q lacks values", f.Message)
+	}
+}
+
+func TestAnalyzeEmbeddedRules(t *testing.T) {
+	layers, err := LoadLayers()
+	if err != nil {
+		t.Fatalf("LoadLayers() error = %v", err)
+	}
+	r, err := LoadRules()
+	if err != nil {
+		t.Fatalf("LoadRules() error = %v", err)
+	}
+
+	for _, f := range Analyze(r, layers...).Findings {
+		switch f.Kind {
+		case FindingInvalid, FindingShadowed, FindingDeadExclusion, FindingPublicSuffix:
+			t.Errorf("embedded rules: %s", f)
+		}
+	}
+}
+
+func TestAnalyzeInactiveShadow(t *testing.T) {
+	setNow(t, time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC))
+	r := NewRules()
+	if err := r.FromTOML([]byte(`
+[alter_hostname]
+"*.example.com" = { sni = "a", enabled = false }
+"a*.example.com" = "b"
+"*.example.org" = { sni = "a", expires = 2026-01-01 }
+"a*.example.org" = "b"
+"*.example.net" = { sni = "a", apps = ["com.example.app"] }
+"a*.example.net" = "b"
+"*.example.io" = "a"
+"a*.example.io" = "b"
+`)); err != nil {
+		t.Fatal(err)
+	}
+	rep := Analyze(r)
+	if len(rep.Findings) != 1 || rep.Findings[0].Key != "a*.example.io" || rep.Findings[0].Kind != FindingShadowed {
+		t.Errorf("Analyze() =\n%s\nwant only a*.example.io shadowed", rep)
+	}
+}
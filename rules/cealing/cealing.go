@@ -0,0 +1,229 @@
+// Package cealing converts the Cealing-Host list into a Snirect rule layer.
+//
+// Cealing-Host is a JSON array of entries of the form
+//
+//	[["*pixiv.net", "*fanbox.cc"], "pixivision.net", "210.140.139.155"]
+//
+// listing domain patterns, the SNI to send (empty for none) and the address to
+// connect to. A null SNI or address leaves that section without a rule.
+package cealing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/xihale/snirect-shared/pattern"
+	"github.com/xihale/snirect-shared/rules"
+)
+
+// Header is the first line of files written by WriteTOML.
+const Header = "# Generated from Cealing-Host"
+
+// Note describes an entry or domain that was disabled or skipped.
+type Note struct {
+	// Entry is the zero-based index of the entry in the list.
+	Entry int `json:"entry"`
+	// Domain is the affected domain, or empty if the whole entry is affected.
+	Domain string `json:"domain,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (n Note) String() string {
+	if n.Domain == "" {
+		return fmt.Sprintf("entry %d: %s", n.Entry, n.Reason)
+	}
+	return fmt.Sprintf("entry %d: %s: %s", n.Entry, n.Reason, n.Domain)
+}
+
+// Result is the outcome of Parse.
+type Result struct {
+	// Rules holds the alter_hostname and hosts rules of the list with keys as
+	// written upstream. It is not initialized; call Init before lookups.
+	Rules *rules.Rules
+	// Entries is the number of entries in the list.
+	Entries int
+	// Commented lists domains disabled upstream with an ignore prefix ("#",
+	// "$" or "^"). Domains commented out with "#" are left out of Rules; the
+	// others are kept as written, since Init reads "$" as a legacy prefix.
+	Commented []Note
+	// Skipped lists entries, domains and fields that could not be converted.
+	Skipped []Note
+}
+
+// Parse reads a Cealing-Host list. Malformed entries, invalid patterns,
+// invalid addresses and repeated domains are skipped and reported rather than
+// failing the conversion; only a list that is not a JSON array is an error.
+func Parse(r io.Reader) (*Result, error) {
+	var entries []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("cealing: %w", err)
+	}
+
+	res := &Result{Rules: rules.NewRules(), Entries: len(entries)}
+	seen := make(map[string]int)
+	for i, raw := range entries {
+		e, reason := parseEntry(raw)
+		if reason != "" {
+			res.Skipped = append(res.Skipped, Note{Entry: i, Reason: reason})
+			continue
+		}
+		if e.addr != nil && !validAddress(*e.addr) {
+			res.Skipped = append(res.Skipped, Note{Entry: i, Reason: fmt.Sprintf("invalid address %q", *e.addr)})
+			e.addr = nil
+		}
+
+		for _, d := range e.domains {
+			p, err := pattern.Compile(d)
+			if err != nil {
+				res.Skipped = append(res.Skipped, Note{Entry: i, Domain: d, Reason: err.Error()})
+				continue
+			}
+			if first, ok := seen[d]; ok {
+				res.Skipped = append(res.Skipped, Note{Entry: i, Domain: d, Reason: fmt.Sprintf("duplicate of entry %d", first)})
+				continue
+			}
+			seen[d] = i
+			if p.Ignored() {
+				res.Commented = append(res.Commented, Note{Entry: i, Domain: d, Reason: fmt.Sprintf("disabled with %q", d[:1])})
+				if strings.HasPrefix(d, "#") {
+					continue
+				}
+			}
+			if e.sni != nil {
+				res.Rules.AlterHostname[d] = *e.sni
+			}
+			if e.addr != nil {
+				res.Rules.Hosts[d] = *e.addr
+			}
+		}
+	}
+	return res, nil
+}
+
+type entry struct {
+	domains   []string
+	sni, addr *string
+}
+
+// parseEntry decodes one list entry, returning a non-empty reason if it is
+// malformed.
+func parseEntry(raw json.RawMessage) (entry, string) {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return entry{}, "entry is not an array"
+	}
+	if len(fields) < 2 || len(fields) > 3 {
+		return entry{}, fmt.Sprintf("entry has %d fields, want [domains, sni, address]", len(fields))
+	}
+
+	var e entry
+	if err := json.Unmarshal(fields[0], &e.domains); err != nil || e.domains == nil {
+		return entry{}, "domains are not an array of strings"
+	}
+	if len(e.domains) == 0 {
+		return entry{}, "entry has no domains"
+	}
+	if err := json.Unmarshal(fields[1], &e.sni); err != nil {
+		return entry{}, "SNI is not a string or null"
+	}
+	if len(fields) == 3 {
+		if err := json.Unmarshal(fields[2], &e.addr); err != nil {
+			return entry{}, "address is not a string or null"
+		}
+	}
+	if e.sni == nil && e.addr == nil {
+		return entry{}, "entry has neither an SNI nor an address"
+	}
+	return e, ""
+}
+
+// validAddress reports whether s can be a hosts value: empty, an IP literal
+// (bracketed or not) or a hostname to resolve instead.
+func validAddress(s string) bool {
+	if s == "" {
+		return true
+	}
+	if _, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")); err == nil {
+		return true
+	}
+	if len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(s, "."), ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// WriteTOML writes r as a TOML rule layer with sections in file order and keys
+// sorted within each section, so regenerating from the same list gives
+// identical bytes. Empty sections are omitted.
+func WriteTOML(w io.Writer, r *rules.Rules) error {
+	var b bytes.Buffer
+	b.WriteString(Header + "\n")
+	if err := rules.WriteTOML(&b, r); err != nil {
+		return fmt.Errorf("cealing: %w", err)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// WriteList writes the alter_hostname and hosts rules of r as a Cealing-Host
+// list, one entry per line. Domains with the same SNI and address share an
+// entry; a domain missing from a section gets null there. cert_verify has no
+// Cealing-Host equivalent and is not written.
+func WriteList(w io.Writer, r *rules.Rules) error {
+	type target struct {
+		sni, addr       string
+		hasSNI, hasAddr bool
+	}
+	groups := make(map[target][]string)
+	var order []target
+
+	domains := append(r.Keys(rules.SectionAlterHostname), r.Keys(rules.SectionHosts)...)
+	slices.Sort(domains)
+	for _, d := range slices.Compact(domains) {
+		var t target
+		t.sni, t.hasSNI = r.AlterHostname[d]
+		t.addr, t.hasAddr = r.Hosts[d]
+		if _, ok := groups[t]; !ok {
+			order = append(order, t)
+		}
+		groups[t] = append(groups[t], d)
+	}
+
+	nullable := func(s string, ok bool) any {
+		if !ok {
+			return nil
+		}
+		return s
+	}
+	var b bytes.Buffer
+	b.WriteString("[")
+	for i, t := range order {
+		entry, err := json.Marshal([]any{groups[t], nullable(t.sni, t.hasSNI), nullable(t.addr, t.hasAddr)})
+		if err != nil {
+			return fmt.Errorf("cealing: %w", err)
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString("\n  ")
+		b.Write(entry)
+	}
+	b.WriteString("\n]\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
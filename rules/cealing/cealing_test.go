@@ -0,0 +1,209 @@
+package cealing
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/xihale/snirect-shared/rules"
+)
+
+const sampleList = `[
+  [["*pixiv.net", "*fanbox.cc"], "pixivision.net", "210.140.139.155"],
+  [["cdn.jsdelivr.net"], "", "104.16.89.20"],
+  [["*.googlevideo.com"], "", ""],
+  [["$*twitch.tv", "#*google*"], null, "[2001:db8::1]"],
+  [["sni-only.example"], "front.example"],
+  [["*pixiv.net"], "other.example", "192.0.2.1"],
+  [["bad:port"], "", "192.0.2.2"],
+  [["bad-address.example"], "", "not an address"],
+  [["cname.example"], "", "guce.yahoo.com"],
+  "not an entry",
+  [[], "", "192.0.2.3"],
+  [["nothing.example"], null, null],
+  [["a.example"], 1, "192.0.2.4"],
+  [["a.example"]]
+]`
+
+func TestParse(t *testing.T) {
+	res, err := Parse(strings.NewReader(sampleList))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if res.Entries != 14 {
+		t.Errorf("Entries = %d, want 14", res.Entries)
+	}
+
+	wantAlter := map[string]string{
+		"*pixiv.net":          "pixivision.net",
+		"*fanbox.cc":          "pixivision.net",
+		"cdn.jsdelivr.net":    "",
+		"*.googlevideo.com":   "",
+		"sni-only.example":    "front.example",
+		"bad-address.example": "",
+		"cname.example":       "",
+	}
+	wantHosts := map[string]string{
+		"*pixiv.net":        "210.140.139.155",
+		"*fanbox.cc":        "210.140.139.155",
+		"cdn.jsdelivr.net":  "104.16.89.20",
+		"*.googlevideo.com": "",
+		"$*twitch.tv":       "[2001:db8::1]",
+		"cname.example":     "guce.yahoo.com",
+	}
+	if !maps.Equal(res.Rules.AlterHostname, wantAlter) {
+		t.Errorf("AlterHostname = %v, want %v", res.Rules.AlterHostname, wantAlter)
+	}
+	if !maps.Equal(res.Rules.Hosts, wantHosts) {
+		t.Errorf("Hosts = %v, want %v", res.Rules.Hosts, wantHosts)
+	}
+
+	commented := []string{"entry 3: disabled with \"$\": $*twitch.tv", "entry 3: disabled with \"#\": #*google*"}
+	if got := notes(res.Commented); !slices.Equal(got, commented) {
+		t.Errorf("Commented = %q, want %q", got, commented)
+	}
+
+	skipped := []struct {
+		entry  int
+		domain string
+		reason string
+	}{
+		{5, "*pixiv.net", "duplicate of entry 0"},
+		{6, "bad:port", "port"},
+		{7, "", "invalid address"},
+		{9, "", "not an array"},
+		{10, "", "no domains"},
+		{11, "", "neither an SNI nor an address"},
+		{12, "", "SNI is not a string"},
+		{13, "", "1 fields"},
+	}
+	if len(res.Skipped) != len(skipped) {
+		t.Fatalf("Skipped = %q, want %d notes", notes(res.Skipped), len(skipped))
+	}
+	for i, want := range skipped {
+		got := res.Skipped[i]
+		if got.Entry != want.entry || got.Domain != want.domain || !strings.Contains(got.Reason, want.reason) {
+			t.Errorf("Skipped[%d] = %v, want entry %d %q containing %q", i, got, want.entry, want.domain, want.reason)
+		}
+	}
+}
+
+func TestParseNotAList(t *testing.T) {
+	for _, input := range []string{"", "{}", `{"rules": []}`} {
+		if _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("Parse(%q) succeeded", input)
+		}
+	}
+}
+
+func TestWriteTOML(t *testing.T) {
+	res, err := Parse(strings.NewReader(sampleList))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	var first, second bytes.Buffer
+	if err := WriteTOML(&first, res.Rules); err != nil {
+		t.Fatalf("WriteTOML() error = %v", err)
+	}
+	res2, _ := Parse(strings.NewReader(sampleList))
+	if err := WriteTOML(&second, res2.Rules); err != nil {
+		t.Fatalf("WriteTOML() error = %v", err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("WriteTOML() output is not deterministic")
+	}
+
+	out := first.String()
+	if !strings.HasPrefix(out, Header+"\n\n[alter_hostname]\n") {
+		t.Errorf("WriteTOML() output starts with %q", out[:min(len(out), 60)])
+	}
+	if strings.Contains(out, "[cert_verify]") {
+		t.Error("WriteTOML() wrote an empty [cert_verify] section")
+	}
+	hosts := out[strings.Index(out, "[hosts]"):]
+	wantHosts := `[hosts]
+"$*twitch.tv" = "[2001:db8::1]"
+"*.googlevideo.com" = ""
+"*fanbox.cc" = "210.140.139.155"
+"*pixiv.net" = "210.140.139.155"
+"cdn.jsdelivr.net" = "104.16.89.20"
+"cname.example" = "guce.yahoo.com"
+`
+	if hosts != wantHosts {
+		t.Errorf("hosts section =\n%s\nwant\n%s", hosts, wantHosts)
+	}
+
+	// The output loads back into the same rules.
+	back := rules.NewRules()
+	if err := back.FromTOML(first.Bytes()); err != nil {
+		t.Fatalf("FromTOML() error = %v", err)
+	}
+	res.Rules.Init()
+	for _, section := range []rules.Section{rules.SectionAlterHostname, rules.SectionHosts} {
+		if got, want := back.Keys(section), res.Rules.Keys(section); !slices.Equal(got, want) {
+			t.Errorf("%s keys after round trip = %q, want %q", section, got, want)
+		}
+	}
+}
+
+func TestWriteTOMLEscaping(t *testing.T) {
+	r := rules.NewRules()
+	r.AlterHostname[`quote"back\slash`] = "tab\there"
+	r.CertVerify["*.example.com"] = []any{"a.example", "b.example"}
+	r.CertVerify["strict.example"] = true
+
+	var b bytes.Buffer
+	if err := WriteTOML(&b, r); err != nil {
+		t.Fatalf("WriteTOML() error = %v", err)
+	}
+	back := rules.NewRules()
+	if err := back.FromTOML(b.Bytes()); err != nil {
+		t.Fatalf("FromTOML() error = %v\n%s", err, b.String())
+	}
+	if got := back.AlterHostname[`quote"back\slash`]; got != "tab\there" {
+		t.Errorf("round trip value = %q", got)
+	}
+	if p, ok := back.GetCertVerify("x.example.com"); !ok || p.Verify || !slices.Equal(p.Allow, []string{"a.example", "b.example"}) {
+		t.Errorf("round trip cert_verify = %+v, %v", p, ok)
+	}
+
+	r.CertVerify["bad.example"] = 1.5
+	if err := WriteTOML(&b, r); err == nil {
+		t.Error("WriteTOML() with an unsupported cert_verify value succeeded")
+	}
+}
+
+func notes(ns []Note) []string {
+	out := make([]string, len(ns))
+	for i, n := range ns {
+		out[i] = n.String()
+	}
+	return out
+}
+
+func TestWriteList(t *testing.T) {
+	res, err := Parse(strings.NewReader(sampleList))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	var b bytes.Buffer
+	if err := WriteList(&b, res.Rules); err != nil {
+		t.Fatalf("WriteList() error = %v", err)
+	}
+	if !strings.Contains(b.String(), `[["*fanbox.cc","*pixiv.net"],"pixivision.net","210.140.139.155"]`) {
+		t.Errorf("WriteList() did not group domains with the same target:\n%s", b.String())
+	}
+
+	back, err := Parse(&b)
+	if err != nil {
+		t.Fatalf("Parse(WriteList()) error = %v", err)
+	}
+	if len(back.Skipped) != 0 {
+		t.Errorf("Parse(WriteList()) skipped %q", notes(back.Skipped))
+	}
+	if !maps.Equal(back.Rules.AlterHostname, res.Rules.AlterHostname) || !maps.Equal(back.Rules.Hosts, res.Rules.Hosts) {
+		t.Errorf("round trip = %v %v, want %v %v", back.Rules.AlterHostname, back.Rules.Hosts, res.Rules.AlterHostname, res.Rules.Hosts)
+	}
+}
@@ -0,0 +1,196 @@
+package rules
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/xihale/snirect-shared/pattern"
+)
+
+// removable is a key whose removal provably leaves every lookup unchanged.
+type removable struct {
+	kind    FindingKind
+	key     string
+	related string
+	message string
+}
+
+// Compact deletes keys that provably never change a lookup result: keys whose
+// exclusions remove every host, keys whose hosts are all matched first by a more
+// specific key, and keys covered by a less specific key with the same value.
+// Disabled, invalid, expiring and application-scoped keys are kept, and only
+// keys that always match for every application cover others. The removed keys
+// are returned as findings.
+func (r *Rules) Compact() []Finding {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.initLocked()
+
+	var findings []Finding
+	findings = append(findings, compactSection(SectionAlterHostname, r.AlterHostname, r.alterHostnameRules)...)
+	findings = append(findings, compactSection(SectionCertVerify, r.CertVerify, r.certVerifyRules)...)
+	findings = append(findings, compactSection(SectionHosts, r.Hosts, r.hostsRules)...)
+
+	if len(findings) > 0 {
+		r.initLocked()
+	}
+	return findings
+}
+
+// compactSection deletes the removable keys of one section from m.
+func compactSection[T any](section Section, m map[string]T, rules compiledRules) []Finding {
+	var findings []Finding
+	for _, rm := range removableRules(m, rules) {
+		delete(m, rm.key)
+		findings = append(findings, Finding{
+			Kind:    rm.kind,
+			Section: section,
+			Key:     rm.key,
+			Related: rm.related,
+			Message: rm.message,
+		})
+	}
+	return findings
+}
+
+// removableRules returns the keys of a section that can be removed together
+// without changing any lookup, in match order.
+//
+// Keys are considered one at a time against the keys not removed so far, so each
+// removal is justified by the rule set that remains after the earlier ones.
+func removableRules[T any](m map[string]T, rules compiledRules) []removable {
+	var out []removable
+	removed := make([]bool, len(rules.keys))
+	remove := func(i int, kind FindingKind, related, format string, args ...any) {
+		removed[i] = true
+		out = append(out, removable{
+			kind:    kind,
+			key:     rules.keys[i],
+			related: related,
+			message: fmt.Sprintf(format, args...),
+		})
+	}
+	active := func(i int) *pattern.Pattern {
+		if removed[i] {
+			return nil
+		}
+		if p := rules.set.Pattern(i); p != nil && !p.Ignored() {
+			return p
+		}
+		return nil
+	}
+	// Only permanent rules may cover others. A disabled or app-scoped rule
+	// does not answer a global lookup (see compiledRules.global), and one with
+	// an expiry stops answering once it expires.
+	permanent := func(i int) bool {
+		_, timed := rules.meta[rules.keys[i]]
+		_, scoped := rules.apps[rules.keys[i]]
+		return !timed && !scoped
+	}
+
+	for i, k := range rules.keys {
+		p := active(i)
+		if p == nil || !permanent(i) {
+			continue
+		}
+
+		if ex := coveringExclusion(p); ex != nil {
+			remove(i, FindingEmpty, ex.String(), "exclusion %q removes every host of the include term", ex.String())
+			continue
+		}
+
+		// An exact key is looked up before any pattern, so earlier patterns
+		// cannot shadow it and must not change its value once it is gone.
+		exact := isExactKey(k, p)
+
+		if !exact {
+			if j, ok := firstSubsuming(rules, active, permanent, p, i); ok {
+				by := rules.keys[j]
+				if rules.set.Pattern(j).Equivalent(p) {
+					remove(i, FindingDuplicate, by, "same pattern as %q, which takes precedence", by)
+				} else {
+					remove(i, FindingShadowed, by, "every host is matched first by %q", by)
+				}
+				continue
+			}
+		}
+
+		if j, ok := coveringRule(m, rules, active, permanent, p, i, exact); ok {
+			by := rules.keys[j]
+			if rules.set.Pattern(j).Equivalent(p) {
+				remove(i, FindingDuplicate, by, "same pattern and value as %q", by)
+			} else {
+				remove(i, FindingRedundant, by, "%q has the same value and matches every host of this key", by)
+			}
+		}
+	}
+	return out
+}
+
+// coveringExclusion returns an exclusion of p that removes every host of its
+// include term, or nil.
+func coveringExclusion(p *pattern.Pattern) *pattern.Pattern {
+	include := p.Include()
+	for _, ex := range p.Exclusions() {
+		if ex.Subsumes(include) {
+			return ex
+		}
+	}
+	return nil
+}
+
+// firstSubsuming returns the first active, permanent rule before i that
+// matches every host of p.
+func firstSubsuming(rules compiledRules, active func(int) *pattern.Pattern, permanent func(int) bool, p *pattern.Pattern, i int) (int, bool) {
+	for j := 0; j < i; j++ {
+		if q := active(j); q != nil && permanent(j) && q.Subsumes(p) {
+			return j, true
+		}
+	}
+	return 0, false
+}
+
+// coveringRule returns an active, permanent rule after i that has the same
+// value as rule i and would answer every lookup rule i answers if rule i were
+// removed: it matches every host of p, and every rule a host could reach first
+// on the way there has the same value or shares no host with p. For an exact
+// key every other rule could be reached first. Rules that are not permanent
+// still count as reachable, since they may match now or later.
+func coveringRule[T any](m map[string]T, rules compiledRules, active func(int) *pattern.Pattern, permanent func(int) bool, p *pattern.Pattern, i int, exact bool) (int, bool) {
+	value := m[rules.keys[i]]
+	sameValue := func(j int) bool {
+		return reflect.DeepEqual(m[rules.keys[j]], value)
+	}
+
+	if exact {
+		for j := 0; j < i; j++ {
+			if q := active(j); q != nil && !sameValue(j) && !q.Disjoint(p) {
+				return 0, false
+			}
+		}
+	}
+	for j := i + 1; j < len(rules.keys); j++ {
+		q := active(j)
+		if q == nil {
+			continue
+		}
+		if !sameValue(j) {
+			if q.Disjoint(p) {
+				continue
+			}
+			return 0, false
+		}
+		if permanent(j) && q.Subsumes(p) {
+			return j, true
+		}
+	}
+	return 0, false
+}
+
+// isExactKey reports whether lookup finds key k by map access before consulting
+// the pattern set, i.e. k is a literal host (with an optional port) as spelled
+// after NormalizeHost.
+func isExactKey(k string, p *pattern.Pattern) bool {
+	return p.Specificity().Tier == pattern.TierExact && pattern.NormalizeHost(k) == k
+}
@@ -0,0 +1,124 @@
+package rules
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompact(t *testing.T) {
+	r := NewRules()
+	r.AlterHostname["*github.com"] = "a"
+	r.AlterHostname["api.github.com"] = "a"                    // redundant
+	r.AlterHostname["raw.github.com"] = "b"                    // different value, kept
+	r.AlterHostname["*.cdn.github.com^*.cdn.github.com"] = "c" // empty
+	r.AlterHostname["*.example.com"] = "x"
+	r.AlterHostname["a*.example.com"] = "y" // shadowed
+	r.AlterHostname["#*google*"] = "g"      // disabled, kept
+	r.Hosts["*.example.com"] = "192.0.2.1"
+	r.Hosts["*.{www,api}.example.com"] = "192.0.2.2"
+	r.Hosts["www.example.com"] = "192.0.2.2" // redundant via the alternation
+	r.Hosts["ww?.example.com"] = "192.0.2.3" // shadowed by *.example.com
+	r.Init()
+
+	type probe struct {
+		host string
+		alt  string
+		ip   string
+	}
+	hosts := []string{"api.github.com", "raw.github.com", "x.cdn.github.com", "github.com",
+		"www.example.com", "api.example.com", "abc.example.com", "wwx.example.com", "example.com"}
+	before := make(map[string]probe)
+	for _, h := range hosts {
+		alt, _ := r.GetAlterHostname(h)
+		ip, _ := r.GetHost(h)
+		before[h] = probe{h, alt, ip}
+	}
+
+	removed := make(map[string]FindingKind)
+	for _, f := range r.Compact() {
+		removed[f.Key] = f.Kind
+	}
+	want := map[string]FindingKind{
+		"api.github.com":                    FindingRedundant,
+		"*.cdn.github.com^*.cdn.github.com": FindingEmpty,
+		"a*.example.com":                    FindingShadowed,
+		"www.example.com":                   FindingRedundant,
+		"ww?.example.com":                   FindingShadowed,
+	}
+	for k, kind := range want {
+		if removed[k] != kind {
+			t.Errorf("Compact() removed %q as %q, want %q", k, removed[k], kind)
+		}
+	}
+	for k := range removed {
+		if _, ok := want[k]; !ok {
+			t.Errorf("Compact() removed unexpected key %q", k)
+		}
+	}
+	if _, ok := r.AlterHostname["#*google*"]; !ok {
+		t.Error("Compact() removed a disabled key")
+	}
+
+	for _, h := range hosts {
+		alt, _ := r.GetAlterHostname(h)
+		ip, _ := r.GetHost(h)
+		if got := (probe{h, alt, ip}); got != before[h] {
+			t.Errorf("lookup of %s changed from %+v to %+v", h, before[h], got)
+		}
+	}
+}
+
+func TestCompactInactiveCoverers(t *testing.T) {
+	setNow(t, time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC))
+	r := NewRules()
+	if err := r.FromTOML([]byte(`
+[alter_hostname]
+"www.example.com" = "x.cn"
+"*.example.com" = { sni = "x.cn", enabled = false }
+"www.example.org" = "x.cn"
+"*.example.org" = { sni = "x.cn", expires = 2026-01-01 }
+"www.example.net" = "x.cn"
+"*.example.net" = { sni = "x.cn", expires = 2027-01-01 }
+"www.example.edu" = "x.cn"
+"*.example.edu" = { sni = "x.cn", apps = ["com.example.app"] }
+"*.a.example.io" = "y.cn"
+"*.example.io" = "y.cn"
+
+[hosts]
+"*.example.com" = "192.0.2.1"
+"a*.example.com" = { ip = "192.0.2.2", enabled = false }
+`)); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := []string{"www.example.com", "www.example.org", "www.example.net", "www.example.edu", "x.a.example.io", "abc.example.com"}
+	before := make(map[string][2]string)
+	for _, h := range hosts {
+		alt, _ := r.GetAlterHostname(h)
+		ip, _ := r.GetHost(h)
+		before[h] = [2]string{alt, ip}
+	}
+
+	removed := make(map[string]bool)
+	for _, f := range r.Compact() {
+		removed[f.Key] = true
+	}
+	// Only the permanent *.example.io covers *.a.example.io; the disabled
+	// hosts rule is kept although *.example.com matches first.
+	if len(removed) != 1 || !removed["*.a.example.io"] {
+		t.Errorf("Compact() removed %v, want only *.a.example.io", removed)
+	}
+
+	for _, h := range hosts {
+		alt, _ := r.GetAlterHostname(h)
+		ip, _ := r.GetHost(h)
+		if got := [2]string{alt, ip}; got != before[h] {
+			t.Errorf("lookup of %s changed from %q to %q", h, before[h], got)
+		}
+	}
+	// The expiring rule leaves www.example.net to its own rule afterwards.
+	setNow(t, time.Date(2027, 6, 1, 0, 0, 0, 0, time.UTC))
+	if got, ok := r.GetAlterHostname("www.example.net"); !ok || got != "x.cn" {
+		t.Errorf("after expiry: %q, %v", got, ok)
+	}
+}
@@ -0,0 +1,125 @@
+package rules
+
+import "slices"
+
+// LookupContext describes a connection for a rule lookup. Rules scoped to
+// applications (see RuleMeta.Apps) match only connections of those
+// applications and take precedence over global rules; when none matches, the
+// lookup falls back to the global rules.
+type LookupContext struct {
+	Host string
+	// Port is the destination port; 0 means unknown, in which case only
+	// port-less rules apply.
+	Port int
+	// App identifies the application that opened the connection: its package
+	// name on Android, its executable path on desktop. Empty means unknown, in
+	// which case only global rules apply.
+	App string
+}
+
+// LookupAlterHostnameContext returns the target SNI for a connection, or false
+// if no rule matches.
+func (r *Rules) LookupAlterHostnameContext(ctx LookupContext) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return lookup(r.AlterHostname, r.alterHostnameRules, ctx)
+}
+
+// LookupHostContext returns the mapped IP for a connection, or false if no
+// rule matches.
+func (r *Rules) LookupHostContext(ctx LookupContext) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return lookup(r.Hosts, r.hostsRules, ctx)
+}
+
+// LookupCertVerifyContext returns the certificate verification policy for a
+// connection, or false if no rule matches.
+func (r *Rules) LookupCertVerifyContext(ctx LookupContext) (CertPolicy, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	val, ok := lookup(r.CertVerify, r.certVerifyRules, ctx)
+	if !ok {
+		return CertPolicy{}, false
+	}
+	p, _ := ParseCertPolicy(val)
+	return p, true
+}
+
+// LookupKeyContext returns the key of the rule that the section's
+// LookupContext method uses for a connection, or false if no rule matches.
+func (r *Rules) LookupKeyContext(section Section, ctx LookupContext) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	switch section {
+	case SectionAlterHostname:
+		return lookupKey(r.AlterHostname, r.alterHostnameRules, ctx)
+	case SectionCertVerify:
+		return lookupKey(r.CertVerify, r.certVerifyRules, ctx)
+	case SectionHosts:
+		return lookupKey(r.Hosts, r.hostsRules, ctx)
+	}
+	return "", false
+}
+
+// Apps returns every application that rules are scoped to, sorted.
+func (r *Rules) Apps() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var apps []string
+	for _, metas := range r.Meta {
+		for _, m := range metas {
+			apps = append(apps, m.Apps...)
+		}
+	}
+	slices.Sort(apps)
+	return slices.Compact(apps)
+}
+
+// Global reports whether a rule exists, currently matches and is not scoped
+// to applications, i.e. whether it applies to every connection. Exporters to
+// formats without application scoping keep only global rules.
+func (r *Rules) Global(section Section, key string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.hasKeyLocked(section, key) && r.compiledLocked(section).global(key)
+}
+
+// LookupAlterHostnameContext is Rules.LookupAlterHostnameContext for the snapshot.
+func (s *Snapshot) LookupAlterHostnameContext(ctx LookupContext) (string, bool) {
+	return lookup(s.alterHostname, s.alterHostnameRules, ctx)
+}
+
+// LookupHostContext is Rules.LookupHostContext for the snapshot.
+func (s *Snapshot) LookupHostContext(ctx LookupContext) (string, bool) {
+	return lookup(s.hosts, s.hostsRules, ctx)
+}
+
+// LookupCertVerifyContext is Rules.LookupCertVerifyContext for the snapshot.
+func (s *Snapshot) LookupCertVerifyContext(ctx LookupContext) (CertPolicy, bool) {
+	val, ok := lookup(s.certVerify, s.certVerifyRules, ctx)
+	if !ok {
+		return CertPolicy{}, false
+	}
+	p, _ := ParseCertPolicy(val)
+	return p, true
+}
+
+// LookupKeyContext is Rules.LookupKeyContext for the snapshot.
+func (s *Snapshot) LookupKeyContext(section Section, ctx LookupContext) (string, bool) {
+	switch section {
+	case SectionAlterHostname:
+		return lookupKey(s.alterHostname, s.alterHostnameRules, ctx)
+	case SectionCertVerify:
+		return lookupKey(s.certVerify, s.certVerifyRules, ctx)
+	case SectionHosts:
+		return lookupKey(s.hosts, s.hostsRules, ctx)
+	}
+	return "", false
+}
@@ -0,0 +1,122 @@
+package rules
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const appsTOML = `
+[alter_hostname]
+"*.google.com" = "www.google.com"
+"*.youtube.com" = { sni = "g.cn", apps = ["com.google.android.youtube"] }
+"www.google.com" = { sni = "chrome.example", apps = ["com.android.chrome", "/usr/bin/chromium"] }
+"mail.google.com" = { sni = "off.example", apps = ["com.android.chrome"], enabled = false }
+
+[hosts]
+"*.youtube.com" = { ip = "192.0.2.1", apps = ["com.google.android.youtube"] }
+`
+
+// Mock connections as the Android VPN and a desktop proxy would report them.
+var (
+	youtubeApp = LookupContext{App: "com.google.android.youtube"}
+	chromeApp  = LookupContext{App: "com.android.chrome"}
+	desktopApp = LookupContext{App: "/usr/bin/chromium"}
+	unknownApp = LookupContext{}
+)
+
+func at(ctx LookupContext, host string) LookupContext {
+	ctx.Host = host
+	return ctx
+}
+
+func TestLookupContext(t *testing.T) {
+	r := NewRules()
+	if err := r.FromTOML([]byte(appsTOML)); err != nil {
+		t.Fatalf("FromTOML() error = %v", err)
+	}
+	if got := r.Apps(); !slices.Equal(got, []string{"/usr/bin/chromium", "com.android.chrome", "com.google.android.youtube"}) {
+		t.Errorf("Apps() = %q", got)
+	}
+
+	tests := []struct {
+		ctx  LookupContext
+		want string
+		ok   bool
+	}{
+		{ctx: at(youtubeApp, "www.youtube.com"), want: "g.cn", ok: true},
+		{ctx: at(chromeApp, "www.youtube.com")},
+		{ctx: at(unknownApp, "www.youtube.com")},
+		// A scoped rule wins over a more specific global one.
+		{ctx: at(chromeApp, "www.google.com"), want: "chrome.example", ok: true},
+		{ctx: at(desktopApp, "www.google.com"), want: "chrome.example", ok: true},
+		// Other apps fall back to the global rules.
+		{ctx: at(youtubeApp, "www.google.com"), want: "www.google.com", ok: true},
+		{ctx: at(unknownApp, "www.google.com"), want: "www.google.com", ok: true},
+		// Disabled scoped rules fall back too.
+		{ctx: at(chromeApp, "mail.google.com"), want: "www.google.com", ok: true},
+	}
+	s := r.Snapshot()
+	for _, tt := range tests {
+		if got, ok := r.LookupAlterHostnameContext(tt.ctx); got != tt.want || ok != tt.ok {
+			t.Errorf("LookupAlterHostnameContext(%+v) = %q, %v; want %q, %v", tt.ctx, got, ok, tt.want, tt.ok)
+		}
+		if got, ok := s.LookupAlterHostnameContext(tt.ctx); got != tt.want || ok != tt.ok {
+			t.Errorf("Snapshot.LookupAlterHostnameContext(%+v) = %q, %v", tt.ctx, got, ok)
+		}
+	}
+
+	if got, ok := r.GetAlterHostname("www.youtube.com"); ok {
+		t.Errorf("GetAlterHostname() matched an app-scoped rule: %q", got)
+	}
+	if got, _ := r.LookupHostContext(at(youtubeApp, "m.youtube.com")); got != "192.0.2.1" {
+		t.Errorf("LookupHostContext() = %q", got)
+	}
+	if k, _ := r.LookupKeyContext(SectionAlterHostname, at(chromeApp, "www.google.com")); k != "www.google.com" {
+		t.Errorf("LookupKeyContext() = %q", k)
+	}
+	if r.Global(SectionAlterHostname, "*.youtube.com") || !r.Global(SectionAlterHostname, "*.google.com") {
+		t.Error("Global() misreports app scoping")
+	}
+}
+
+func TestLookupContextFormats(t *testing.T) {
+	r := NewRules()
+	if err := r.FromTOML([]byte(appsTOML)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := r.ToTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"*.youtube.com" = { sni = "g.cn", apps = ["com.google.android.youtube"] }`; !strings.Contains(string(data), want) {
+		t.Errorf("ToTOML() lacks %s:\n%s", want, data)
+	}
+
+	data, err = r.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"apps":["com.google.android.youtube"]`) {
+		t.Errorf("ToJSON() = %s", data)
+	}
+	back := NewRules()
+	if err := back.FromJSON(data); err != nil {
+		t.Fatalf("FromJSON() error = %v", err)
+	}
+	if got, _ := back.LookupAlterHostnameContext(at(youtubeApp, "www.youtube.com")); got != "g.cn" {
+		t.Errorf("JSON round trip lost the scope: %q", got)
+	}
+	if _, ok := back.GetAlterHostname("www.youtube.com"); ok {
+		t.Error("JSON round trip made a scoped rule global")
+	}
+
+	var b strings.Builder
+	if n, _, err := r.ToHostsFile(&b); err != nil || n != 0 || strings.Contains(b.String(), "192.0.2.1") {
+		t.Errorf("ToHostsFile() = %q, %v", b.String(), err)
+	}
+	if err := NewRules().FromTOML([]byte("[hosts]\n\"a.example\" = { ip = \"192.0.2.1\", apps = \"x\" }\n")); err == nil {
+		t.Error("FromTOML() with apps not a list succeeded")
+	}
+}
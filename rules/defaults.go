@@ -7,6 +7,11 @@ import _ "embed"
 //go:embed fetched.toml
 var FetchedRulesTOML string
 
+// FetchedRulesVersion is the update version of FetchedRulesTOML (see
+// rules/update): an installed update replaces the embedded rules only if its
+// version is higher. Increase it whenever fetched.toml is regenerated.
+const FetchedRulesVersion = 2
+
 // DefaultRulesTOML contains built-in default rules shipped with the program.
 // These rules override fetched rules and can be updated with app releases.
 //
@@ -0,0 +1,218 @@
+package rules
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/xihale/snirect-shared/pattern"
+)
+
+// ChangeKind classifies a Change.
+type ChangeKind string
+
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeRemoved ChangeKind = "removed"
+	ChangeChanged ChangeKind = "changed"
+)
+
+// Change is a key added, removed or given a new value.
+type Change struct {
+	Section Section    `json:"section"`
+	Key     string     `json:"key"`
+	Kind    ChangeKind `json:"kind"`
+	// Old is the previous value (removed and changed keys).
+	Old any `json:"old,omitempty"`
+	// New is the current value (added and changed keys).
+	New any `json:"new,omitempty"`
+}
+
+// HostImpact is a sample host whose lookup result differs between the rule sets.
+type HostImpact struct {
+	Host    string  `json:"host"`
+	Section Section `json:"section"`
+	// OldKey and NewKey are the matching rules, empty if none matched.
+	OldKey string `json:"old_key,omitempty"`
+	NewKey string `json:"new_key,omitempty"`
+	Old    any    `json:"old,omitempty"`
+	New    any    `json:"new,omitempty"`
+}
+
+// DiffReport is the result of Diff. Changes are sorted by section and key;
+// Impact is filled by Estimate. String renders the report for review, and it
+// marshals to JSON for tools.
+type DiffReport struct {
+	Changes []Change `json:"changes"`
+	// Sampled is the number of hosts passed to Estimate.
+	Sampled int          `json:"sampled,omitempty"`
+	Impact  []HostImpact `json:"impact,omitempty"`
+
+	old, new *Rules
+}
+
+// Diff compares two rule sets key by key. Values are compared as stored, so a
+// cert_verify policy written as "strict" differs from true. Rules with metadata
+// are compared in the extended form, so disabling a rule is a change.
+func Diff(a, b *Rules) *DiffReport {
+	d := &DiffReport{Changes: []Change{}, old: a, new: b}
+	for _, section := range Sections {
+		av, bv := a.ruleValues(section), b.ruleValues(section)
+		keys := slices.Concat(a.Keys(section), b.Keys(section))
+		slices.Sort(keys)
+		for _, k := range slices.Compact(keys) {
+			old, inOld := av[k]
+			cur, inNew := bv[k]
+			switch {
+			case !inOld:
+				d.Changes = append(d.Changes, Change{Section: section, Key: k, Kind: ChangeAdded, New: cur})
+			case !inNew:
+				d.Changes = append(d.Changes, Change{Section: section, Key: k, Kind: ChangeRemoved, Old: old})
+			case !reflect.DeepEqual(old, cur):
+				d.Changes = append(d.Changes, Change{Section: section, Key: k, Kind: ChangeChanged, Old: old, New: cur})
+			}
+		}
+	}
+	return d
+}
+
+// Empty reports whether the rule sets have the same keys and values.
+func (d *DiffReport) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+// Estimate looks up every sample host (ignoring ports) in both rule sets and
+// records the hosts whose result changed, replacing any earlier estimate. Use
+// SampleHosts for a sample derived from the rules themselves.
+func (d *DiffReport) Estimate(hosts []string) []HostImpact {
+	d.Sampled, d.Impact = len(hosts), nil
+	oldValues := make(map[Section]map[string]any)
+	newValues := make(map[Section]map[string]any)
+	for _, section := range Sections {
+		oldValues[section], newValues[section] = d.old.ruleValues(section), d.new.ruleValues(section)
+	}
+
+	for _, host := range hosts {
+		for _, section := range Sections {
+			oldKey, oldOK := d.old.LookupKey(section, host, 0)
+			newKey, newOK := d.new.LookupKey(section, host, 0)
+			old, cur := oldValues[section][oldKey], newValues[section][newKey]
+			if oldOK == newOK && reflect.DeepEqual(old, cur) {
+				continue
+			}
+			d.Impact = append(d.Impact, HostImpact{Host: host, Section: section, OldKey: oldKey, NewKey: newKey, Old: old, New: cur})
+		}
+	}
+	return d.Impact
+}
+
+// affectedHosts counts the distinct hosts in Impact.
+func (d *DiffReport) affectedHosts() int {
+	hosts := make(map[string]bool)
+	for _, i := range d.Impact {
+		hosts[i.Host] = true
+	}
+	return len(hosts)
+}
+
+// Summary describes the diff in one line, e.g. for a "rules updated" notification.
+func (d *DiffReport) Summary() string {
+	if d.Empty() {
+		return "no rule changes"
+	}
+	counts := make(map[ChangeKind]int)
+	for _, c := range d.Changes {
+		counts[c.Kind]++
+	}
+	s := fmt.Sprintf("%d added, %d removed, %d changed", counts[ChangeAdded], counts[ChangeRemoved], counts[ChangeChanged])
+	if d.Sampled > 0 {
+		s += fmt.Sprintf("; %d of %d sample hosts affected", d.affectedHosts(), d.Sampled)
+	}
+	return s
+}
+
+// String renders the diff for review: the summary, the changes grouped by
+// section, and the affected sample hosts.
+func (d *DiffReport) String() string {
+	var b strings.Builder
+	b.WriteString(d.Summary())
+	b.WriteByte('\n')
+
+	var section Section
+	for _, c := range d.Changes {
+		if c.Section != section {
+			section = c.Section
+			fmt.Fprintf(&b, "[%s]\n", section)
+		}
+		switch c.Kind {
+		case ChangeAdded:
+			fmt.Fprintf(&b, "+ %q = %s\n", c.Key, formatDiffValue(c.New))
+		case ChangeRemoved:
+			fmt.Fprintf(&b, "- %q = %s\n", c.Key, formatDiffValue(c.Old))
+		default:
+			fmt.Fprintf(&b, "~ %q: %s -> %s\n", c.Key, formatDiffValue(c.Old), formatDiffValue(c.New))
+		}
+	}
+
+	if len(d.Impact) > 0 {
+		b.WriteString("affected sample hosts:\n")
+		for _, i := range d.Impact {
+			fmt.Fprintf(&b, "  %s %s: %s -> %s\n", i.Host, i.Section, formatImpact(i.OldKey, i.Old), formatImpact(i.NewKey, i.New))
+		}
+	}
+	return b.String()
+}
+
+func formatImpact(key string, v any) string {
+	if key == "" {
+		return "no rule"
+	}
+	return fmt.Sprintf("%s (%q)", formatDiffValue(v), key)
+}
+
+// formatDiffValue renders a rule value: strings quoted, lists in brackets and
+// extended rules as TOML inline tables.
+func formatDiffValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case map[string]any:
+		if s, err := tomlValue(v); err == nil {
+			return s
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// ruleValues is values with the rules that have metadata in the extended form.
+func (r *Rules) ruleValues(section Section) map[string]any {
+	values := r.values(section)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for k, m := range r.Meta[section] {
+		if v, ok := values[k]; ok {
+			values[k] = extendedValue(section, v, m)
+		}
+	}
+	return values
+}
+
+// SampleHosts returns sorted example hosts for the keys of the given rule sets
+// (see pattern.Pattern.Examples), a sample for DiffReport.Estimate that covers
+// every rule on either side.
+func SampleHosts(rs ...*Rules) []string {
+	var hosts []string
+	for _, r := range rs {
+		for _, section := range Sections {
+			for _, k := range r.Keys(section) {
+				if p, err := pattern.Compile(k); err == nil {
+					hosts = append(hosts, p.Examples()...)
+				}
+			}
+		}
+	}
+	slices.Sort(hosts)
+	return slices.Compact(hosts)
+}
@@ -0,0 +1,90 @@
+package rules
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a := NewRules()
+	a.AlterHostname["*.example.com"] = "front.example.net"
+	a.AlterHostname["*github.com"] = "g"
+	a.Hosts["*.example.com"] = "192.0.2.1"
+	a.CertVerify["*.example.com"] = []any{"front.example.net"}
+	a.Init()
+
+	b := a.DeepCopy()
+	b.AlterHostname["*.example.com"] = "other.example.net"
+	delete(b.AlterHostname, "*github.com")
+	b.AlterHostname["api.github.com"] = ""
+	b.CertVerify["*.example.com"] = []any{"front.example.net"}
+	b.Init()
+
+	d := Diff(a, b)
+	want := []Change{
+		{Section: SectionAlterHostname, Key: "*.example.com", Kind: ChangeChanged, Old: "front.example.net", New: "other.example.net"},
+		{Section: SectionAlterHostname, Key: "*github.com", Kind: ChangeRemoved, Old: "g"},
+		{Section: SectionAlterHostname, Key: "api.github.com", Kind: ChangeAdded, New: ""},
+	}
+	if !slices.EqualFunc(d.Changes, want, func(x, y Change) bool { return x == y }) {
+		t.Errorf("Diff() = %+v, want %+v", d.Changes, want)
+	}
+	if !Diff(a, a.DeepCopy()).Empty() {
+		t.Error("Diff() of a copy is not empty")
+	}
+
+	impact := d.Estimate([]string{"www.example.com", "api.github.com", "www.github.com", "unrelated.org"})
+	wantImpact := []HostImpact{
+		{Host: "www.example.com", Section: SectionAlterHostname, OldKey: "*.example.com", NewKey: "*.example.com", Old: "front.example.net", New: "other.example.net"},
+		{Host: "api.github.com", Section: SectionAlterHostname, OldKey: "*github.com", NewKey: "api.github.com", Old: "g", New: ""},
+		{Host: "www.github.com", Section: SectionAlterHostname, OldKey: "*github.com", Old: "g"},
+	}
+	if !slices.Equal(impact, wantImpact) {
+		t.Errorf("Estimate() = %+v, want %+v", impact, wantImpact)
+	}
+
+	if got, want := d.Summary(), "1 added, 1 removed, 1 changed; 3 of 4 sample hosts affected"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+	text := d.String()
+	for _, line := range []string{
+		"[alter_hostname]\n",
+		`~ "*.example.com": "front.example.net" -> "other.example.net"`,
+		`- "*github.com" = "g"`,
+		`+ "api.github.com" = ""`,
+		`www.github.com alter_hostname: "g" ("*github.com") -> no rule`,
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("String() lacks %q:\n%s", line, text)
+		}
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var back struct {
+		Changes []Change
+		Sampled int
+		Impact  []HostImpact
+	}
+	if err := json.Unmarshal(data, &back); err != nil || len(back.Changes) != 3 || back.Sampled != 4 || len(back.Impact) != 3 {
+		t.Errorf("JSON round trip = %+v, %v\n%s", back, err, data)
+	}
+}
+
+func TestSampleHosts(t *testing.T) {
+	r := NewRules()
+	r.AlterHostname["*.example.com"] = ""
+	r.Hosts["exact.example.org"] = "192.0.2.1"
+	r.Init()
+	hosts := SampleHosts(r, r)
+	if !slices.IsSorted(hosts) || !slices.Contains(hosts, "exact.example.org") || !slices.Contains(hosts, "example.com") {
+		t.Errorf("SampleHosts() = %q", hosts)
+	}
+	if len(slices.Compact(slices.Clone(hosts))) != len(hosts) {
+		t.Errorf("SampleHosts() has duplicates: %q", hosts)
+	}
+}
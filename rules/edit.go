@@ -0,0 +1,548 @@
+package rules
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/xihale/snirect-shared/pattern"
+)
+
+// Document is a TOML rules file that is edited in place. Unlike ToTOML, which
+// rewrites the whole file, edits only touch the lines of the rule they change:
+// comments, commented-out examples, key order and formatting are kept.
+type Document struct {
+	lines   []string
+	newline string
+	// trailingNewline records whether the file ended with a newline.
+	trailingNewline bool
+	stmts           []statement
+}
+
+// statement is a table header or a key/value pair spanning lines [start, end).
+type statement struct {
+	header bool
+	// table is the name of a header, or the table a key belongs to ("" at the root).
+	table string
+	// path is the decoded key; dotted keys have several parts.
+	path    []string
+	keyText string
+	indent  string
+	// comment is the trailing comment of a one-line key/value, with the
+	// whitespace before it.
+	comment    string
+	start, end int
+}
+
+// ParseDocument parses a TOML rules file for editing. The file must be valid
+// TOML; rules in it are not validated.
+func ParseDocument(data []byte) (*Document, error) {
+	if err := NewRules().FromTOML(data); err != nil {
+		return nil, err
+	}
+	text := string(data)
+	d := &Document{newline: "\n"}
+	if strings.Contains(text, "\r\n") {
+		d.newline = "\r\n"
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+	if text != "" {
+		d.trailingNewline = strings.HasSuffix(text, "\n")
+		d.lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+	d.scan()
+	return d, nil
+}
+
+// Bytes returns the edited file.
+func (d *Document) Bytes() []byte {
+	s := strings.Join(d.lines, d.newline)
+	if d.trailingNewline && len(d.lines) > 0 {
+		s += d.newline
+	}
+	return []byte(s)
+}
+
+// Rules parses the edited file.
+func (d *Document) Rules() (*Rules, error) {
+	r := NewRules()
+	if err := r.FromTOML(d.Bytes()); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetAlterHostname sets the target SNI of a pattern.
+func (d *Document) SetAlterHostname(key, sni string) error {
+	return d.set(SectionAlterHostname, key, sni)
+}
+
+// SetHost sets the address of a pattern.
+func (d *Document) SetHost(key, addr string) error {
+	return d.set(SectionHosts, key, addr)
+}
+
+// SetCertVerify sets the certificate policy of a pattern: a bool, a string or
+// a list of allowed names (see ParseCertPolicy).
+func (d *Document) SetCertVerify(key string, policy any) error {
+	if names, ok := policy.([]string); ok {
+		items := make([]any, len(names))
+		for i, n := range names {
+			items[i] = n
+		}
+		policy = items
+	}
+	if _, ok := ParseCertPolicy(policy); !ok {
+		return fmt.Errorf("rules: invalid %s policy %v", SectionCertVerify, policy)
+	}
+	return d.set(SectionCertVerify, key, policy)
+}
+
+// SetRuleMeta rewrites an existing rule with new metadata, in the extended
+// form, or in the short form if meta is zero.
+func (d *Document) SetRuleMeta(section Section, key string, meta RuleMeta) error {
+	i := d.findRule(section, key)
+	if i < 0 {
+		return fmt.Errorf("rules: %s has no rule %q", section, key)
+	}
+	value, _, err := d.rule(section, i)
+	if err != nil {
+		return err
+	}
+	return d.rewrite(section, i, value, meta)
+}
+
+// SetEnabled enables or disables an existing rule.
+func (d *Document) SetEnabled(section Section, key string, enabled bool) error {
+	i := d.findRule(section, key)
+	if i < 0 {
+		return fmt.Errorf("rules: %s has no rule %q", section, key)
+	}
+	value, meta, err := d.rule(section, i)
+	if err != nil {
+		return err
+	}
+	meta.Disabled = !enabled
+	return d.rewrite(section, i, value, meta)
+}
+
+// SetTagEnabled enables or disables every rule tagged with tag and returns the
+// number of rules tagged.
+func (d *Document) SetTagEnabled(tag string, enabled bool) (int, error) {
+	n := 0
+	for _, section := range Sections {
+		// Rewriting a rule replaces one statement with one, so indexes stay valid.
+		for i, st := range d.stmts {
+			if st.header || st.table != string(section) || len(st.path) != 1 {
+				continue
+			}
+			value, meta, err := d.rule(section, i)
+			if err != nil {
+				return n, err
+			}
+			if !meta.HasTag(tag) {
+				continue
+			}
+			meta.Disabled = !enabled
+			if err := d.rewrite(section, i, value, meta); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Remove deletes a rule and reports whether it was present. Legacy "$" keys
+// count as the same rule (see Init), so both spellings are removed.
+func (d *Document) Remove(section Section, key string) bool {
+	removed := false
+	for _, k := range []string{key, "$" + key} {
+		if i := d.find(string(section), k); i >= 0 {
+			st := d.stmts[i]
+			d.lines = append(d.lines[:st.start], d.lines[st.end:]...)
+			d.scan()
+			removed = true
+		}
+	}
+	return removed
+}
+
+// SetActiveProfile selects the active profile with the root "profile" key; an
+// empty name removes the key. The profile must be defined in the document.
+func (d *Document) SetActiveProfile(name string) error {
+	i := d.find("", "profile")
+	if name == "" {
+		if i >= 0 {
+			st := d.stmts[i]
+			end := st.end
+			// Drop the blank line SetActiveProfile adds after the key.
+			if end < len(d.lines) && strings.TrimSpace(d.lines[end]) == "" && (st.start == 0 || strings.TrimSpace(d.lines[st.start-1]) == "") {
+				end++
+			}
+			d.replace(st.start, end)
+		}
+		return nil
+	}
+	profiles, err := ParseProfiles(d.Bytes())
+	if err != nil {
+		return fmt.Errorf("rules: %w", err)
+	}
+	if _, ok := profiles.Get(name); !ok {
+		return fmt.Errorf("rules: profile %q is not defined", name)
+	}
+
+	if i >= 0 {
+		st := d.stmts[i]
+		d.replace(st.start, st.end, st.indent+st.keyText+" = "+tomlString(name)+st.comment)
+		return nil
+	}
+	// Root keys must come before the first table.
+	line := "profile = " + tomlString(name)
+	for _, st := range d.stmts {
+		if st.header {
+			d.replace(st.start, st.start, line, "")
+			return nil
+		}
+	}
+	d.replace(len(d.lines), len(d.lines), line)
+	d.trailingNewline = true
+	return nil
+}
+
+// set writes key = value in section, replacing the existing rule in place,
+// with its metadata, or adding it after the last rule of the section.
+func (d *Document) set(section Section, key string, value any) error {
+	if _, err := pattern.Compile(key); err != nil {
+		return fmt.Errorf("rules: %s: %w", section, err)
+	}
+	if d.inline(string(section)) {
+		return fmt.Errorf("rules: %s is not written as a table and cannot be edited", section)
+	}
+
+	if i := d.findRule(section, key); i >= 0 {
+		_, meta, err := d.rule(section, i)
+		if err != nil {
+			return err
+		}
+		return d.rewrite(section, i, value, meta)
+	}
+
+	v, err := tomlValue(value)
+	if err != nil {
+		return fmt.Errorf("rules: %s: %q: %w", section, key, err)
+	}
+	line := tomlString(key) + " = " + v
+	h := d.header(string(section))
+	if h < 0 {
+		var add []string
+		if n := len(d.lines); n > 0 && strings.TrimSpace(d.lines[n-1]) != "" {
+			add = append(add, "")
+		}
+		add = append(add, "["+string(section)+"]", line)
+		d.replace(len(d.lines), len(d.lines), add...)
+		d.trailingNewline = true
+		return nil
+	}
+
+	// After the last rule of the section, or else after the block of lines
+	// (usually comments) directly below the header.
+	at := d.stmts[h].end
+	indent := ""
+	for _, st := range d.stmts[h+1:] {
+		if st.header {
+			break
+		}
+		if len(st.path) == 1 {
+			at, indent = st.end, st.indent
+		}
+	}
+	if at == d.stmts[h].end {
+		for at < len(d.lines) && strings.TrimSpace(d.lines[at]) != "" && !d.startsStatement(at) {
+			at++
+		}
+	}
+	d.replace(at, at, indent+line)
+	return nil
+}
+
+// rewrite replaces statement i with the rule value and metadata. The key keeps
+// its spelling, except that a legacy "$" key is rewritten without the prefix.
+// The trailing comment of a one-line rule is kept.
+func (d *Document) rewrite(section Section, i int, value any, meta RuleMeta) error {
+	st := d.stmts[i]
+	v, err := tomlValue(extendedValue(section, value, meta))
+	if err != nil {
+		return fmt.Errorf("rules: %s: %q: %w", section, st.path[0], err)
+	}
+	keyText := st.keyText
+	if key, ok := strings.CutPrefix(st.path[0], "$"); ok {
+		keyText = tomlString(key)
+	}
+	comment := st.comment
+	if st.end-st.start > 1 {
+		comment = ""
+	}
+	d.replace(st.start, st.end, st.indent+keyText+" = "+v+comment)
+	return nil
+}
+
+// rule decodes the value and metadata of statement i.
+func (d *Document) rule(section Section, i int) (any, RuleMeta, error) {
+	st := d.stmts[i]
+	var m map[string]any
+	if err := toml.Unmarshal([]byte(strings.Join(d.lines[st.start:st.end], "\n")), &m); err != nil {
+		return nil, RuleMeta{}, fmt.Errorf("rules: %s: %q: %w", section, st.path[0], err)
+	}
+	value, meta, err := parseRule(section, m[st.path[0]])
+	if err != nil {
+		return nil, RuleMeta{}, fmt.Errorf("rules: %s: %q: %w", section, st.path[0], err)
+	}
+	return value, meta, nil
+}
+
+// findRule is find for a rule key, falling back to its legacy "$" spelling.
+func (d *Document) findRule(section Section, key string) int {
+	if i := d.find(string(section), key); i >= 0 {
+		return i
+	}
+	return d.find(string(section), "$"+key)
+}
+
+// replace substitutes lines [start, end) and rescans the document.
+func (d *Document) replace(start, end int, lines ...string) {
+	d.lines = append(d.lines[:start], append(lines, d.lines[end:]...)...)
+	d.scan()
+}
+
+// find returns the index of the statement defining key in table, or -1.
+func (d *Document) find(table, key string) int {
+	for i, st := range d.stmts {
+		if !st.header && st.table == table && len(st.path) == 1 && st.path[0] == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// header returns the index of the first header of table, or -1.
+func (d *Document) header(table string) int {
+	for i, st := range d.stmts {
+		if st.header && st.table == table {
+			return i
+		}
+	}
+	return -1
+}
+
+// inline reports whether table is defined by a key at the root, as an inline
+// table or with dotted keys, rather than by a header.
+func (d *Document) inline(table string) bool {
+	for _, st := range d.stmts {
+		if !st.header && st.table == "" && st.path[0] == table {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Document) startsStatement(line int) bool {
+	for _, st := range d.stmts {
+		if st.start == line {
+			return true
+		}
+	}
+	return false
+}
+
+// scan splits the lines into statements. The document is known to be valid
+// TOML, so the scanner only tracks what it needs to find statement boundaries.
+func (d *Document) scan() {
+	d.stmts = d.stmts[:0]
+	table := ""
+	for i := 0; i < len(d.lines); {
+		line := d.lines[i]
+		trimmed := strings.TrimSpace(line)
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		switch {
+		case trimmed == "" || trimmed[0] == '#':
+			i++
+		case trimmed[0] == '[':
+			inner := strings.TrimPrefix(trimmed, "[")
+			array := strings.HasPrefix(inner, "[")
+			inner = strings.TrimPrefix(inner, "[")
+			n := scanKey(inner, ']')
+			table = strings.Join(splitKey(inner[:n]), ".")
+			if array {
+				// Arrays of tables never hold rules; keep them from matching.
+				table = "[" + table + "]"
+			}
+			d.stmts = append(d.stmts, statement{header: true, table: table, indent: indent, start: i, end: i + 1})
+			i++
+		default:
+			n := scanKey(line, '=')
+			keyText := strings.TrimSpace(line[:n])
+			end, comment := scanValue(d.lines, i, n+1)
+			d.stmts = append(d.stmts, statement{
+				table:   table,
+				path:    splitKey(keyText),
+				keyText: keyText,
+				indent:  indent,
+				comment: comment,
+				start:   i,
+				end:     end,
+			})
+			i = end
+		}
+	}
+}
+
+// scanKey returns the index of the first stop byte outside quotes in s.
+func scanKey(s string, stop byte) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == stop:
+			return i
+		}
+	}
+	return len(s)
+}
+
+// splitKey decodes a possibly dotted and quoted TOML key into its parts.
+func splitKey(s string) []string {
+	var parts []string
+	for {
+		n := scanKey(s, '.')
+		part := strings.TrimSpace(s[:n])
+		switch {
+		case strings.HasPrefix(part, `"`):
+			if u, err := strconv.Unquote(part); err == nil {
+				part = u
+			}
+		case strings.HasPrefix(part, "'"):
+			part = strings.Trim(part, "'")
+		}
+		parts = append(parts, part)
+		if n == len(s) {
+			return parts
+		}
+		s = s[n+1:]
+	}
+}
+
+// scanValue finds the end of the value starting at lines[i][col:], which may
+// span lines inside arrays, inline tables and multi-line strings. It returns
+// the line after the value and the trailing comment of its last line.
+func scanValue(lines []string, i, col int) (end int, comment string) {
+	depth := 0
+	quote := ""
+	for ; i < len(lines); i, col = i+1, 0 {
+		line := lines[i]
+		comment = ""
+	scan:
+		for j := col; j < len(line); j++ {
+			c := line[j]
+			switch {
+			case quote != "":
+				if c == '\\' && quote[0] == '"' {
+					j++
+				} else if strings.HasPrefix(line[j:], quote) {
+					j += len(quote) - 1
+					quote = ""
+				}
+			case c == '#':
+				comment = line[len(strings.TrimRight(line[:j], " \t")):]
+				break scan
+			case strings.HasPrefix(line[j:], `"""`) || strings.HasPrefix(line[j:], "'''"):
+				quote = line[j : j+3]
+				j += 2
+			case c == '"' || c == '\'':
+				quote = string(c)
+			case c == '[' || c == '{':
+				depth++
+			case c == ']' || c == '}':
+				depth--
+			}
+		}
+		if len(quote) == 1 {
+			// Single-line strings cannot continue on the next line.
+			quote = ""
+		}
+		if quote == "" && depth <= 0 {
+			return i + 1, comment
+		}
+	}
+	return len(lines), ""
+}
+
+// EditFile applies edit to the rules file at path and saves it, keeping its
+// comments and layout. A missing file starts from the UserRulesTOML template.
+// The file is replaced atomically, and only if the edited rules are valid.
+func EditFile(path string, edit func(*Document) error) error {
+	data, err := os.ReadFile(path)
+	perm := os.FileMode(0o644)
+	switch {
+	case os.IsNotExist(err):
+		data = []byte(UserRulesTOML)
+	case err != nil:
+		return fmt.Errorf("rules: %w", err)
+	default:
+		if fi, err := os.Stat(path); err == nil {
+			perm = fi.Mode().Perm()
+		}
+	}
+
+	d, err := ParseDocument(data)
+	if err != nil {
+		return fmt.Errorf("rules: %s: %w", path, err)
+	}
+	if err := edit(d); err != nil {
+		return err
+	}
+	out := d.Bytes()
+	if bytes.Equal(out, data) {
+		return nil
+	}
+	r, err := d.Rules()
+	if err == nil {
+		err = r.Validate()
+	}
+	if err != nil {
+		return fmt.Errorf("rules: %s: %w", path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("rules: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(out); err != nil {
+		tmp.Close()
+		return fmt.Errorf("rules: %w", err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("rules: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("rules: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rules: %w", err)
+	}
+	return nil
+}
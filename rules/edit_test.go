@@ -0,0 +1,206 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDocumentTemplate(t *testing.T) {
+	d, err := ParseDocument([]byte(UserRulesTOML))
+	if err != nil {
+		t.Fatalf("ParseDocument() error = %v", err)
+	}
+	if err := d.SetAlterHostname("*.pixiv.net", "pixivision.net"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetCertVerify("*bank.com", []string{"www.bank.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetHost("github.com", "20.27.177.113"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetHost("example.org", DefaultAutoMarker); err != nil {
+		t.Fatal(err)
+	}
+
+	got := string(d.Bytes())
+	// Every original line is kept, in order.
+	rest := got
+	for _, line := range strings.Split(strings.TrimSpace(UserRulesTOML), "\n") {
+		i := strings.Index(rest, line+"\n")
+		if i < 0 {
+			t.Fatalf("line %q lost or reordered:\n%s", line, got)
+		}
+		rest = rest[i+len(line)+1:]
+	}
+	for _, want := range []string{
+		"# \"example.com\" = \"__AUTO__\"\n\"*.pixiv.net\" = \"pixivision.net\"\n",
+		"\"*bank.com\" = [\"www.bank.com\"]\n",
+		"# \"store.steampowered.com\" = \"__AUTO__\"\n\"github.com\" = \"20.27.177.113\"\n\"example.org\" = \"__AUTO__\"\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+
+	r, err := d.Rules()
+	if err != nil {
+		t.Fatalf("Rules() error = %v", err)
+	}
+	if v, _ := r.GetAlterHostname("www.pixiv.net"); v != "pixivision.net" {
+		t.Errorf("GetAlterHostname() = %q", v)
+	}
+	if p, ok := r.GetCertVerify("www.bank.com"); !ok || p.Verify || len(p.Allow) != 1 {
+		t.Errorf("GetCertVerify() = %+v, %v", p, ok)
+	}
+}
+
+func TestDocumentEdit(t *testing.T) {
+	const input = `# header
+
+[alter_hostname]
+  'a.example' = "old"   # why a
+"b.example" = "b"
+
+[cert_verify]
+"*.example.com" = [
+  "one.example.com", # first
+  "two.example.com",
+]
+"$legacy.example" = false
+`
+	tests := []struct {
+		name string
+		edit func(d *Document) error
+		want string
+	}{
+		{
+			name: "replace keeps key spelling, indent and comment",
+			edit: func(d *Document) error { return d.SetAlterHostname("a.example", `n"ew`) },
+			want: "  'a.example' = \"n\\\"ew\"   # why a\n\"b.example\" = \"b\"\n",
+		},
+		{
+			name: "replace multi-line value",
+			edit: func(d *Document) error { return d.SetCertVerify("*.example.com", true) },
+			want: "[cert_verify]\n\"*.example.com\" = true\n\"$legacy.example\" = false\n",
+		},
+		{
+			name: "legacy key is rewritten",
+			edit: func(d *Document) error { return d.SetCertVerify("legacy.example", "strict") },
+			want: "\"legacy.example\" = \"strict\"\n",
+		},
+		{
+			name: "add after last rule",
+			edit: func(d *Document) error { return d.SetAlterHostname("c.example", "") },
+			want: "\"b.example\" = \"b\"\n\"c.example\" = \"\"\n\n[cert_verify]",
+		},
+		{
+			name: "add missing section",
+			edit: func(d *Document) error { return d.SetHost("c.example", "192.0.2.1") },
+			want: "\"$legacy.example\" = false\n\n[hosts]\n\"c.example\" = \"192.0.2.1\"\n",
+		},
+		{
+			name: "remove",
+			edit: func(d *Document) error {
+				if !d.Remove(SectionAlterHostname, "a.example") || !d.Remove(SectionCertVerify, "legacy.example") {
+					t.Error("Remove() = false")
+				}
+				if d.Remove(SectionHosts, "a.example") {
+					t.Error("Remove() of a missing key = true")
+				}
+				return nil
+			},
+			want: "[alter_hostname]\n\"b.example\" = \"b\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := ParseDocument([]byte(input))
+			if err != nil {
+				t.Fatalf("ParseDocument() error = %v", err)
+			}
+			if err := tt.edit(d); err != nil {
+				t.Fatalf("edit error = %v", err)
+			}
+			got := string(d.Bytes())
+			if !strings.Contains(got, tt.want) || !strings.HasPrefix(got, "# header\n") {
+				t.Errorf("output lacks %q:\n%s", tt.want, got)
+			}
+			if _, err := d.Rules(); err != nil {
+				t.Errorf("edited file does not parse: %v\n%s", err, got)
+			}
+		})
+	}
+}
+
+func TestDocumentErrors(t *testing.T) {
+	if _, err := ParseDocument([]byte("[hosts\n")); err == nil {
+		t.Error("ParseDocument() of invalid TOML succeeded")
+	}
+
+	d, err := ParseDocument([]byte("hosts = { \"a.example\" = \"192.0.2.1\" }\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetHost("b.example", "192.0.2.2"); err == nil {
+		t.Error("SetHost() into an inline table succeeded")
+	}
+	if err := d.SetAlterHostname("bad:port", "x"); err == nil {
+		t.Error("SetAlterHostname() with an invalid pattern succeeded")
+	}
+	if err := d.SetCertVerify("a.example", 42); err == nil {
+		t.Error("SetCertVerify() with an invalid policy succeeded")
+	}
+}
+
+func TestDocumentCRLF(t *testing.T) {
+	d, err := ParseDocument([]byte("[hosts]\r\n# keep\r\n\"a.example\" = \"192.0.2.1\"\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetHost("b.example", "192.0.2.2"); err != nil {
+		t.Fatal(err)
+	}
+	want := "[hosts]\r\n# keep\r\n\"a.example\" = \"192.0.2.1\"\r\n\"b.example\" = \"192.0.2.2\"\r\n"
+	if got := string(d.Bytes()); got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+}
+
+func TestEditFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.toml")
+
+	// A missing file starts from the template.
+	if err := EditFile(path, func(d *Document) error { return d.SetHost("github.com", "20.27.177.113") }); err != nil {
+		t.Fatalf("EditFile() error = %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "# Snirect 用户规则\n") || !strings.Contains(string(data), "\"github.com\" = \"20.27.177.113\"\n") {
+		t.Fatalf("new file =\n%s", data)
+	}
+
+	// A failing edit leaves the file alone.
+	err := EditFile(path, func(d *Document) error {
+		d.Remove(SectionHosts, "github.com")
+		return d.SetHost("bad:port", "192.0.2.1")
+	})
+	if err == nil {
+		t.Error("EditFile() with an invalid edit succeeded")
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(data) {
+		t.Errorf("file changed by a failed edit:\n%s", after)
+	}
+
+	if err := EditFile(path, func(d *Document) error {
+		d.Remove(SectionHosts, "github.com")
+		return nil
+	}); err != nil {
+		t.Fatalf("EditFile() error = %v", err)
+	}
+	if after, _ := os.ReadFile(path); string(after) != UserRulesTOML {
+		t.Errorf("removing the only rule did not restore the template:\n%s", after)
+	}
+}
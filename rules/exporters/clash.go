@@ -0,0 +1,69 @@
+package exporters
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/xihale/snirect-shared/pattern"
+	"github.com/xihale/snirect-shared/rules"
+)
+
+// Clash writes the keys of a section as a Clash "classical" rule provider:
+//
+//	payload:
+//	  - DOMAIN,www.example.com
+//	  - DOMAIN-SUFFIX,example.org
+//	  - DOMAIN-KEYWORD,cdn
+//	  - IP-CIDR,203.0.113.0/24,no-resolve
+//
+// Infix globs and regexes are approximated with DOMAIN-SUFFIX or DOMAIN-KEYWORD;
+// exclusions and ports are lost.
+func Clash(w io.Writer, r *rules.Rules, section rules.Section) (*Report, error) {
+	rep := &Report{}
+	var lines []string
+	seen := make(map[string]bool)
+	emit := func(line string) {
+		if !seen[line] {
+			seen[line] = true
+			lines = append(lines, line)
+		}
+	}
+
+	for _, e := range compileSection(r, section, rep) {
+		for _, alt := range e.pattern.Alternatives() {
+			if alt.Kind == pattern.AltIP {
+				typ := "IP-CIDR"
+				if alt.Prefix.Addr().Is6() {
+					typ = "IP-CIDR6"
+				}
+				emit(fmt.Sprintf("%s,%s,no-resolve", typ, alt.Prefix))
+				continue
+			}
+
+			kind, value, approx := domainRule(alt)
+			switch kind {
+			case kindDomain:
+				emit("DOMAIN," + value)
+			case kindSuffix:
+				emit("DOMAIN-SUFFIX," + value)
+			case kindKeyword:
+				emit("DOMAIN-KEYWORD," + value)
+			default:
+				rep.add(e.key, IssueUnsupported, "no Clash rule for %s", altString(alt))
+				continue
+			}
+			if approx != "" {
+				rep.add(e.key, IssueApproximated, "%s: %s", altString(alt), approx)
+			}
+		}
+		reportLost(rep, e)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "payload:")
+	for _, line := range lines {
+		fmt.Fprintf(bw, "  - %s\n", line)
+	}
+	return rep, bw.Flush()
+}
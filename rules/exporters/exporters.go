@@ -0,0 +1,161 @@
+// Package exporters writes the keys of a rule section as domain rule sets for
+// other proxy clients: Clash rule providers, Surge domain sets and sing-box
+// rule sets.
+//
+// Snirect patterns are richer than most of these formats, so every exporter
+// returns a Report listing the patterns it had to approximate or drop and the
+// exclusions and port restrictions that were lost.
+package exporters
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xihale/snirect-shared/pattern"
+	"github.com/xihale/snirect-shared/rules"
+)
+
+// IssueKind classifies a Report entry.
+type IssueKind string
+
+const (
+	// IssueApproximated: an alternative was exported as a broader or narrower rule.
+	IssueApproximated IssueKind = "approximated"
+	// IssueUnsupported: an alternative has no equivalent in the format and was dropped.
+	IssueUnsupported IssueKind = "unsupported"
+	// IssueExclusionLost: the pattern's "^" exclusions were dropped.
+	IssueExclusionLost IssueKind = "exclusion-lost"
+	// IssuePortLost: the pattern's port restriction was dropped.
+	IssuePortLost IssueKind = "port-lost"
+	// IssueSkipped: the key is disabled or not a valid pattern.
+	IssueSkipped IssueKind = "skipped"
+)
+
+// Issue is a single fidelity problem found while exporting a key.
+type Issue struct {
+	Key    string    `json:"key"`
+	Kind   IssueKind `json:"kind"`
+	Detail string    `json:"detail"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s %q: %s", i.Kind, i.Key, i.Detail)
+}
+
+// Report lists the issues of an export in key order.
+type Report struct {
+	Issues []Issue `json:"issues"`
+}
+
+// String renders the report one issue per line.
+func (rep *Report) String() string {
+	var b strings.Builder
+	for _, i := range rep.Issues {
+		b.WriteString(i.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func (rep *Report) add(key string, kind IssueKind, format string, args ...any) {
+	rep.Issues = append(rep.Issues, Issue{Key: key, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+}
+
+// entry is a compiled key of the exported section.
+type entry struct {
+	key     string
+	pattern *pattern.Pattern
+}
+
+// compileSection compiles the keys of a section in sorted order, reporting the
+// ones that never match.
+func compileSection(r *rules.Rules, section rules.Section, rep *Report) []entry {
+	var out []entry
+	for _, k := range r.Keys(section) {
+		p, err := pattern.Compile(k)
+		switch {
+		case err != nil:
+			rep.add(k, IssueSkipped, "%v", err)
+		case p.Ignored():
+			rep.add(k, IssueSkipped, "disabled by an ignore prefix")
+		case !r.Active(section, k):
+			rep.add(k, IssueSkipped, "disabled or expired")
+		case !r.Global(section, k):
+			rep.add(k, IssueSkipped, "scoped to applications")
+		default:
+			out = append(out, entry{key: k, pattern: p})
+		}
+	}
+	return out
+}
+
+// reportLost records the exclusions and port restriction a format without
+// negation or ports cannot keep.
+func reportLost(rep *Report, e entry) {
+	if ex := e.pattern.Exclusions(); len(ex) > 0 {
+		names := make([]string, len(ex))
+		for i, p := range ex {
+			names[i] = p.String()
+		}
+		rep.add(e.key, IssueExclusionLost, "exported without excluding %s", strings.Join(names, ", "))
+	}
+	if lo, hi := e.pattern.Ports(); lo != 0 {
+		rep.add(e.key, IssuePortLost, "exported for every port instead of %s", portRange(lo, hi))
+	}
+}
+
+// ruleKind is the target rule type of a domain alternative.
+type ruleKind int
+
+const (
+	kindNone    ruleKind = iota
+	kindDomain           // exactly this host
+	kindSuffix           // this domain and its subdomains
+	kindKeyword          // any host containing the value
+)
+
+// domainRule maps a non-IP alternative onto the closest of the common domain rule
+// types. approx describes how the rule differs from the alternative, or is empty
+// if it is exact.
+func domainRule(alt pattern.Alternative) (kind ruleKind, value, approx string) {
+	switch alt.Kind {
+	case pattern.AltExact:
+		return kindDomain, alt.Host, ""
+	case pattern.AltSuffix:
+		return kindSuffix, alt.Host, ""
+	case pattern.AltGlob:
+		// "*example.com" ends in example.com at any point, even mid-label.
+		if rest, ok := strings.CutPrefix(alt.Glob, "*"); ok && rest == alt.Literal && strings.Contains(rest, ".") && !strings.HasPrefix(rest, ".") {
+			return kindSuffix, rest, fmt.Sprintf("narrower: only %s and its subdomains, not other hosts ending in %q", rest, rest)
+		}
+	case pattern.AltRegex:
+		if rest, ok := strings.CutPrefix(alt.Literal, "."); ok && strings.Contains(rest, ".") {
+			return kindSuffix, rest, fmt.Sprintf("broader: every host under %s", rest)
+		}
+	default:
+		return kindNone, "", ""
+	}
+
+	if keyword := strings.Trim(alt.Literal, "."); len(keyword) >= 3 {
+		return kindKeyword, keyword, fmt.Sprintf("broader: every host containing %q", keyword)
+	}
+	return kindNone, "", ""
+}
+
+func portRange(lo, hi int) string {
+	if lo == hi {
+		return fmt.Sprintf("port %d", lo)
+	}
+	return fmt.Sprintf("ports %d-%d", lo, hi)
+}
+
+// altString renders an alternative for messages.
+func altString(alt pattern.Alternative) string {
+	switch alt.Kind {
+	case pattern.AltIP:
+		return alt.Prefix.String()
+	case pattern.AltRegex:
+		return alt.Regexp
+	}
+	return alt.Glob
+}
@@ -0,0 +1,135 @@
+package exporters
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/xihale/snirect-shared/rules"
+)
+
+func testRules() *rules.Rules {
+	r := rules.NewRules()
+	r.AlterHostname["www.example.com"] = "a"
+	r.AlterHostname["*.example.org"] = "a"
+	r.AlterHostname["*pixiv.net"] = "a"
+	r.AlterHostname["cdn*.example.net"] = "a"
+	r.AlterHostname["*.yahoo.com^*.media.yahoo.com"] = "a"
+	r.AlterHostname["*.example.io:443"] = "a"
+	r.AlterHostname["203.0.113.0/24"] = "a"
+	r.AlterHostname[`/img[0-9]+\.example\.dev/`] = "a"
+	r.AlterHostname["#*.disabled.com"] = "a"
+	r.Init()
+	return r
+}
+
+// hasIssue reports whether rep has an issue of kind for key.
+func hasIssue(rep *Report, key string, kind IssueKind) bool {
+	for _, i := range rep.Issues {
+		if i.Key == key && i.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func TestClash(t *testing.T) {
+	var buf bytes.Buffer
+	rep, err := Clash(&buf, testRules(), rules.SectionAlterHostname)
+	if err != nil {
+		t.Fatalf("Clash() error = %v", err)
+	}
+	want := `payload:
+  - DOMAIN-SUFFIX,example.io
+  - DOMAIN-SUFFIX,example.org
+  - DOMAIN-SUFFIX,yahoo.com
+  - DOMAIN-SUFFIX,pixiv.net
+  - DOMAIN-SUFFIX,example.dev
+  - IP-CIDR,203.0.113.0/24,no-resolve
+  - DOMAIN-KEYWORD,example.net
+  - DOMAIN,www.example.com
+`
+	if buf.String() != want {
+		t.Errorf("Clash() wrote:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	for _, w := range []struct {
+		key  string
+		kind IssueKind
+	}{
+		{"*pixiv.net", IssueApproximated},
+		{"cdn*.example.net", IssueApproximated},
+		{`/img[0-9]+\.example\.dev/`, IssueApproximated},
+		{"*.yahoo.com^*.media.yahoo.com", IssueExclusionLost},
+		{"*.example.io:443", IssuePortLost},
+		{"#*.disabled.com", IssueSkipped},
+	} {
+		if !hasIssue(rep, w.key, w.kind) {
+			t.Errorf("missing %s issue for %q in:\n%s", w.kind, w.key, rep)
+		}
+	}
+	if len(rep.Issues) != 6 {
+		t.Errorf("Clash() reported %d issues, want 6:\n%s", len(rep.Issues), rep)
+	}
+}
+
+func TestSurge(t *testing.T) {
+	var buf bytes.Buffer
+	rep, err := Surge(&buf, testRules(), rules.SectionAlterHostname)
+	if err != nil {
+		t.Fatalf("Surge() error = %v", err)
+	}
+	want := ".example.io\n.example.org\n.yahoo.com\n.pixiv.net\n.example.dev\nwww.example.com\n"
+	if buf.String() != want {
+		t.Errorf("Surge() wrote %q, want %q", buf.String(), want)
+	}
+	if !hasIssue(rep, "cdn*.example.net", IssueUnsupported) || !hasIssue(rep, "203.0.113.0/24", IssueUnsupported) {
+		t.Errorf("Surge() should report keyword globs and IP ranges as unsupported:\n%s", rep)
+	}
+}
+
+func TestSingBox(t *testing.T) {
+	var buf bytes.Buffer
+	rep, err := SingBox(&buf, testRules(), rules.SectionAlterHostname)
+	if err != nil {
+		t.Fatalf("SingBox() error = %v", err)
+	}
+	if len(rep.Issues) != 1 || !hasIssue(rep, "#*.disabled.com", IssueSkipped) {
+		t.Errorf("SingBox() should be exact apart from disabled keys:\n%s", rep)
+	}
+
+	var set singBoxRuleSet
+	if err := json.Unmarshal(buf.Bytes(), &set); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, buf.String())
+	}
+	if set.Version != singBoxVersion || len(set.Rules) != 3 {
+		t.Fatalf("rule set = %+v, want version %d with 3 rules", set, singBoxVersion)
+	}
+
+	plain := set.Rules[0]
+	if strings.Join(plain.Domain, ",") != "www.example.com" ||
+		strings.Join(plain.DomainSuffix, ",") != "example.org" ||
+		strings.Join(plain.IPCIDR, ",") != "203.0.113.0/24" ||
+		len(plain.DomainRegex) != 3 {
+		t.Errorf("plain rule = %+v", plain)
+	}
+	for _, expr := range plain.DomainRegex {
+		re := regexp.MustCompile(expr)
+		if re.MatchString("www.example.com") {
+			t.Errorf("regex %s matches an unrelated host", expr)
+		}
+	}
+
+	ported := set.Rules[1]
+	if strings.Join(ported.PortRange, ",") != "443:443" || strings.Join(ported.DomainSuffix, ",") != "example.io" {
+		t.Errorf("port rule = %+v", ported)
+	}
+
+	logical := set.Rules[2]
+	if logical.Type != "logical" || logical.Mode != "and" || len(logical.Rules) != 2 ||
+		!logical.Rules[1].Invert || logical.Rules[1].DomainSuffix[0] != "media.yahoo.com" {
+		t.Errorf("exclusion rule = %+v", logical)
+	}
+}
@@ -0,0 +1,110 @@
+package exporters
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/xihale/snirect-shared/pattern"
+	"github.com/xihale/snirect-shared/rules"
+)
+
+// singBoxVersion is the rule-set source format version written by SingBox.
+const singBoxVersion = 2
+
+// singBoxRule is a sing-box headless rule: a default rule with match fields,
+// or a logical rule combining sub-rules.
+type singBoxRule struct {
+	Type         string        `json:"type,omitempty"`
+	Mode         string        `json:"mode,omitempty"`
+	Rules        []singBoxRule `json:"rules,omitempty"`
+	Domain       []string      `json:"domain,omitempty"`
+	DomainSuffix []string      `json:"domain_suffix,omitempty"`
+	DomainRegex  []string      `json:"domain_regex,omitempty"`
+	IPCIDR       []string      `json:"ip_cidr,omitempty"`
+	PortRange    []string      `json:"port_range,omitempty"`
+	Invert       bool          `json:"invert,omitempty"`
+}
+
+type singBoxRuleSet struct {
+	Version int           `json:"version"`
+	Rules   []singBoxRule `json:"rules"`
+}
+
+// SingBox writes the keys of a section as a sing-box source rule set (JSON).
+// sing-box supports regexes, ports and inverted sub-rules, so every pattern is
+// exported exactly: globs become domain_regex entries, and patterns with
+// exclusions become logical "and" rules with inverted exclusion rules. A
+// domain_suffix entry "example.com" matches example.com and its subdomains.
+func SingBox(w io.Writer, r *rules.Rules, section rules.Section) (*Report, error) {
+	rep := &Report{}
+	set := singBoxRuleSet{Version: singBoxVersion}
+
+	// Patterns without exclusions or ports share one rule.
+	var plain singBoxRule
+	for _, e := range compileSection(r, section, rep) {
+		lo, _ := e.pattern.Ports()
+		exclusions := e.pattern.Exclusions()
+		if lo == 0 && len(exclusions) == 0 {
+			addSingBoxAlternatives(&plain, e.pattern)
+			continue
+		}
+
+		include := singBoxTerm(e.pattern, false)
+		if len(exclusions) == 0 {
+			set.Rules = append(set.Rules, include)
+			continue
+		}
+		logical := singBoxRule{Type: "logical", Mode: "and", Rules: []singBoxRule{include}}
+		for _, ex := range exclusions {
+			logical.Rules = append(logical.Rules, singBoxTerm(ex, true))
+		}
+		set.Rules = append(set.Rules, logical)
+	}
+	if !plain.empty() {
+		set.Rules = append([]singBoxRule{plain}, set.Rules...)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return rep, enc.Encode(set)
+}
+
+// singBoxTerm converts the include term of p into a default rule.
+func singBoxTerm(p *pattern.Pattern, invert bool) singBoxRule {
+	var rule singBoxRule
+	addSingBoxAlternatives(&rule, p)
+	if lo, hi := p.Ports(); lo != 0 {
+		rule.PortRange = []string{fmt.Sprintf("%d:%d", lo, hi)}
+	}
+	rule.Invert = invert
+	return rule
+}
+
+// addSingBoxAlternatives adds the include alternatives of p to rule's match fields.
+func addSingBoxAlternatives(rule *singBoxRule, p *pattern.Pattern) {
+	for _, alt := range p.Alternatives() {
+		switch alt.Kind {
+		case pattern.AltExact:
+			rule.Domain = appendUnique(rule.Domain, alt.Host)
+		case pattern.AltSuffix:
+			rule.DomainSuffix = appendUnique(rule.DomainSuffix, alt.Host)
+		case pattern.AltIP:
+			rule.IPCIDR = appendUnique(rule.IPCIDR, alt.Prefix.String())
+		default:
+			rule.DomainRegex = appendUnique(rule.DomainRegex, alt.Regexp)
+		}
+	}
+}
+
+func (r singBoxRule) empty() bool {
+	return len(r.Domain) == 0 && len(r.DomainSuffix) == 0 && len(r.DomainRegex) == 0 && len(r.IPCIDR) == 0
+}
+
+func appendUnique(s []string, v string) []string {
+	if slices.Contains(s, v) {
+		return s
+	}
+	return append(s, v)
+}
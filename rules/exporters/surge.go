@@ -0,0 +1,51 @@
+package exporters
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/xihale/snirect-shared/rules"
+)
+
+// Surge writes the keys of a section as a Surge domain set: one host per line,
+// with a leading dot for a domain and its subdomains. Infix globs are
+// approximated by their domain; keyword-only globs, regexes without a literal
+// domain suffix and IP ranges cannot be expressed, and exclusions and ports are
+// lost.
+func Surge(w io.Writer, r *rules.Rules, section rules.Section) (*Report, error) {
+	rep := &Report{}
+	var lines []string
+	seen := make(map[string]bool)
+	emit := func(line string) {
+		if !seen[line] {
+			seen[line] = true
+			lines = append(lines, line)
+		}
+	}
+
+	for _, e := range compileSection(r, section, rep) {
+		for _, alt := range e.pattern.Alternatives() {
+			kind, value, approx := domainRule(alt)
+			switch kind {
+			case kindDomain:
+				emit(value)
+			case kindSuffix:
+				emit("." + value)
+			default:
+				rep.add(e.key, IssueUnsupported, "no domain-set entry for %s", altString(alt))
+				continue
+			}
+			if approx != "" {
+				rep.add(e.key, IssueApproximated, "%s: %s", altString(alt), approx)
+			}
+		}
+		reportLost(rep, e)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, line := range lines {
+		fmt.Fprintln(bw, line)
+	}
+	return rep, bw.Flush()
+}
@@ -0,0 +1,109 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/xihale/snirect-shared/pattern"
+)
+
+// FromHostsFile parses an /etc/hosts style file and replaces the hosts map with
+// it. Each line holds an IPv4 or IPv6 address followed by one or more names;
+// "#" starts a comment. A name listed twice keeps its last address.
+func (r *Rules) FromHostsFile(rd io.Reader) error {
+	hosts := make(map[string]string)
+
+	sc := bufio.NewScanner(rd)
+	line := 0
+	for sc.Scan() {
+		line++
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if _, err := netip.ParseAddr(fields[0]); err != nil {
+			return fmt.Errorf("hosts file line %d: invalid address %q", line, fields[0])
+		}
+		if len(fields) == 1 {
+			return fmt.Errorf("hosts file line %d: no names for %s", line, fields[0])
+		}
+		for _, name := range fields[1:] {
+			hosts[name] = fields[0]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("hosts file: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Hosts = hosts
+	r.initLocked()
+	return nil
+}
+
+// ToHostsFile writes the hosts map in /etc/hosts format, one line per address
+// with its names sorted. Only literal hostnames mapped to an IP address can be
+// expressed; the keys of wildcard, regex, IP, port-restricted and excluding
+// patterns, and of non-address values such as __AUTO__ or a hostname, are
+// returned as skipped. Disabled, expired and application-scoped rules are left
+// out. written is the number of names written.
+func (r *Rules) ToHostsFile(w io.Writer) (written int, skipped []string, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	byAddr := make(map[netip.Addr][]string)
+	for k, v := range r.Hosts {
+		if !r.hostsRules.global(k) {
+			continue
+		}
+		name, ok := hostsFileName(k)
+		addr, err := netip.ParseAddr(strings.Trim(v, "[]")) // values may bracket IPv6
+		if !ok || err != nil {
+			skipped = append(skipped, k)
+			continue
+		}
+		byAddr[addr] = append(byAddr[addr], name)
+	}
+	slices.Sort(skipped)
+
+	addrs := make([]netip.Addr, 0, len(byAddr))
+	for addr := range byAddr {
+		addrs = append(addrs, addr)
+	}
+	slices.SortFunc(addrs, func(a, b netip.Addr) int { return a.Compare(b) })
+
+	bw := bufio.NewWriter(w)
+	for _, addr := range addrs {
+		names := slices.Compact(slices.Sorted(slices.Values(byAddr[addr])))
+		fmt.Fprintf(bw, "%s %s\n", addr, strings.Join(names, " "))
+		written += len(names)
+	}
+	return written, skipped, bw.Flush()
+}
+
+// hostsFileName returns the hostname a hosts key stands for if the key is a
+// literal hostname without a port.
+func hostsFileName(key string) (string, bool) {
+	p, err := pattern.Compile(key)
+	if err != nil || p.Ignored() || len(p.Exclusions()) > 0 {
+		return "", false
+	}
+	if lo, _ := p.Ports(); lo != 0 {
+		return "", false
+	}
+	if p.Specificity().Tier != pattern.TierExact {
+		return "", false
+	}
+	name := pattern.NormalizeHost(canonicalKey(key))
+	if _, err := netip.ParseAddr(name); err == nil || name == "" {
+		return "", false // an IP key matches connections, not names
+	}
+	return name, true
+}
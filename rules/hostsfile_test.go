@@ -0,0 +1,86 @@
+package rules
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFromHostsFile(t *testing.T) {
+	const hostsFile = `# hand-tuned hosts
+127.0.0.1	localhost
+104.16.1.1 example.com www.example.com   # trailing comment
+2001:db8::1 ipv6.example.com
+  
+104.16.1.2 example.com
+`
+	r := NewRules()
+	r.Hosts["old.example.com"] = "192.0.2.1"
+	if err := r.FromHostsFile(strings.NewReader(hostsFile)); err != nil {
+		t.Fatalf("FromHostsFile() error = %v", err)
+	}
+	want := map[string]string{
+		"localhost":        "127.0.0.1",
+		"example.com":      "104.16.1.2",
+		"www.example.com":  "104.16.1.1",
+		"ipv6.example.com": "2001:db8::1",
+	}
+	if !maps.Equal(r.Hosts, want) {
+		t.Errorf("Hosts = %v, want %v", r.Hosts, want)
+	}
+	if ip, ok := r.GetHost("ipv6.example.com"); !ok || ip != "2001:db8::1" {
+		t.Errorf("GetHost(ipv6.example.com) = %q, %v", ip, ok)
+	}
+
+	for _, bad := range []string{"not-an-ip example.com\n", "192.0.2.1\n"} {
+		if err := NewRules().FromHostsFile(strings.NewReader(bad)); err == nil {
+			t.Errorf("FromHostsFile(%q) should fail", bad)
+		}
+	}
+}
+
+func TestToHostsFile(t *testing.T) {
+	r := NewRules()
+	r.Hosts["example.com"] = "104.16.1.1"
+	r.Hosts["www.example.com"] = "104.16.1.1"
+	r.Hosts["Upper.example.com"] = "[2001:db8::1]"
+	r.Hosts["*.example.org"] = "104.16.1.2"
+	r.Hosts["example.net:443"] = "104.16.1.3"
+	r.Hosts["auto.example.com"] = DefaultAutoMarker
+	r.Hosts["10.0.0.0/8"] = "104.16.1.4"
+	r.Hosts["off.example.com"] = "104.16.1.5"
+	r.Meta = map[Section]map[string]RuleMeta{SectionHosts: {"off.example.com": {Disabled: true}}}
+	r.Init()
+
+	var buf bytes.Buffer
+	written, skipped, err := r.ToHostsFile(&buf)
+	if err != nil {
+		t.Fatalf("ToHostsFile() error = %v", err)
+	}
+	if written != 3 {
+		t.Errorf("ToHostsFile() wrote %d names, want 3", written)
+	}
+	wantOut := "104.16.1.1 example.com www.example.com\n2001:db8::1 upper.example.com\n"
+	if buf.String() != wantOut {
+		t.Errorf("ToHostsFile() wrote %q, want %q", buf.String(), wantOut)
+	}
+	wantSkipped := []string{"*.example.org", "10.0.0.0/8", "auto.example.com", "example.net:443"}
+	if !slices.Equal(skipped, wantSkipped) {
+		t.Errorf("skipped = %q, want %q", skipped, wantSkipped)
+	}
+
+	// Round trip
+	back := NewRules()
+	if err := back.FromHostsFile(&buf); err != nil {
+		t.Fatalf("FromHostsFile() error = %v", err)
+	}
+	for _, host := range []string{"example.com", "www.example.com", "upper.example.com"} {
+		got, _ := back.GetHost(host)
+		want, _ := r.GetHost(host)
+		if got != strings.Trim(want, "[]") {
+			t.Errorf("round trip GetHost(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
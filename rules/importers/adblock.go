@@ -0,0 +1,239 @@
+// Package importers converts third-party host lists into Snirect rule layers.
+package importers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/xihale/snirect-shared/pattern"
+	"github.com/xihale/snirect-shared/rules"
+)
+
+// AdblockOptions selects where imported domains go and what they map to.
+type AdblockOptions struct {
+	// Section is the rule map to fill.
+	Section rules.Section
+	// Value is assigned to every imported pattern: a target SNI for
+	// alter_hostname, an IP for hosts, or a policy for cert_verify: a bool, a
+	// hostname, or a list of hostnames as []string or []any.
+	Value any
+}
+
+// Unsupported is a list line the importer could not express as a pattern.
+type Unsupported struct {
+	Line   int    `json:"line"`
+	Text   string `json:"text"`
+	Reason string `json:"reason"`
+}
+
+func (u Unsupported) String() string {
+	return fmt.Sprintf("line %d: %s: %s", u.Line, u.Reason, u.Text)
+}
+
+// AdblockResult is the outcome of ParseAdblock.
+type AdblockResult struct {
+	// Rules holds the imported patterns in opts.Section; merge it as a layer.
+	Rules *rules.Rules
+	// Unsupported lists every filter that was skipped, in input order.
+	Unsupported []Unsupported
+}
+
+// adblockOptions are filter options that do not narrow a domain rule, so the
+// rule can be imported as is.
+var adblockOptions = []string{"important", "all"}
+
+// ParseAdblock imports an adblock/uBlock Origin filter list.
+//
+// Domain-anchored filters ("||example.com^") and plain hostnames become
+// "*.example.com". Exceptions ("@@||cdn.example.com^") become exclusions of the
+// filters that cover them, e.g. "*.example.com^*.cdn.example.com"; an exception
+// for the filter's own domain drops the filter. Comments are skipped, and
+// cosmetic, path, regex and option-restricted filters are reported as
+// Unsupported.
+func ParseAdblock(r io.Reader, opts AdblockOptions) (*AdblockResult, error) {
+	out := rules.NewRules()
+	assign, err := assigner(out, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &AdblockResult{Rules: out}
+	var blocks []string
+	type exceptionFilter struct {
+		line   int
+		domain string
+	}
+	var exceptions []exceptionFilter
+	seen := make(map[string]bool)
+
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "!") || strings.HasPrefix(text, "[") {
+			continue // comment or "[Adblock Plus 2.0]" header
+		}
+
+		domain, exception, reason := parseAdblockFilter(text)
+		if reason != "" {
+			res.Unsupported = append(res.Unsupported, Unsupported{Line: line, Text: text, Reason: reason})
+			continue
+		}
+		if _, err := pattern.Compile("*." + domain); err != nil {
+			res.Unsupported = append(res.Unsupported, Unsupported{Line: line, Text: text, Reason: "invalid domain"})
+			continue
+		}
+
+		key := domain
+		if exception {
+			key = "@@" + domain
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if exception {
+			exceptions = append(exceptions, exceptionFilter{line: line, domain: domain})
+		} else {
+			blocks = append(blocks, domain)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("adblock: %w", err)
+	}
+
+	used := make([]bool, len(exceptions))
+	for _, d := range blocks {
+		var excluded []string
+		dropped := false
+		for i, ex := range exceptions {
+			switch e := ex.domain; {
+			case e == d || strings.HasSuffix(d, "."+e):
+				dropped, used[i] = true, true
+			case strings.HasSuffix(e, "."+d):
+				excluded, used[i] = append(excluded, "*."+e), true
+			}
+		}
+		if dropped {
+			continue
+		}
+		slices.Sort(excluded)
+		assign(strings.Join(append([]string{"*." + d}, excluded...), "^"))
+	}
+	for i, ex := range exceptions {
+		if !used[i] {
+			res.Unsupported = append(res.Unsupported, Unsupported{Line: ex.line, Text: "@@||" + ex.domain + "^", Reason: "exception matches no imported filter"})
+		}
+	}
+	slices.SortStableFunc(res.Unsupported, func(a, b Unsupported) int { return a.Line - b.Line })
+
+	out.Init()
+	return res, nil
+}
+
+// parseAdblockFilter extracts the domain of a filter line. It returns a
+// non-empty reason if the filter cannot be imported.
+func parseAdblockFilter(text string) (domain string, exception bool, reason string) {
+	for _, marker := range []string{"##", "#@#", "#?#", "#$#", "#%#"} {
+		if strings.Contains(text, marker) {
+			return "", false, "cosmetic filter"
+		}
+	}
+
+	text, exception = strings.CutPrefix(text, "@@")
+
+	if strings.HasPrefix(text, "/") && strings.HasSuffix(text, "/") && len(text) > 1 {
+		return "", false, "regex filter"
+	}
+
+	if i := strings.LastIndexByte(text, '$'); i != -1 {
+		for _, opt := range strings.Split(text[i+1:], ",") {
+			if !slices.Contains(adblockOptions, strings.ToLower(strings.TrimSpace(opt))) {
+				return "", false, fmt.Sprintf("filter option %q", opt)
+			}
+		}
+		text = text[:i]
+	}
+
+	anchored := false
+	if rest, ok := strings.CutPrefix(text, "||"); ok {
+		text, anchored = rest, true
+	} else if strings.HasPrefix(text, "|") {
+		return "", false, "address filter"
+	}
+
+	end := strings.IndexAny(text, "^/|*:?")
+	if end == -1 {
+		end = len(text)
+	}
+	domain, rest := strings.ToLower(text[:end]), text[end:]
+	switch {
+	case rest == "" || rest == "^" || rest == "^|":
+	case strings.HasPrefix(rest, "*"):
+		return "", false, "wildcard in domain"
+	case strings.HasPrefix(rest, ":"):
+		return "", false, "port filter"
+	default:
+		return "", false, "path filter"
+	}
+
+	if domain == "" || strings.HasPrefix(domain, ".") {
+		return "", false, "not domain-anchored"
+	}
+	// uBlock Origin treats a bare hostname as "||hostname^"; anything else
+	// without the anchor is a substring filter.
+	if !anchored && (!strings.Contains(domain, ".") || !isHostname(domain)) {
+		return "", false, "not domain-anchored"
+	}
+	return strings.TrimSuffix(domain, "."), exception, ""
+}
+
+// isHostname reports whether s consists of hostname characters only.
+func isHostname(s string) bool {
+	for _, c := range s {
+		switch {
+		case c == '.' || c == '-' || c == '_':
+		case 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+		case c >= 0x80:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// assigner returns a function that stores a key with opts.Value in the
+// selected section, checking the value type once up front.
+func assigner(r *rules.Rules, opts AdblockOptions) (func(key string), error) {
+	switch opts.Section {
+	case rules.SectionAlterHostname, rules.SectionHosts:
+		v, ok := opts.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("adblock: %s value must be a string, got %T", opts.Section, opts.Value)
+		}
+		m := r.AlterHostname
+		if opts.Section == rules.SectionHosts {
+			m = r.Hosts
+		}
+		return func(key string) { m[key] = v }, nil
+	case rules.SectionCertVerify:
+		v := opts.Value
+		if list, ok := v.([]string); ok {
+			// Policies are stored as TOML decodes them.
+			items := make([]any, len(list))
+			for i, s := range list {
+				items[i] = s
+			}
+			v = items
+		}
+		if _, ok := rules.ParseCertPolicy(v); !ok {
+			return nil, fmt.Errorf("adblock: %s value must be a bool, a hostname or a list of hostnames, got %T", opts.Section, opts.Value)
+		}
+		return func(key string) { r.CertVerify[key] = v }, nil
+	}
+	return nil, fmt.Errorf("adblock: unknown section %q", opts.Section)
+}
@@ -0,0 +1,122 @@
+package importers
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/xihale/snirect-shared/rules"
+)
+
+const adblockList = `[Adblock Plus 2.0]
+! Title: test list
+||example.com^
+||ads.example.org^$important
+tracker.example.net
+||example.com^
+@@||cdn.example.com^
+@@||static.cdn.example.com^
+||allowed.example.info^
+@@||example.info^
+example.com##.banner
+||example.com/ads/*
+/banner[0-9]+/
+||thirdparty.example^$third-party
+|https://example.com/
+||ads*.example.org^
+@@||unused.example^
+`
+
+func TestParseAdblock(t *testing.T) {
+	res, err := ParseAdblock(strings.NewReader(adblockList), AdblockOptions{
+		Section: rules.SectionAlterHostname,
+		Value:   "g.cn",
+	})
+	if err != nil {
+		t.Fatalf("ParseAdblock() error = %v", err)
+	}
+
+	var keys []string
+	for k, v := range res.Rules.AlterHostname {
+		if v != "g.cn" {
+			t.Errorf("key %q = %q, want g.cn", k, v)
+		}
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	want := []string{
+		"*.ads.example.org",
+		"*.example.com^*.cdn.example.com^*.static.cdn.example.com",
+		"*.tracker.example.net",
+	}
+	if !slices.Equal(keys, want) {
+		t.Errorf("imported keys = %q, want %q", keys, want)
+	}
+
+	wantReasons := map[int]string{
+		11: "cosmetic filter",
+		12: "path filter",
+		13: "regex filter",
+		14: `filter option "third-party"`,
+		15: "address filter",
+		16: "wildcard in domain",
+		17: "exception matches no imported filter",
+	}
+	if len(res.Unsupported) != len(wantReasons) {
+		t.Errorf("Unsupported = %v, want %d entries", res.Unsupported, len(wantReasons))
+	}
+	for _, u := range res.Unsupported {
+		if wantReasons[u.Line] != u.Reason {
+			t.Errorf("line %d reported as %q, want %q", u.Line, u.Reason, wantReasons[u.Line])
+		}
+	}
+
+	// The layer merges like any other rule set.
+	base := rules.NewRules()
+	base.Merge(res.Rules)
+	for host, want := range map[string]bool{
+		"example.com":                true,
+		"www.example.com":            true,
+		"cdn.example.com":            false,
+		"img.static.cdn.example.com": false,
+		"allowed.example.info":       false,
+		"ads.example.org":            true,
+	} {
+		if _, ok := base.GetAlterHostname(host); ok != want {
+			t.Errorf("GetAlterHostname(%q) matched = %v, want %v", host, ok, want)
+		}
+	}
+}
+
+func TestParseAdblockValue(t *testing.T) {
+	if _, err := ParseAdblock(strings.NewReader(""), AdblockOptions{Section: rules.SectionHosts, Value: 1}); err == nil {
+		t.Error("non-string hosts value should fail")
+	}
+	if _, err := ParseAdblock(strings.NewReader(""), AdblockOptions{Section: "nope", Value: "x"}); err == nil {
+		t.Error("unknown section should fail")
+	}
+
+	res, err := ParseAdblock(strings.NewReader("||example.com^\n"), AdblockOptions{Section: rules.SectionCertVerify, Value: false})
+	if err != nil {
+		t.Fatalf("ParseAdblock() error = %v", err)
+	}
+	if p, ok := res.Rules.GetCertVerify("www.example.com"); !ok || p.Verify {
+		t.Errorf("GetCertVerify() = %+v, %v, want verify disabled", p, ok)
+	}
+
+	for _, value := range []any{[]string{"a.example.net", "b.example.net"}, []any{"a.example.net", "b.example.net"}} {
+		res, err := ParseAdblock(strings.NewReader("||example.com^\n"), AdblockOptions{Section: rules.SectionCertVerify, Value: value})
+		if err != nil {
+			t.Fatalf("ParseAdblock(%T) error = %v", value, err)
+		}
+		if p, ok := res.Rules.GetCertVerify("www.example.com"); !ok || p.Verify || !slices.Equal(p.Allow, []string{"a.example.net", "b.example.net"}) {
+			t.Errorf("%T: GetCertVerify() = %+v, %v", value, p, ok)
+		}
+		if _, err := res.Rules.ToTOML(); err != nil {
+			t.Errorf("%T: ToTOML() error = %v", value, err)
+		}
+	}
+	if _, err := ParseAdblock(strings.NewReader(""), AdblockOptions{Section: rules.SectionCertVerify, Value: 1}); err == nil {
+		t.Error("non-policy cert_verify value should fail")
+	}
+}
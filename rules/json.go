@@ -2,6 +2,7 @@ package rules
 
 import (
 	"encoding/json"
+	"fmt"
 )
 
 // FromJSON parses JSON data and updates Rules.
@@ -10,6 +11,19 @@ func (r *Rules) FromJSON(data []byte) error {
 	if err := json.Unmarshal(data, &jsonRules); err != nil {
 		return err
 	}
+	if err := checkVersion(jsonRules.Version); err != nil {
+		return err
+	}
+	for _, rule := range jsonRules.Rules {
+		if _, err := rule.ruleMeta(); err != nil {
+			return fmt.Errorf("%v: %w", rule.Patterns, err)
+		}
+	}
+	for _, rule := range jsonRules.CertVerify {
+		if _, err := rule.ruleMeta(); err != nil {
+			return fmt.Errorf("%v: %w", rule.Patterns, err)
+		}
+	}
 
 	r.FromJSONRules(&jsonRules)
 	return nil
@@ -0,0 +1,361 @@
+package rules
+
+import (
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// RuleMeta is the optional metadata of a rule written in the extended form, an
+// inline table holding the rule value and any of apps, enabled, tags, note and
+// expires:
+//
+//	"*.google.com" = { sni = "g.cn", enabled = false, tags = ["google"], note = "...", expires = 2026-12-01 }
+//	"*.youtube.com" = { sni = "g.cn", apps = ["com.google.android.youtube"] }
+//
+// The value is named sni in alter_hostname, ip in hosts and verify in
+// cert_verify, as in the JSON format. Rules in the short form have no metadata.
+type RuleMeta struct {
+	// Apps scopes the rule to the listed applications (see LookupContext);
+	// empty means the rule is global.
+	Apps []string
+	// Disabled rules are kept but never match.
+	Disabled bool
+	Tags     []string
+	Note     string
+	// Expires is when the rule stops matching; zero means never. A date
+	// without a time keeps the rule active through that day: it expires at
+	// the local midnight that ends it.
+	Expires time.Time
+}
+
+// now is the clock used to expire rules; tests replace it.
+var now = time.Now
+
+// IsZero reports whether m holds no metadata.
+func (m RuleMeta) IsZero() bool {
+	return len(m.Apps) == 0 && !m.Disabled && len(m.Tags) == 0 && m.Note == "" && m.Expires.IsZero()
+}
+
+// Active reports whether a rule with this metadata matches at time t.
+func (m RuleMeta) Active(t time.Time) bool {
+	return !m.Disabled && (m.Expires.IsZero() || t.Before(m.Expires))
+}
+
+// HasTag reports whether m is tagged with tag.
+func (m RuleMeta) HasTag(tag string) bool {
+	return slices.Contains(m.Tags, tag)
+}
+
+// Field names of the extended rule form.
+const (
+	fieldApps    = "apps"
+	fieldEnabled = "enabled"
+	fieldTags    = "tags"
+	fieldNote    = "note"
+	fieldExpires = "expires"
+)
+
+// valueField returns the name of the rule value in the extended form of a section.
+func valueField(section Section) string {
+	switch section {
+	case SectionAlterHostname:
+		return "sni"
+	case SectionHosts:
+		return "ip"
+	}
+	return "verify"
+}
+
+// parseRule splits a rule value as read from TOML into the value and its
+// metadata. Values that are not tables are in the short form.
+func parseRule(section Section, v any) (any, RuleMeta, error) {
+	var meta RuleMeta
+	table, ok := v.(map[string]any)
+	if !ok {
+		return v, meta, nil
+	}
+
+	field := valueField(section)
+	value, ok := table[field]
+	if !ok {
+		return nil, meta, fmt.Errorf("rule has no %q value", field)
+	}
+	for _, k := range slices.Sorted(maps.Keys(table)) {
+		var err error
+		switch v := table[k]; k {
+		case field:
+		case fieldEnabled:
+			enabled, ok := v.(bool)
+			if !ok {
+				err = fmt.Errorf("%s must be a boolean", k)
+			}
+			meta.Disabled = !enabled
+		case fieldApps:
+			meta.Apps, err = stringList(k, v)
+		case fieldTags:
+			meta.Tags, err = stringList(k, v)
+		case fieldNote:
+			if meta.Note, ok = v.(string); !ok {
+				err = fmt.Errorf("%s must be a string", k)
+			}
+		case fieldExpires:
+			meta.Expires, err = parseExpires(v)
+		default:
+			err = fmt.Errorf("unknown field %q", k)
+		}
+		if err != nil {
+			return nil, meta, err
+		}
+	}
+	return value, meta, nil
+}
+
+// stringList reads a TOML list of strings.
+func stringList(field string, v any) ([]string, error) {
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a list of strings", field)
+	}
+	out := make([]string, len(items))
+	for i, item := range items {
+		if out[i], ok = item.(string); !ok {
+			return nil, fmt.Errorf("%s must be a list of strings", field)
+		}
+	}
+	return out, nil
+}
+
+// parseExpires reads an expiry written as a TOML date or date-time, or as a
+// string in either form (the JSON format). A date is the last day the rule is
+// active, so it expires at the following local midnight.
+func parseExpires(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case toml.LocalDate:
+		return v.AsTime(time.Local).AddDate(0, 0, 1), nil
+	case toml.LocalDateTime:
+		return v.AsTime(time.Local), nil
+	case string:
+		if t, err := time.ParseInLocation(time.DateOnly, v, time.Local); err == nil {
+			return t.AddDate(0, 0, 1), nil
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%s must be a date or date-time, got %v", fieldExpires, v)
+}
+
+// expiresValue returns t as a TOML local date, the day before, when it is a
+// local midnight, the form an expiry is usually written in.
+func expiresValue(t time.Time) any {
+	local := t.In(time.Local)
+	if y, m, d := local.Date(); local.Equal(time.Date(y, m, d, 0, 0, 0, 0, time.Local)) {
+		y, m, d = local.AddDate(0, 0, -1).Date()
+		return toml.LocalDate{Year: y, Month: int(m), Day: d}
+	}
+	return t
+}
+
+// formatExpires formats an expiry for JSON: a date, or an RFC 3339 date-time.
+func formatExpires(t time.Time) string {
+	if d, ok := expiresValue(t).(toml.LocalDate); ok {
+		return d.String()
+	}
+	return t.Format(time.RFC3339)
+}
+
+// extendedValue returns value, or the extended form of a rule with metadata.
+func extendedValue(section Section, value any, meta RuleMeta) any {
+	if meta.IsZero() {
+		return value
+	}
+	m := map[string]any{valueField(section): value}
+	if len(meta.Apps) > 0 {
+		m[fieldApps] = meta.Apps
+	}
+	if meta.Disabled {
+		m[fieldEnabled] = false
+	}
+	if len(meta.Tags) > 0 {
+		m[fieldTags] = meta.Tags
+	}
+	if meta.Note != "" {
+		m[fieldNote] = meta.Note
+	}
+	if !meta.Expires.IsZero() {
+		m[fieldExpires] = expiresValue(meta.Expires)
+	}
+	return m
+}
+
+// normalizeMeta keeps the metadata of the keys normalizeMap keeps, under their
+// normalized names. values is the section before normalization.
+func normalizeMeta[T any](values map[string]T, meta map[string]RuleMeta) map[string]RuleMeta {
+	out := make(map[string]RuleMeta)
+	for k, m := range meta {
+		nk := strings.TrimPrefix(k, "$")
+		if !hasKey(values, k) || m.IsZero() || (nk != k && hasKey(values, nk)) {
+			continue
+		}
+		out[nk] = m
+	}
+	return out
+}
+
+// copyMeta copies the metadata of every section.
+func copyMeta(meta map[Section]map[string]RuleMeta) map[Section]map[string]RuleMeta {
+	out := make(map[Section]map[string]RuleMeta, len(meta))
+	for section, m := range meta {
+		out[section] = maps.Clone(m)
+	}
+	return out
+}
+
+// mergeMeta copies the metadata of keys into dst, removing the metadata of
+// keys that have none in src: a rule that overrides another replaces it whole.
+func mergeMeta(dst, src map[Section]map[string]RuleMeta, section Section, keys iter.Seq[string]) {
+	for k := range keys {
+		if m, ok := src[section][k]; ok {
+			if dst[section] == nil {
+				dst[section] = make(map[string]RuleMeta)
+			}
+			dst[section][k] = m
+		} else {
+			delete(dst[section], k)
+		}
+	}
+}
+
+// RuleMeta returns the metadata of a rule, or false if it has none.
+func (r *Rules) RuleMeta(section Section, key string) (RuleMeta, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m, ok := r.Meta[section][key]
+	return m, ok
+}
+
+// SetRuleMeta replaces the metadata of an existing rule; zero metadata turns
+// it back into the short form. It reports whether the rule exists.
+func (r *Rules) SetRuleMeta(section Section, key string, meta RuleMeta) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.hasKeyLocked(section, key) {
+		return false
+	}
+	r.setMetaLocked(section, key, meta)
+	r.initLocked()
+	return true
+}
+
+func (r *Rules) setMetaLocked(section Section, key string, meta RuleMeta) {
+	if meta.IsZero() {
+		delete(r.Meta[section], key)
+		return
+	}
+	if r.Meta == nil {
+		r.Meta = make(map[Section]map[string]RuleMeta)
+	}
+	if r.Meta[section] == nil {
+		r.Meta[section] = make(map[string]RuleMeta)
+	}
+	r.Meta[section][key] = meta
+}
+
+// Active reports whether a rule exists and currently matches, i.e. it is
+// neither disabled nor expired.
+func (r *Rules) Active(section Section, key string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.hasKeyLocked(section, key) && r.compiledLocked(section).active(key)
+}
+
+// SetEnabled enables or disables a rule and reports whether it exists.
+func (r *Rules) SetEnabled(section Section, key string, enabled bool) bool {
+	m, _ := r.RuleMeta(section, key)
+	m.Disabled = !enabled
+	return r.SetRuleMeta(section, key, m)
+}
+
+// SetTagEnabled enables or disables every rule tagged with tag, in all
+// sections, and returns the number of rules tagged.
+func (r *Rules) SetTagEnabled(tag string, enabled bool) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for section, metas := range r.Meta {
+		for k, m := range metas {
+			if m.HasTag(tag) {
+				m.Disabled = !enabled
+				r.setMetaLocked(section, k, m)
+				n++
+			}
+		}
+	}
+	if n > 0 {
+		r.initLocked()
+	}
+	return n
+}
+
+// Tags returns every tag used by the rules, sorted.
+func (r *Rules) Tags() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var tags []string
+	for _, metas := range r.Meta {
+		for _, m := range metas {
+			tags = append(tags, m.Tags...)
+		}
+	}
+	slices.Sort(tags)
+	return slices.Compact(tags)
+}
+
+// hasKeyLocked reports whether a section has a key. Callers must hold r.mu.
+func (r *Rules) hasKeyLocked(section Section, key string) bool {
+	switch section {
+	case SectionAlterHostname:
+		return hasKey(r.AlterHostname, key)
+	case SectionCertVerify:
+		return hasKey(r.CertVerify, key)
+	case SectionHosts:
+		return hasKey(r.Hosts, key)
+	}
+	return false
+}
+
+// compiledLocked returns the compiled rules of a section. Callers must hold r.mu.
+func (r *Rules) compiledLocked(section Section) compiledRules {
+	switch section {
+	case SectionAlterHostname:
+		return r.alterHostnameRules
+	case SectionCertVerify:
+		return r.certVerifyRules
+	}
+	return r.hostsRules
+}
+
+// active reports whether the rule for key matches now.
+func (c compiledRules) active(key string) bool {
+	m, ok := c.meta[key]
+	return !ok || m.Active(now())
+}
+
+// global reports whether the rule for key matches now in any application.
+func (c compiledRules) global(key string) bool {
+	_, scoped := c.apps[key]
+	return !scoped && c.active(key)
+}
@@ -0,0 +1,298 @@
+package rules
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+const metaTOML = `
+[alter_hostname]
+"*.google.com" = "www.google.com"
+"mail.google.com" = { sni = "g.cn", enabled = false, tags = ["google"], note = "blocked at school" }
+"maps.google.com" = { sni = "maps.example", expires = 2026-12-01, tags = ["google", "trial"] }
+
+[alter_hostname."drive.google.com"]
+sni = "drive.example"
+tags = ["google"]
+
+[cert_verify]
+"*.google.com" = { verify = ["*.google.com", "g.cn"], note = "shared certificate" }
+
+[hosts]
+"mail.google.com" = { ip = "192.0.2.1", enabled = true, expires = 2026-06-01T12:00:00Z }
+`
+
+// setNow fixes the clock used to expire rules for the rest of the test.
+func setNow(t *testing.T, tm time.Time) {
+	t.Helper()
+	old := now
+	now = func() time.Time { return tm }
+	t.Cleanup(func() { now = old })
+}
+
+func TestRuleMeta(t *testing.T) {
+	setNow(t, time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC))
+	r := NewRules()
+	if err := r.FromTOML([]byte(metaTOML)); err != nil {
+		t.Fatalf("FromTOML() error = %v", err)
+	}
+
+	m, ok := r.RuleMeta(SectionAlterHostname, "mail.google.com")
+	if !ok || !m.Disabled || m.Note != "blocked at school" || !slices.Equal(m.Tags, []string{"google"}) {
+		t.Errorf("RuleMeta(mail.google.com) = %+v, %v", m, ok)
+	}
+	if m, _ := r.RuleMeta(SectionAlterHostname, "maps.google.com"); !m.Expires.Equal(time.Date(2026, 12, 2, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("expires = %v", m.Expires)
+	}
+	if _, ok := r.RuleMeta(SectionAlterHostname, "*.google.com"); ok {
+		t.Error("short-form rule has metadata")
+	}
+	if got := r.Tags(); !slices.Equal(got, []string{"google", "trial"}) {
+		t.Errorf("Tags() = %q", got)
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		// A disabled rule falls through to the next matching rule.
+		{host: "mail.google.com", want: "www.google.com"},
+		{host: "maps.google.com", want: "maps.example"},
+		{host: "drive.google.com", want: "drive.example"},
+	}
+	for _, tt := range tests {
+		if got, _ := r.GetAlterHostname(tt.host); got != tt.want {
+			t.Errorf("GetAlterHostname(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+	if got, ok := r.GetHost("mail.google.com"); !ok || got != "192.0.2.1" {
+		t.Errorf("GetHost() = %q, %v", got, ok)
+	}
+	if p, ok := r.GetCertVerify("www.google.com"); !ok || len(p.Allow) != 2 {
+		t.Errorf("GetCertVerify() = %+v, %v", p, ok)
+	}
+
+	// Expired rules stop matching without a reload.
+	setNow(t, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC))
+	if got, _ := r.GetAlterHostname("maps.google.com"); got != "www.google.com" {
+		t.Errorf("expired rule still matches: %q", got)
+	}
+	if _, ok := r.GetHost("mail.google.com"); ok || r.Active(SectionHosts, "mail.google.com") {
+		t.Error("expired hosts rule still matches")
+	}
+	if k, _ := r.Snapshot().LookupKey(SectionAlterHostname, "maps.google.com", 0); k != "*.google.com" {
+		t.Error("snapshot lookup matched an expired rule")
+	}
+}
+
+func TestRuleMetaExpiresDate(t *testing.T) {
+	r := NewRules()
+	if err := r.FromTOML([]byte(metaTOML)); err != nil {
+		t.Fatalf("FromTOML() error = %v", err)
+	}
+	// "expires = 2026-12-01" keeps the rule through that day.
+	tests := []struct {
+		at   time.Time
+		want string
+	}{
+		{at: time.Date(2026, 12, 1, 0, 0, 0, 0, time.Local), want: "maps.example"},
+		{at: time.Date(2026, 12, 1, 23, 59, 59, 0, time.Local), want: "maps.example"},
+		{at: time.Date(2026, 12, 2, 0, 0, 0, 0, time.Local), want: "www.google.com"},
+	}
+	for _, tt := range tests {
+		setNow(t, tt.at)
+		if got, _ := r.GetAlterHostname("maps.google.com"); got != tt.want {
+			t.Errorf("at %v: GetAlterHostname() = %q, want %q", tt.at, got, tt.want)
+		}
+	}
+
+	for _, v := range []any{"2026-12-01", toml.LocalDate{Year: 2026, Month: 12, Day: 1}} {
+		got, err := parseExpires(v)
+		if err != nil || !got.Equal(time.Date(2026, 12, 2, 0, 0, 0, 0, time.Local)) {
+			t.Errorf("parseExpires(%v) = %v, %v", v, got, err)
+		}
+		if back := formatExpires(got); back != "2026-12-01" {
+			t.Errorf("formatExpires(parseExpires(%v)) = %q", v, back)
+		}
+	}
+}
+
+func TestRuleMetaTOMLRoundTrip(t *testing.T) {
+	r := NewRules()
+	if err := r.FromTOML([]byte(metaTOML)); err != nil {
+		t.Fatalf("FromTOML() error = %v", err)
+	}
+	data, err := r.ToTOML()
+	if err != nil {
+		t.Fatalf("ToTOML() error = %v", err)
+	}
+	for _, want := range []string{
+		`"mail.google.com" = { sni = "g.cn", enabled = false, tags = ["google"], note = "blocked at school" }`,
+		`"maps.google.com" = { sni = "maps.example", tags = ["google", "trial"], expires = 2026-12-01 }`,
+		`"mail.google.com" = { ip = "192.0.2.1", expires = 2026-06-01T12:00:00Z }`,
+		`"*.google.com" = "www.google.com"`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("ToTOML() lacks %s:\n%s", want, data)
+		}
+	}
+
+	back := NewRules()
+	if err := back.FromTOML(data); err != nil {
+		t.Fatalf("FromTOML(ToTOML()) error = %v\n%s", err, data)
+	}
+	if d := Diff(r, back); !d.Empty() {
+		t.Errorf("round trip changed the rules:\n%s", d)
+	}
+}
+
+func TestRuleMetaErrors(t *testing.T) {
+	for _, input := range []string{
+		`"a.example" = { sni = "x", color = "red" }`,
+		`"a.example" = { enabled = false }`,
+		`"a.example" = { sni = "x", enabled = "no" }`,
+		`"a.example" = { sni = "x", tags = "google" }`,
+		`"a.example" = { sni = "x", expires = "soon" }`,
+		`"a.example" = { sni = 1 }`,
+	} {
+		if err := NewRules().FromTOML([]byte("[alter_hostname]\n" + input + "\n")); err == nil {
+			t.Errorf("FromTOML(%s) succeeded", input)
+		}
+	}
+}
+
+func TestSetTagEnabled(t *testing.T) {
+	r := NewRules()
+	if err := r.FromTOML([]byte(metaTOML)); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.SetTagEnabled("google", true); n != 3 {
+		t.Errorf("SetTagEnabled(google, true) = %d, want 3", n)
+	}
+	if got, _ := r.GetAlterHostname("mail.google.com"); got != "g.cn" {
+		t.Errorf("enabled rule = %q", got)
+	}
+	if n := r.SetTagEnabled("google", false); n != 3 {
+		t.Errorf("SetTagEnabled(google, false) = %d, want 3", n)
+	}
+	if got, _ := r.GetAlterHostname("drive.google.com"); got != "www.google.com" {
+		t.Errorf("disabled rule still matches: %q", got)
+	}
+	if n := r.SetTagEnabled("nope", false); n != 0 {
+		t.Errorf("SetTagEnabled(nope) = %d", n)
+	}
+
+	if !r.SetEnabled(SectionAlterHostname, "*.google.com", false) || r.Active(SectionAlterHostname, "*.google.com") {
+		t.Error("SetEnabled() did not disable a short-form rule")
+	}
+	if r.SetEnabled(SectionHosts, "missing.example", false) {
+		t.Error("SetEnabled() of a missing rule = true")
+	}
+	d := Diff(NewRules(), r)
+	if !strings.Contains(d.String(), `+ "*.google.com" = { sni = "www.google.com", enabled = false }`) {
+		t.Errorf("Diff() =\n%s", d)
+	}
+}
+
+func TestRuleMetaOverrides(t *testing.T) {
+	base := NewRules()
+	if err := base.FromTOML([]byte(metaTOML)); err != nil {
+		t.Fatal(err)
+	}
+	override := NewRules()
+	override.AlterHostname["mail.google.com"] = "mail.example"
+	override.AlterHostname["$drive.google.com"] = DefaultAutoMarker
+	override.Init()
+
+	ApplyOverrides(base, override, "")
+	if _, ok := base.RuleMeta(SectionAlterHostname, "mail.google.com"); ok {
+		t.Error("an overriding short-form rule kept the old metadata")
+	}
+	if got, _ := base.GetAlterHostname("mail.google.com"); got != "mail.example" {
+		t.Errorf("GetAlterHostname() = %q", got)
+	}
+	if _, ok := base.RuleMeta(SectionAlterHostname, "drive.google.com"); ok {
+		t.Error("metadata of a deleted rule was kept")
+	}
+	if _, ok := base.DeepCopy().RuleMeta(SectionAlterHostname, "maps.google.com"); !ok {
+		t.Error("DeepCopy() lost metadata")
+	}
+}
+
+func TestRuleMetaJSON(t *testing.T) {
+	r := NewRules()
+	if err := r.FromTOML([]byte(metaTOML)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := r.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"enabled":false,"tags":["google"],"note":"blocked at school"`) ||
+		!strings.Contains(string(data), `"expires":"2026-12-01"`) {
+		t.Errorf("ToJSON() = %s", data)
+	}
+
+	back := NewRules()
+	if err := back.FromJSON(data); err != nil {
+		t.Fatalf("FromJSON() error = %v", err)
+	}
+	for _, section := range []Section{SectionAlterHostname, SectionCertVerify} {
+		for _, k := range r.Keys(section) {
+			want, _ := r.RuleMeta(section, k)
+			got, _ := back.RuleMeta(section, k)
+			if got.Disabled != want.Disabled || got.Note != want.Note || !slices.Equal(got.Tags, want.Tags) || !got.Expires.Equal(want.Expires) {
+				t.Errorf("%s %q: metadata = %+v, want %+v", section, k, got, want)
+			}
+		}
+	}
+
+	bad := `{"rules": [{"patterns": ["a.example"], "target_sni": "x", "expires": "soon"}]}`
+	if err := NewRules().FromJSON([]byte(bad)); err == nil {
+		t.Error("FromJSON() with an invalid expiry succeeded")
+	}
+}
+
+func TestDocumentRuleMeta(t *testing.T) {
+	const input = `[alter_hostname]
+# school network
+"mail.google.com" = { sni = "g.cn", tags = ["google"] } # keep
+"*.google.com" = "www.google.com"
+`
+	d, err := ParseDocument([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := d.SetTagEnabled("google", false); err != nil || n != 1 {
+		t.Fatalf("SetTagEnabled() = %d, %v", n, err)
+	}
+	if err := d.SetAlterHostname("mail.google.com", "g2.cn"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetRuleMeta(SectionAlterHostname, "*.google.com", RuleMeta{Note: "default"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetEnabled(SectionHosts, "missing.example", true); err == nil {
+		t.Error("SetEnabled() of a missing rule succeeded")
+	}
+
+	want := `[alter_hostname]
+# school network
+"mail.google.com" = { sni = "g2.cn", enabled = false, tags = ["google"] } # keep
+"*.google.com" = { sni = "www.google.com", note = "default" }
+`
+	if got := string(d.Bytes()); got != want {
+		t.Errorf("Bytes() =\n%s\nwant\n%s", got, want)
+	}
+
+	if err := d.SetRuleMeta(SectionAlterHostname, "*.google.com", RuleMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(d.Bytes()), "\n\"*.google.com\" = \"www.google.com\"\n") {
+		t.Errorf("zero metadata did not restore the short form:\n%s", d.Bytes())
+	}
+}
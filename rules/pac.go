@@ -0,0 +1,325 @@
+package rules
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp/syntax"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/xihale/snirect-shared/pattern"
+)
+
+// pacRuntime holds the helpers shared by every generated PAC file. It avoids PAC
+// builtins such as isInNet, which resolve hostnames through DNS.
+const pacRuntime = `function snirectPort(url) {
+  var m = /^([a-z][a-z0-9+.-]*):\/\/(?:[^\/?#@]*@)?(\[[^\]]*\]|[^\/?#:]*)(?::(\d+))?/i.exec(url);
+  if (!m) return 0;
+  if (m[3]) return parseInt(m[3], 10);
+  var scheme = m[1].toLowerCase();
+  if (scheme === "https" || scheme === "wss") return 443;
+  if (scheme === "http" || scheme === "ws") return 80;
+  if (scheme === "ftp") return 21;
+  return 0;
+}
+
+function snirectIPv4(host) {
+  var m = /^(\d{1,3})\.(\d{1,3})\.(\d{1,3})\.(\d{1,3})$/.exec(host);
+  if (!m) return null;
+  var out = [];
+  for (var i = 1; i <= 4; i++) {
+    var n = parseInt(m[i], 10);
+    if (n > 255 || (m[i].length > 1 && m[i].charAt(0) === "0")) return null;
+    out.push(n);
+  }
+  return out;
+}
+
+function snirectIPv6(host) {
+  if (host.indexOf(":") < 0 || !/^[0-9a-f:.]+$/.test(host)) return null;
+  var halves = host.split("::");
+  if (halves.length > 2) return null;
+  var parse = function (s) {
+    if (s === "") return [];
+    var parts = s.split(":"), out = [];
+    for (var i = 0; i < parts.length; i++) {
+      if (i === parts.length - 1 && parts[i].indexOf(".") >= 0) {
+        var v4 = snirectIPv4(parts[i]);
+        if (!v4) return null;
+        out.push(v4[0] * 256 + v4[1], v4[2] * 256 + v4[3]);
+      } else if (/^[0-9a-f]{1,4}$/.test(parts[i])) {
+        out.push(parseInt(parts[i], 16));
+      } else {
+        return null;
+      }
+    }
+    return out;
+  };
+  var head = parse(halves[0]), tail = halves.length === 2 ? parse(halves[1]) : [];
+  if (!head || !tail) return null;
+  var fill = 8 - head.length - tail.length;
+  if (halves.length === 1 ? fill !== 0 : fill < 1) return null;
+  var words = head.slice();
+  for (var i = 0; i < fill; i++) words.push(0);
+  words = words.concat(tail);
+  var bytes = [];
+  for (var i = 0; i < 8; i++) bytes.push(words[i] >> 8, words[i] & 255);
+  // IPv4-mapped addresses match as IPv4
+  if (words[0] === 0 && words[1] === 0 && words[2] === 0 && words[3] === 0 && words[4] === 0 && words[5] === 65535) {
+    return bytes.slice(12);
+  }
+  return bytes;
+}
+
+function snirectInNet(addr, net, bits) {
+  if (!addr || addr.length !== net.length) return false;
+  for (var i = 0; i < net.length && bits > 0; i++, bits -= 8) {
+    var mask = bits >= 8 ? 255 : (255 << (8 - bits)) & 255;
+    if ((addr[i] & mask) !== (net[i] & mask)) return false;
+  }
+  return true;
+}
+
+// A term matches if the port is in range (0 = any) and any alternative matches:
+// ["=", host], [".", domain], ["re", regexp] or ["ip", bytes, bits].
+function snirectTerm(term, host, addr, port) {
+  if (term.lo && (port < term.lo || port > term.hi)) return false;
+  for (var i = 0; i < term.alts.length; i++) {
+    var a = term.alts[i];
+    if (a[0] === "=" ? host === a[1] :
+        a[0] === "." ? host === a[1] || host.slice(-a[1].length - 1) === "." + a[1] :
+        a[0] === "re" ? a[1].test(host) :
+        snirectInNet(addr, a[1], a[2])) {
+      return true;
+    }
+  }
+  return false;
+}
+
+function FindProxyForURL(url, host) {
+  host = host.toLowerCase().replace(/^\[|\]$/g, "").replace(/\.$/, "");
+  var addr = snirectIPv4(host) || snirectIPv6(host);
+  var port = snirectPort(url);
+  rules: for (var i = 0; i < snirectRules.length; i++) {
+    var rule = snirectRules[i];
+    if (!snirectTerm(rule[0], host, addr, port)) continue;
+    for (var j = 1; j < rule.length; j++) {
+      if (snirectTerm(rule[j], host, addr, port)) continue rules;
+    }
+    return snirectProxy;
+  }
+  return "DIRECT";
+}
+`
+
+// GeneratePAC returns a proxy auto-config script whose FindProxyForURL sends
+// every host matched by an alter_hostname or hosts rule to proxyAddr and
+// everything else DIRECT. proxyAddr is a PAC result such as "PROXY 127.0.0.1:7654";
+// a bare "host:port" is treated as an HTTP proxy.
+//
+// Globs, alternations, regexes, IP ranges, ports and "^" exclusions are all
+// translated; disabled and expired rules are left out. Port-restricted rules use the URL's port, or the scheme's default.
+// An error is returned for regexes JavaScript cannot express.
+func GeneratePAC(r *Rules, proxyAddr string) (string, error) {
+	proxy := strings.TrimSpace(proxyAddr)
+	if proxy == "" {
+		return "", fmt.Errorf("pac: empty proxy address")
+	}
+	if !strings.ContainsAny(proxy, " ;") {
+		proxy = "PROXY " + proxy
+	}
+
+	keys := slices.Concat(r.Keys(SectionAlterHostname), r.Keys(SectionHosts))
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+
+	var b strings.Builder
+	b.WriteString("// Proxy auto-config generated from Snirect rules. Do not edit.\n")
+	fmt.Fprintf(&b, "var snirectProxy = %s;\n\n", strconv.Quote(proxy))
+	b.WriteString("// Each rule is an include term followed by its exclusion terms.\n")
+	b.WriteString("var snirectRules = [\n")
+	for _, k := range keys {
+		p, err := pattern.Compile(k)
+		if err != nil || p.Ignored() || !(r.Global(SectionAlterHostname, k) || r.Global(SectionHosts, k)) {
+			continue
+		}
+		terms := []*pattern.Pattern{p.Include()}
+		terms = append(terms, p.Exclusions()...)
+
+		parts := make([]string, len(terms))
+		for i, t := range terms {
+			js, err := pacTerm(t)
+			if err != nil {
+				return "", fmt.Errorf("pac: rule %q: %w", k, err)
+			}
+			parts[i] = js
+		}
+		fmt.Fprintf(&b, "  [%s], // %s\n", strings.Join(parts, ", "), pacComment(k))
+	}
+	b.WriteString("];\n\n")
+	b.WriteString(pacRuntime)
+	return b.String(), nil
+}
+
+// pacTerm renders a single-term pattern as a JavaScript term object.
+func pacTerm(t *pattern.Pattern) (string, error) {
+	var alts []string
+	for _, alt := range t.Alternatives() {
+		switch alt.Kind {
+		case pattern.AltExact:
+			alts = append(alts, fmt.Sprintf("[\"=\", %s]", strconv.Quote(alt.Host)))
+		case pattern.AltSuffix:
+			alts = append(alts, fmt.Sprintf("[\".\", %s]", strconv.Quote(alt.Host)))
+		case pattern.AltIP:
+			alts = append(alts, pacIP(alt.Prefix))
+		default:
+			re, err := jsRegexp(alt.Regexp)
+			if err != nil {
+				return "", err
+			}
+			alts = append(alts, fmt.Sprintf("[\"re\", %s]", re))
+		}
+	}
+	lo, hi := t.Ports()
+	return fmt.Sprintf("{lo: %d, hi: %d, alts: [%s]}", lo, hi, strings.Join(alts, ", ")), nil
+}
+
+// pacIP renders an address range as ["ip", bytes, bits].
+func pacIP(prefix netip.Prefix) string {
+	raw := prefix.Addr().AsSlice()
+	nums := make([]string, len(raw))
+	for i, v := range raw {
+		nums[i] = strconv.Itoa(int(v))
+	}
+	return fmt.Sprintf("[\"ip\", [%s], %d]", strings.Join(nums, ","), prefix.Bits())
+}
+
+// pacComment makes a rule key safe to put in a line comment.
+func pacComment(k string) string {
+	return strings.NewReplacer("\n", " ", "\r", " ", "\u2028", " ", "\u2029", " ").Replace(k)
+}
+
+// jsRegexp translates an RE2 expression into a case-insensitive JavaScript
+// regex literal by walking its syntax tree, so the result does not depend on
+// the two dialects agreeing on syntax.
+func jsRegexp(expr string) (string, error) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := writeJSRegexp(&b, re.Simplify()); err != nil {
+		return "", fmt.Errorf("regex %s: %w", expr, err)
+	}
+	return "/" + b.String() + "/i", nil
+}
+
+func writeJSRegexp(b *strings.Builder, re *syntax.Regexp) error {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		b.WriteString(`[^\s\S]`)
+	case syntax.OpEmptyMatch:
+		b.WriteString(`(?:)`)
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if re.Flags&syntax.FoldCase != 0 {
+				r = unicode.ToLower(r)
+			}
+			writeJSRune(b, r)
+		}
+	case syntax.OpCharClass:
+		b.WriteByte('[')
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			lo, hi := re.Rune[i], min(re.Rune[i+1], 0xFFFF)
+			if lo > 0xFFFF {
+				continue // hosts are A-labels, astral runes never occur
+			}
+			writeJSRune(b, lo)
+			if hi != lo {
+				b.WriteByte('-')
+				writeJSRune(b, hi)
+			}
+		}
+		if len(re.Rune) == 0 {
+			b.WriteString(`^\s\S`)
+		}
+		b.WriteByte(']')
+	case syntax.OpAnyCharNotNL:
+		b.WriteString(`[^\n]`)
+	case syntax.OpAnyChar:
+		b.WriteString(`[\s\S]`)
+	case syntax.OpBeginLine, syntax.OpBeginText:
+		b.WriteByte('^')
+	case syntax.OpEndLine, syntax.OpEndText:
+		b.WriteByte('$')
+	case syntax.OpWordBoundary:
+		b.WriteString(`\b`)
+	case syntax.OpNoWordBoundary:
+		b.WriteString(`\B`)
+	case syntax.OpCapture:
+		b.WriteString("(?:")
+		if err := writeJSRegexp(b, re.Sub[0]); err != nil {
+			return err
+		}
+		b.WriteByte(')')
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		b.WriteString("(?:")
+		if err := writeJSRegexp(b, re.Sub[0]); err != nil {
+			return err
+		}
+		b.WriteByte(')')
+		switch re.Op {
+		case syntax.OpStar:
+			b.WriteByte('*')
+		case syntax.OpPlus:
+			b.WriteByte('+')
+		case syntax.OpQuest:
+			b.WriteByte('?')
+		default:
+			if re.Max == -1 {
+				fmt.Fprintf(b, "{%d,}", re.Min)
+			} else {
+				fmt.Fprintf(b, "{%d,%d}", re.Min, re.Max)
+			}
+		}
+		if re.Flags&syntax.NonGreedy != 0 {
+			b.WriteByte('?')
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if err := writeJSRegexp(b, sub); err != nil {
+				return err
+			}
+		}
+	case syntax.OpAlternate:
+		b.WriteString("(?:")
+		for i, sub := range re.Sub {
+			if i > 0 {
+				b.WriteByte('|')
+			}
+			if err := writeJSRegexp(b, sub); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(')')
+	default:
+		return fmt.Errorf("unsupported operator %v", re.Op)
+	}
+	return nil
+}
+
+// writeJSRune writes r so it means itself both inside and outside a class.
+func writeJSRune(b *strings.Builder, r rune) {
+	switch {
+	case r < 0x80 && (r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'):
+		b.WriteRune(r)
+		return
+	case r > ' ' && r < 0x7f:
+		b.WriteByte('\\')
+		b.WriteRune(r)
+		return
+	}
+	fmt.Fprintf(b, `\u%04x`, min(r, 0xFFFF))
+}
@@ -0,0 +1,98 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// The generated scripts are run in a JavaScript engine by the tests in
+// internal/pactest, a module of its own; these tests check their structure.
+
+func TestGeneratePAC(t *testing.T) {
+	setNow(t, time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC))
+	r := NewRules()
+	r.AlterHostname["*.example.com^login.example.com"] = "sni.example.net"
+	r.AlterHostname[`re:^(www|api)\.re-?test\.io$`] = ""
+	r.AlterHostname["#*disabled.example*"] = ""
+	r.AlterHostname["off.example.org"] = ""
+	r.AlterHostname["expired.example.org"] = ""
+	r.AlterHostname["app.example.org"] = ""
+	r.Hosts["203.0.113.0/24"] = "203.0.113.1"
+	r.Hosts["ported.example.org:8443"] = "192.0.2.1"
+	r.Hosts["*.example.com^login.example.com"] = "192.0.2.2"
+	r.Meta = map[Section]map[string]RuleMeta{SectionAlterHostname: {
+		"off.example.org":     {Disabled: true},
+		"expired.example.org": {Expires: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		"app.example.org":     {Apps: []string{"com.example.app"}},
+	}}
+	r.Init()
+
+	script, err := GeneratePAC(r, "127.0.0.1:7654")
+	if err != nil {
+		t.Fatalf("GeneratePAC() error = %v", err)
+	}
+	wantLines := []string{
+		`var snirectProxy = "PROXY 127.0.0.1:7654";`,
+		`  [{lo: 0, hi: 0, alts: [[".", "example.com"]]}, {lo: 0, hi: 0, alts: [["=", "login.example.com"]]}], // *.example.com^login.example.com`,
+		`  [{lo: 0, hi: 0, alts: [["ip", [203,0,113,0], 24]]}], // 203.0.113.0/24`,
+		`  [{lo: 8443, hi: 8443, alts: [["=", "ported.example.org"]]}], // ported.example.org:8443`,
+		`function FindProxyForURL(url, host) {`,
+	}
+	for _, line := range wantLines {
+		if !strings.Contains(script, line+"\n") {
+			t.Errorf("script is missing %q:\n%s", line, script)
+		}
+	}
+	if n := strings.Count(script, "example.com^login.example.com\n"); n != 1 {
+		t.Errorf("rule in both sections written %d times", n)
+	}
+	if !strings.Contains(script, `["re", /`) {
+		t.Errorf("regex rule missing:\n%s", script)
+	}
+	for _, absent := range []string{"disabled.example", "off.example.org", "expired.example.org", "app.example.org"} {
+		if strings.Contains(script, absent) {
+			t.Errorf("script contains inactive or scoped rule %q", absent)
+		}
+	}
+}
+
+func TestGeneratePACProxy(t *testing.T) {
+	r := NewRules()
+	r.Hosts["example.com"] = "192.0.2.1"
+	r.Init()
+	for _, proxy := range []string{"PROXY 127.0.0.1:1", "HTTPS proxy.example:443; DIRECT"} {
+		script, err := GeneratePAC(r, proxy)
+		if err != nil || !strings.Contains(script, `var snirectProxy = "`+proxy+`";`) {
+			t.Errorf("GeneratePAC() with proxy %q = %v", proxy, err)
+		}
+	}
+	if _, err := GeneratePAC(r, " "); err == nil {
+		t.Error("GeneratePAC() with an empty proxy succeeded")
+	}
+}
+
+func TestJSRegexp(t *testing.T) {
+	tests := []struct {
+		expr, want string
+	}{
+		{`a+b`, `/(?:a)+b/i`},
+		{`[0-9]{2,3}`, `/[0-9][0-9](?:[0-9])?/i`},
+		{`(?i)x`, `/x/i`},
+		{`\bx`, `/\bx/i`},
+	}
+	for _, tt := range tests {
+		if got, err := jsRegexp(tt.expr); err != nil || got != tt.want {
+			t.Errorf("jsRegexp(%q) = %q, %v, want %q", tt.expr, got, err, tt.want)
+		}
+	}
+	if _, err := jsRegexp(`(`); err == nil {
+		t.Error("jsRegexp() of an invalid regex succeeded")
+	}
+}
+
+func TestPACComment(t *testing.T) {
+	if got := pacComment("a\nb\rc\u2028d\u2029e"); got != "a b c d e" {
+		t.Errorf("pacComment() = %q", got)
+	}
+}
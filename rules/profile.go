@@ -0,0 +1,209 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Profiles are the named rule sets of a rules file, such as "home" and
+// "school", applied on top of the file's own sections. The root "profile" key
+// selects the active one:
+//
+//	profile = "school"
+//
+//	[profiles.home.alter_hostname]
+//	"*.example.com" = "front.example.net"
+//
+//	[profiles.school]
+//	inherits = "home"
+//
+//	[profiles.school.hosts]
+//	"github.com" = "20.27.177.113"
+//
+// A profile overrides the rules it inherits as with ApplyOverrides, so the auto
+// marker removes an inherited rule.
+type Profiles struct {
+	// Active is the profile selected by the file; empty means none.
+	Active string
+
+	byName map[string]*Profile
+}
+
+// Profile is a named rule set.
+type Profile struct {
+	Name string
+	// Inherits names the profile this one builds on; empty means the base rules.
+	Inherits string
+	Rules    *Rules
+}
+
+type tomlProfiles struct {
+	Profile  string                 `toml:"profile"`
+	Profiles map[string]tomlProfile `toml:"profiles"`
+}
+
+type tomlProfile struct {
+	Inherits      string         `toml:"inherits"`
+	AlterHostname map[string]any `toml:"alter_hostname"`
+	CertVerify    map[string]any `toml:"cert_verify"`
+	Hosts         map[string]any `toml:"hosts"`
+}
+
+// ParseProfiles reads the profiles of a TOML rules file. It fails if a profile
+// inherits from an undefined profile or from itself, directly or not, or if the
+// active profile is undefined. A file without profiles yields an empty set.
+func ParseProfiles(data []byte) (*Profiles, error) {
+	var file tomlProfiles
+	if err := toml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	ps := &Profiles{Active: file.Profile, byName: make(map[string]*Profile, len(file.Profiles))}
+	for name, tp := range file.Profiles {
+		r := NewRules()
+		if err := r.fromFile(tomlFile{AlterHostname: tp.AlterHostname, CertVerify: tp.CertVerify, Hosts: tp.Hosts}); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", name, err)
+		}
+		ps.byName[name] = &Profile{Name: name, Inherits: tp.Inherits, Rules: r}
+	}
+	for _, name := range ps.Names() {
+		if _, err := ps.chain(name); err != nil {
+			return nil, err
+		}
+	}
+	if ps.Active != "" {
+		if _, ok := ps.byName[ps.Active]; !ok {
+			return nil, fmt.Errorf("active profile %q is not defined", ps.Active)
+		}
+	}
+	return ps, nil
+}
+
+// Names returns the profile names, sorted.
+func (ps *Profiles) Names() []string {
+	return slices.Sorted(maps.Keys(ps.byName))
+}
+
+// Get returns a profile by name.
+func (ps *Profiles) Get(name string) (*Profile, bool) {
+	p, ok := ps.byName[name]
+	return p, ok
+}
+
+// chain returns a profile and its ancestors, the root ancestor first.
+func (ps *Profiles) chain(name string) ([]*Profile, error) {
+	var chain []*Profile
+	seen := make(map[string]bool)
+	for n := name; n != ""; {
+		p, ok := ps.byName[n]
+		if !ok {
+			return nil, fmt.Errorf("profile %q inherits from undefined profile %q", chain[len(chain)-1].Name, n)
+		}
+		if seen[n] {
+			return nil, fmt.Errorf("profile %q inherits from itself", n)
+		}
+		seen[n] = true
+		chain = append(chain, p)
+		n = p.Inherits
+	}
+	slices.Reverse(chain)
+	return chain, nil
+}
+
+// Apply returns a copy of base with the named profile and its ancestors
+// applied; an empty name returns a plain copy. base is not modified.
+func (ps *Profiles) Apply(base *Rules, name, autoMarker string) (*Rules, error) {
+	r := base.DeepCopy()
+	if name == "" {
+		return r, nil
+	}
+	if _, ok := ps.byName[name]; !ok {
+		return nil, fmt.Errorf("profile %q is not defined", name)
+	}
+	chain, err := ps.chain(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range chain {
+		ApplyOverrides(r, p.Rules, autoMarker)
+	}
+	return r, nil
+}
+
+// Validate reports the invalid rule keys of every profile (see Rules.Validate).
+func (ps *Profiles) Validate() error {
+	var errs []error
+	for _, name := range ps.Names() {
+		if err := ps.byName[name].Rules.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("profile %q: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ProfileSwitcher publishes base rules with a profile applied to a Store.
+// Switching builds a new snapshot and stores it, so readers pick up the
+// profile at their next Load without a restart.
+type ProfileSwitcher struct {
+	store *Store
+
+	mu       sync.Mutex
+	base     *Rules
+	profiles *Profiles
+	active   string
+}
+
+// NewProfileSwitcher publishes base with the profiles' active profile to store.
+// Nil profiles are treated as an empty set, so base is published as is.
+func NewProfileSwitcher(store *Store, base *Rules, profiles *Profiles) (*ProfileSwitcher, error) {
+	if profiles == nil {
+		profiles = &Profiles{}
+	}
+	s := &ProfileSwitcher{store: store}
+	if err := s.Update(base, profiles, profiles.Active); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Active returns the name of the published profile; empty means none.
+func (s *ProfileSwitcher) Active() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active
+}
+
+// Switch publishes the named profile; an empty name publishes the base rules.
+// On error the published rules are unchanged.
+func (s *ProfileSwitcher) Switch(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.publish(s.base, s.profiles, name)
+}
+
+// Update replaces the base rules and profiles, e.g. after the rules file was
+// reloaded, and publishes the named profile. Nil profiles are treated as an
+// empty set. On error nothing changes.
+func (s *ProfileSwitcher) Update(base *Rules, profiles *Profiles, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if profiles == nil {
+		profiles = &Profiles{}
+	}
+	return s.publish(base, profiles, name)
+}
+
+func (s *ProfileSwitcher) publish(base *Rules, profiles *Profiles, name string) error {
+	r, err := profiles.Apply(base, name, "")
+	if err != nil {
+		return err
+	}
+	s.store.Store(r.Snapshot())
+	s.base, s.profiles, s.active = base, profiles, name
+	return nil
+}
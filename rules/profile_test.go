@@ -0,0 +1,212 @@
+package rules
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const profilesTOML = `profile = "school"
+
+[alter_hostname]
+"*.example.com" = "front.example.net"
+
+[hosts]
+"github.com" = "192.0.2.1"
+
+[profiles.home.alter_hostname]
+"*.example.com" = "home.example.net"
+
+[profiles.school]
+inherits = "home"
+
+[profiles.school.alter_hostname]
+"www.example.com" = "school.example.net"
+
+[profiles.school.hosts]
+"github.com" = "__AUTO__"
+`
+
+func TestParseProfiles(t *testing.T) {
+	ps, err := ParseProfiles([]byte(profilesTOML))
+	if err != nil {
+		t.Fatalf("ParseProfiles() error = %v", err)
+	}
+	if ps.Active != "school" || strings.Join(ps.Names(), ",") != "home,school" {
+		t.Fatalf("ParseProfiles() = %q, %q", ps.Active, ps.Names())
+	}
+	if p, ok := ps.Get("school"); !ok || p.Inherits != "home" {
+		t.Errorf("Get(school) = %+v, %v", p, ok)
+	}
+
+	base := NewRules()
+	if err := base.FromTOML([]byte(profilesTOML)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		profile string
+		host    string
+		sni     string
+		addr    string
+	}{
+		{profile: "", host: "www.example.com", sni: "front.example.net", addr: "192.0.2.1"},
+		{profile: "home", host: "www.example.com", sni: "home.example.net", addr: "192.0.2.1"},
+		{profile: "school", host: "www.example.com", sni: "school.example.net"},
+		// Inherited from home.
+		{profile: "school", host: "api.example.com", sni: "home.example.net"},
+	}
+	for _, tt := range tests {
+		r, err := ps.Apply(base, tt.profile, "")
+		if err != nil {
+			t.Fatalf("Apply(%q) error = %v", tt.profile, err)
+		}
+		if got, _ := r.GetAlterHostname(tt.host); got != tt.sni {
+			t.Errorf("Apply(%q): GetAlterHostname(%q) = %q, want %q", tt.profile, tt.host, got, tt.sni)
+		}
+		if got, _ := r.GetHost("github.com"); got != tt.addr {
+			t.Errorf("Apply(%q): GetHost() = %q, want %q", tt.profile, got, tt.addr)
+		}
+	}
+	if got, _ := base.GetAlterHostname("www.example.com"); got != "front.example.net" {
+		t.Errorf("Apply() modified the base rules: %q", got)
+	}
+	if _, err := ps.Apply(base, "office", ""); err == nil {
+		t.Error("Apply() of an undefined profile succeeded")
+	}
+}
+
+func TestParseProfilesErrors(t *testing.T) {
+	for _, input := range []string{
+		"profile = \"away\"\n[profiles.home]\n",
+		"[profiles.a]\ninherits = \"b\"\n[profiles.b]\ninherits = \"a\"\n",
+		"[profiles.a]\ninherits = \"a\"\n",
+		"[profiles.a]\ninherits = \"missing\"\n",
+		"[profiles.a.alter_hostname]\n\"x.example\" = { enabled = false }\n",
+	} {
+		if _, err := ParseProfiles([]byte(input)); err == nil {
+			t.Errorf("ParseProfiles(%q) succeeded", input)
+		}
+	}
+
+	ps, err := ParseProfiles([]byte("[profiles.a.hosts]\n\"bad:port\" = \"192.0.2.1\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Validate(); err == nil || !strings.Contains(err.Error(), `profile "a"`) {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	// Files without profiles have none.
+	ps, err = ParseProfiles([]byte(UserRulesTOML))
+	if err != nil || ps.Active != "" || len(ps.Names()) != 0 {
+		t.Errorf("ParseProfiles(template) = %+v, %v", ps, err)
+	}
+}
+
+func TestProfileSwitcher(t *testing.T) {
+	base := NewRules()
+	if err := base.FromTOML([]byte(profilesTOML)); err != nil {
+		t.Fatal(err)
+	}
+	ps, err := ParseProfiles([]byte(profilesTOML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewStore(nil)
+	s, err := NewProfileSwitcher(store, base, ps)
+	if err != nil {
+		t.Fatalf("NewProfileSwitcher() error = %v", err)
+	}
+	if got, _ := store.Load().GetAlterHostname("www.example.com"); got != "school.example.net" || s.Active() != "school" {
+		t.Errorf("initial profile %q: %q", s.Active(), got)
+	}
+
+	before := store.Load()
+	if err := s.Switch("home"); err != nil {
+		t.Fatalf("Switch() error = %v", err)
+	}
+	if got, _ := store.Load().GetAlterHostname("www.example.com"); got != "home.example.net" {
+		t.Errorf("after Switch(home): %q", got)
+	}
+	if got, _ := before.GetAlterHostname("www.example.com"); got != "school.example.net" {
+		t.Errorf("Switch() changed an earlier snapshot: %q", got)
+	}
+
+	if err := s.Switch("office"); err == nil || s.Active() != "home" {
+		t.Errorf("Switch(office) = %v, active %q", err, s.Active())
+	}
+	if err := s.Switch(""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Load().GetAlterHostname("www.example.com"); got != "front.example.net" {
+		t.Errorf("after Switch(\"\"): %q", got)
+	}
+}
+
+func TestProfileSwitcherNilProfiles(t *testing.T) {
+	base := NewRules()
+	if err := base.FromTOML([]byte(profilesTOML)); err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(nil)
+	s, err := NewProfileSwitcher(store, base, nil)
+	if err != nil {
+		t.Fatalf("NewProfileSwitcher(nil profiles) error = %v", err)
+	}
+	if got, _ := store.Load().GetAlterHostname("www.example.com"); got != "front.example.net" || s.Active() != "" {
+		t.Errorf("base rules %q, active %q", got, s.Active())
+	}
+	if err := s.Switch("home"); err == nil {
+		t.Error("Switch(home) without profiles succeeded")
+	}
+	if err := s.Update(base, nil, ""); err != nil {
+		t.Errorf("Update(nil profiles) error = %v", err)
+	}
+}
+
+func TestWatcherProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.toml")
+	writeRulesFile(t, path, profilesTOML)
+
+	w, err := NewWatcher(path, WatcherOptions{})
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	if got, _ := w.Rules().GetAlterHostname("www.example.com"); got != "school.example.net" {
+		t.Errorf("active profile not applied: %q", got)
+	}
+
+	if err := EditFile(path, func(d *Document) error { return d.SetActiveProfile("home") }); err != nil {
+		t.Fatalf("EditFile() error = %v", err)
+	}
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if got, _ := w.Rules().GetAlterHostname("www.example.com"); got != "home.example.net" {
+		t.Errorf("after switching to home: %q", got)
+	}
+}
+
+func TestDocumentSetActiveProfile(t *testing.T) {
+	input := UserRulesTOML + "\n[profiles.home.hosts]\n\"github.com\" = \"192.0.2.1\"\n"
+	d, err := ParseDocument([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetActiveProfile("away"); err == nil {
+		t.Error("SetActiveProfile() of an undefined profile succeeded")
+	}
+	if err := d.SetActiveProfile("home"); err != nil {
+		t.Fatalf("SetActiveProfile() error = %v", err)
+	}
+	if got := string(d.Bytes()); !strings.Contains(got, "\n\nprofile = \"home\"\n\n[alter_hostname]\n") {
+		t.Errorf("profile key not added before the first table:\n%s", got)
+	}
+	if err := d.SetActiveProfile(""); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(d.Bytes()); got != input {
+		t.Errorf("removing the profile key did not restore the file:\n%s", got)
+	}
+}
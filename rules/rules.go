@@ -1,6 +1,13 @@
 package rules
 
 import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -20,29 +27,59 @@ func LoadFetchedRules() (*Rules, error) {
 }
 
 func loadRules(includeDefaults bool) (*Rules, error) {
-	rules := NewRules()
-	if err := rules.FromTOML([]byte(FetchedRulesTOML)); err != nil {
+	layers, err := LoadLayers()
+	if err != nil {
 		return nil, err
 	}
+	if !includeDefaults {
+		layers = layers[:1]
+	}
 
-	if includeDefaults {
-		// Built-in defaults override fetched rules.
-		defaultRules := NewRules()
-		if err := defaultRules.FromTOML([]byte(DefaultRulesTOML)); err != nil {
-			return nil, err
-		}
-		rules.Merge(defaultRules)
+	rules := NewRules()
+	for _, layer := range layers {
+		rules.Merge(layer.Rules)
+	}
+
+	// Merge already calls Init internally.
+	return rules, nil
+}
 
+// Names of the embedded layers returned by LoadLayers.
+const (
+	LayerFetched = "fetched"
+	LayerDefault = "default"
+	LayerUser    = "user"
+)
+
+// Layer is a named rule set in the merge chain.
+type Layer struct {
+	Name  string
+	Rules *Rules
+}
+
+// LoadLayers parses the embedded rule files without merging them, lowest
+// precedence first: fetched.toml < rules.default.toml < rules.toml.
+func LoadLayers() ([]Layer, error) {
+	sources := []struct {
+		name string
+		data string
+	}{
+		{name: LayerFetched, data: FetchedRulesTOML},
+		// Built-in defaults override fetched rules.
+		{name: LayerDefault, data: DefaultRulesTOML},
 		// User template has highest precedence among embedded defaults.
-		userRules := NewRules()
-		if err := userRules.FromTOML([]byte(UserRulesTOML)); err != nil {
-			return nil, err
-		}
-		rules.Merge(userRules)
+		{name: LayerUser, data: UserRulesTOML},
 	}
 
-	// FromTOML/Merge already call Init internally.
-	return rules, nil
+	layers := make([]Layer, 0, len(sources))
+	for _, src := range sources {
+		r := NewRules()
+		if err := r.FromTOML([]byte(src.data)); err != nil {
+			return nil, fmt.Errorf("%s rules: %w", src.name, err)
+		}
+		layers = append(layers, Layer{Name: src.name, Rules: r})
+	}
+	return layers, nil
 }
 
 // LoadDefaultRules is kept for backward compatibility.
@@ -95,9 +132,39 @@ func ApplyOverrides(base, override *Rules, autoMarker string) {
 		}
 	}
 
+	// Metadata of deleted keys is dropped by Init.
+	if base.Meta == nil {
+		base.Meta = make(map[Section]map[string]RuleMeta)
+	}
+	mergeMeta(base.Meta, override.Meta, SectionAlterHostname, maps.Keys(override.AlterHostname))
+	mergeMeta(base.Meta, override.Meta, SectionCertVerify, maps.Keys(override.CertVerify))
+	mergeMeta(base.Meta, override.Meta, SectionHosts, maps.Keys(override.Hosts))
+
 	base.Init()
 }
 
+// Section names a rule map by its TOML table name.
+type Section string
+
+const (
+	SectionAlterHostname Section = "alter_hostname"
+	SectionCertVerify    Section = "cert_verify"
+	SectionHosts         Section = "hosts"
+)
+
+// Sections lists every rule section in file order.
+var Sections = []Section{SectionAlterHostname, SectionCertVerify, SectionHosts}
+
+// Keys returns the keys of a section in sorted order.
+func (r *Rules) Keys(section Section) []string {
+	keys := make([]string, 0)
+	for k := range r.values(section) {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // CertPolicy represents a certificate verification policy.
 type CertPolicy struct {
 	Verify bool     // Whether to verify hostname
@@ -117,10 +184,35 @@ type Rules struct {
 	// Static hosts mapping: pattern -> IP
 	Hosts map[string]string
 
-	// Pre-computed sorted keys for efficient matching
-	alterHostnameKeys []string
-	certVerifyKeys    []string
-	hostsKeys         []string
+	// Metadata of rules written in the extended form, by section and key
+	Meta map[Section]map[string]RuleMeta
+
+	// Pre-compiled patterns in match order for efficient matching
+	alterHostnameRules compiledRules
+	certVerifyRules    compiledRules
+	hostsRules         compiledRules
+
+	// Legacy "$"-prefixed keys dropped because the plain key also existed
+	droppedKeys []droppedKey
+}
+
+// droppedKey records a key removed while normalizing a section.
+type droppedKey struct {
+	section Section
+	key     string
+	kept    string
+}
+
+// compiledRules holds the keys of a rule map in match order and the matching
+// pattern set; set.Match returns an index into keys.
+type compiledRules struct {
+	keys []string
+	set  *pattern.Set
+	// meta holds the metadata of rules that may not match: disabled ones and
+	// ones with an expiry.
+	meta map[string]RuleMeta
+	// apps holds the applications of rules scoped to some.
+	apps map[string][]string
 }
 
 // NewRules creates a new empty Rules instance.
@@ -133,10 +225,17 @@ func NewRules() *Rules {
 }
 
 // Init initializes and normalizes rules for efficient matching.
+// Patterns that fail to compile never match; use Validate to report them.
 func (r *Rules) Init() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	r.initLocked()
+}
+
+// initLocked normalizes the rule maps and compiles their patterns.
+// Callers must hold r.mu for writing.
+func (r *Rules) initLocked() {
 	// Ensure maps are non-nil to avoid panics
 	if r.AlterHostname == nil {
 		r.AlterHostname = make(map[string]string)
@@ -148,43 +247,139 @@ func (r *Rules) Init() {
 		r.Hosts = make(map[string]string)
 	}
 
-	r.AlterHostname = normalizeMap(r.AlterHostname)
-	r.CertVerify = normalizeMap(r.CertVerify)
-	r.Hosts = normalizeMap(r.Hosts)
+	r.Meta = map[Section]map[string]RuleMeta{
+		SectionAlterHostname: normalizeMeta(r.AlterHostname, r.Meta[SectionAlterHostname]),
+		SectionCertVerify:    normalizeMeta(r.CertVerify, r.Meta[SectionCertVerify]),
+		SectionHosts:         normalizeMeta(r.Hosts, r.Meta[SectionHosts]),
+	}
+	r.AlterHostname = normalizeSection(r, SectionAlterHostname, r.AlterHostname)
+	r.CertVerify = normalizeSection(r, SectionCertVerify, r.CertVerify)
+	r.Hosts = normalizeSection(r, SectionHosts, r.Hosts)
 
-	r.alterHostnameKeys = getSortedKeys(r.AlterHostname)
-	r.certVerifyKeys = getSortedKeys(r.CertVerify)
-	r.hostsKeys = getSortedKeys(r.Hosts)
+	r.alterHostnameRules = compileRules(r.AlterHostname, r.Meta[SectionAlterHostname])
+	r.certVerifyRules = compileRules(r.CertVerify, r.Meta[SectionCertVerify])
+	r.hostsRules = compileRules(r.Hosts, r.Meta[SectionHosts])
 }
 
-// normalizeMap trims the `$` prefix from keys (legacy format).
-func normalizeMap[T any](m map[string]T) map[string]T {
-	if m == nil {
-		return nil
-	}
-	newM := make(map[string]T, len(m))
-	for k, v := range m {
-		newK := strings.TrimPrefix(k, "$")
-		newM[newK] = v
-	}
-	return newM
+// Validate reports every rule key that is not a valid pattern, such as a key with
+// a malformed port, CIDR or internationalized label.
+func (r *Rules) Validate() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var errs []error
+	errs = append(errs, validateKeys(SectionAlterHostname, r.AlterHostname)...)
+	errs = append(errs, validateKeys(SectionCertVerify, r.CertVerify)...)
+	errs = append(errs, validateKeys(SectionHosts, r.Hosts)...)
+	return errors.Join(errs...)
 }
 
-// getSortedKeys returns keys sorted by length (longest first) for pattern matching.
-func getSortedKeys[T any](m map[string]T) []string {
+// validateKeys compiles every key of a rule map, in sorted order for stable output.
+func validateKeys[T any](section Section, m map[string]T) []error {
 	keys := make([]string, 0, len(m))
 	for k := range m {
 		keys = append(keys, k)
 	}
-	// Sort by length descending so more specific patterns match first
-	for i := 0; i < len(keys); i++ {
-		for j := i + 1; j < len(keys); j++ {
-			if len(keys[j]) > len(keys[i]) {
-				keys[i], keys[j] = keys[j], keys[i]
+	sort.Strings(keys)
+
+	var errs []error
+	for _, k := range keys {
+		if _, err := pattern.Compile(k); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", section, err))
+		}
+	}
+	return errs
+}
+
+// compileRules compiles the keys of a rule map and orders them by specificity,
+// most specific first (see pattern.Compare). Keys that are not valid patterns are
+// kept as nil patterns at the end, which never match.
+func compileRules[T any](m map[string]T, meta map[string]RuleMeta) compiledRules {
+	type entry struct {
+		key         string
+		pattern     *pattern.Pattern
+		specificity pattern.Specificity
+	}
+	entries := make([]entry, 0, len(m))
+	for k := range m {
+		p, _ := pattern.Compile(k)
+		// Specificity walks the pattern, so it is computed once per key
+		// rather than on every comparison.
+		entries = append(entries, entry{key: k, pattern: p, specificity: p.Specificity()})
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		switch {
+		case a.pattern == nil && b.pattern == nil:
+			return strings.Compare(a.key, b.key)
+		case a.pattern == nil:
+			return 1
+		case b.pattern == nil:
+			return -1
+		}
+		// pattern.Compare on the cached specificities.
+		if c := pattern.CompareSpecificity(a.specificity, b.specificity); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.pattern.String(), b.pattern.String()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.key, b.key)
+	})
+
+	keys := make([]string, len(entries))
+	patterns := make([]*pattern.Pattern, len(entries))
+	for i, e := range entries {
+		keys[i], patterns[i] = e.key, e.pattern
+	}
+	var inactive map[string]RuleMeta
+	var apps map[string][]string
+	for k, mt := range meta {
+		if mt.Disabled || !mt.Expires.IsZero() {
+			if inactive == nil {
+				inactive = make(map[string]RuleMeta)
 			}
+			inactive[k] = mt
+		}
+		if len(mt.Apps) > 0 {
+			if apps == nil {
+				apps = make(map[string][]string)
+			}
+			apps[k] = mt.Apps
 		}
 	}
-	return keys
+	return compiledRules{keys: keys, set: pattern.NewSet(patterns), meta: inactive, apps: apps}
+}
+
+// normalizeSection normalizes a rule map with normalizeMap and records dropped keys on r.
+func normalizeSection[T any](r *Rules, section Section, m map[string]T) map[string]T {
+	m, dropped := normalizeMap(m)
+	for k, kept := range dropped {
+		r.droppedKeys = append(r.droppedKeys, droppedKey{section: section, key: k, kept: kept})
+	}
+	return m
+}
+
+// normalizeMap trims the `$` prefix from keys (legacy format).
+// If both "$k" and "k" exist, "k" wins; dropped maps each removed key to the kept one.
+func normalizeMap[T any](m map[string]T) (normalized map[string]T, dropped map[string]string) {
+	if m == nil {
+		return nil, nil
+	}
+	newM := make(map[string]T, len(m))
+	for k, v := range m {
+		newK := strings.TrimPrefix(k, "$")
+		if newK != k {
+			if _, ok := m[newK]; ok {
+				if dropped == nil {
+					dropped = make(map[string]string)
+				}
+				dropped[k] = newK
+				continue
+			}
+		}
+		newM[newK] = v
+	}
+	return newM, dropped
 }
 
 // DeepCopy creates a deep copy of the rules.
@@ -193,16 +388,16 @@ func (r *Rules) DeepCopy() *Rules {
 	defer r.mu.RUnlock()
 
 	newR := &Rules{
-		AlterHostname:     copyMap(r.AlterHostname),
-		CertVerify:        copyMap(r.CertVerify),
-		Hosts:             copyMap(r.Hosts),
-		alterHostnameKeys: make([]string, len(r.alterHostnameKeys)),
-		certVerifyKeys:    make([]string, len(r.certVerifyKeys)),
-		hostsKeys:         make([]string, len(r.hostsKeys)),
-	}
-	copy(newR.alterHostnameKeys, r.alterHostnameKeys)
-	copy(newR.certVerifyKeys, r.certVerifyKeys)
-	copy(newR.hostsKeys, r.hostsKeys)
+		AlterHostname: copyMap(r.AlterHostname),
+		CertVerify:    copyMap(r.CertVerify),
+		Hosts:         copyMap(r.Hosts),
+		Meta:          copyMeta(r.Meta),
+		// Compiled rules are immutable and can be shared.
+		alterHostnameRules: r.alterHostnameRules,
+		certVerifyRules:    r.certVerifyRules,
+		hostsRules:         r.hostsRules,
+		droppedKeys:        slices.Clone(r.droppedKeys),
+	}
 	return newR
 }
 
@@ -219,65 +414,120 @@ func copyMap[T any](m map[string]T) map[string]T {
 }
 
 // GetAlterHostname returns the target SNI for a host, or false if no rule matches.
+// Port-restricted rules are ignored; use LookupAlterHostname when the port is known.
 func (r *Rules) GetAlterHostname(host string) (string, bool) {
+	return r.LookupAlterHostname(host, 0)
+}
+
+// GetHost returns the mapped IP for a host, or false if no rule matches.
+// Port-restricted rules are ignored; use LookupHost when the port is known.
+func (r *Rules) GetHost(host string) (string, bool) {
+	return r.LookupHost(host, 0)
+}
+
+// GetCertVerify returns the certificate verification policy for a host, or false if no rule matches.
+// Port-restricted rules are ignored; use LookupCertVerify when the port is known.
+func (r *Rules) GetCertVerify(host string) (CertPolicy, bool) {
+	return r.LookupCertVerify(host, 0)
+}
+
+// LookupAlterHostname returns the target SNI for a host and port, or false if no rule matches.
+// A port of 0 means unknown, in which case only port-less rules apply.
+func (r *Rules) LookupAlterHostname(host string, port int) (string, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	// Exact match first
-	if val, ok := r.AlterHostname[host]; ok {
-		return val, true
-	}
+	return lookup(r.AlterHostname, r.alterHostnameRules, LookupContext{Host: host, Port: port})
+}
 
-	// Pattern matching
-	for _, k := range r.alterHostnameKeys {
-		if pattern.MatchPattern(k, host) {
-			return r.AlterHostname[k], true
-		}
-	}
+// LookupHost returns the mapped IP for a host and port, or false if no rule matches.
+// A port of 0 means unknown, in which case only port-less rules apply.
+func (r *Rules) LookupHost(host string, port int) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	return "", false
+	return lookup(r.Hosts, r.hostsRules, LookupContext{Host: host, Port: port})
 }
 
-// GetHost returns the mapped IP for a host, or false if no rule matches.
-func (r *Rules) GetHost(host string) (string, bool) {
+// LookupCertVerify returns the certificate verification policy for a host and port,
+// or false if no rule matches. A port of 0 means unknown, in which case only port-less rules apply.
+func (r *Rules) LookupCertVerify(host string, port int) (CertPolicy, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	// Exact match first
-	if val, ok := r.Hosts[host]; ok {
-		return val, true
+	val, ok := lookup(r.CertVerify, r.certVerifyRules, LookupContext{Host: host, Port: port})
+	if !ok {
+		return CertPolicy{}, false
 	}
+	p, _ := ParseCertPolicy(val)
+	return p, true
+}
 
-	// Pattern matching
-	for _, k := range r.hostsKeys {
-		if pattern.MatchPattern(k, host) {
-			return r.Hosts[k], true
-		}
+// LookupKey returns the key of the rule that the section's Lookup method uses
+// for a host and port, or false if no rule matches.
+func (r *Rules) LookupKey(section Section, host string, port int) (string, bool) {
+	return r.LookupKeyContext(section, LookupContext{Host: host, Port: port})
+}
+
+// lookup finds the value of the first rule matching ctx.
+// Callers must hold r.mu.
+func lookup[T any](m map[string]T, rules compiledRules, ctx LookupContext) (T, bool) {
+	if k, ok := lookupKey(m, rules, ctx); ok {
+		return m[k], true
 	}
+	var zero T
+	return zero, false
+}
 
-	return "", false
+// lookupKey finds the key of the first rule matching ctx: among the rules
+// scoped to ctx.App first, then among the global rules.
+// Callers must hold r.mu.
+func lookupKey[T any](m map[string]T, rules compiledRules, ctx LookupContext) (string, bool) {
+	host := pattern.NormalizeHost(ctx.Host)
+	if ctx.App != "" && len(rules.apps) > 0 {
+		if k, ok := findKey(m, rules, host, ctx.Port, func(k string) bool {
+			return slices.Contains(rules.apps[k], ctx.App) && rules.active(k)
+		}); ok {
+			return k, true
+		}
+	}
+	if len(rules.meta) == 0 && len(rules.apps) == 0 {
+		return findKey(m, rules, host, ctx.Port, nil)
+	}
+	return findKey(m, rules, host, ctx.Port, rules.global)
 }
 
-// GetCertVerify returns the certificate verification policy for a host, or false if no rule matches.
-func (r *Rules) GetCertVerify(host string) (CertPolicy, bool) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+// findKey finds the key of the first rule matching a normalized host and port
+// for which accept, if not nil, returns true.
+func findKey[T any](m map[string]T, rules compiledRules, host string, port int, accept func(string) bool) (string, bool) {
+	ok := func(k string) bool { return hasKey(m, k) && (accept == nil || accept(k)) }
 
-	// Exact match first
-	if val, ok := r.CertVerify[host]; ok {
-		p, _ := ParseCertPolicy(val)
-		return p, true
+	// Exact match first, preferring a "host:port" key over the bare host
+	if port > 0 {
+		if k := net.JoinHostPort(host, strconv.Itoa(port)); ok(k) {
+			return k, true
+		}
+	}
+	if ok(host) {
+		return host, true
 	}
 
-	// Pattern matching
-	for _, k := range r.certVerifyKeys {
-		if pattern.MatchPattern(k, host) {
-			p, _ := ParseCertPolicy(r.CertVerify[k])
-			return p, true
+	// Pattern matching, skipping rejected rules
+	if rules.set != nil {
+		var acceptIndex func(int) bool
+		if accept != nil {
+			acceptIndex = func(i int) bool { return accept(rules.keys[i]) }
+		}
+		if i, found := rules.set.MatchFunc(host, port, acceptIndex); found {
+			return rules.keys[i], true
 		}
 	}
+	return "", false
+}
 
-	return CertPolicy{}, false
+func hasKey[T any](m map[string]T, k string) bool {
+	_, ok := m[k]
+	return ok
 }
 
 // Merge merges another Rules instance into this one.
@@ -309,14 +559,15 @@ func (r *Rules) Merge(other *Rules) {
 	for k, v := range other.Hosts {
 		r.Hosts[k] = v
 	}
+	if r.Meta == nil {
+		r.Meta = make(map[Section]map[string]RuleMeta)
+	}
+	mergeMeta(r.Meta, other.Meta, SectionAlterHostname, maps.Keys(other.AlterHostname))
+	mergeMeta(r.Meta, other.Meta, SectionCertVerify, maps.Keys(other.CertVerify))
+	mergeMeta(r.Meta, other.Meta, SectionHosts, maps.Keys(other.Hosts))
+	r.droppedKeys = append(r.droppedKeys, other.droppedKeys...)
 
-	// Call Init logic inline to avoid deadlock (r.mu is already held)
-	r.AlterHostname = normalizeMap(r.AlterHostname)
-	r.CertVerify = normalizeMap(r.CertVerify)
-	r.Hosts = normalizeMap(r.Hosts)
-	r.alterHostnameKeys = getSortedKeys(r.AlterHostname)
-	r.certVerifyKeys = getSortedKeys(r.CertVerify)
-	r.hostsKeys = getSortedKeys(r.Hosts)
+	r.initLocked()
 }
 
 // ParseCertPolicy parses a policy value from config.
@@ -354,6 +605,8 @@ func ParseCertPolicy(val interface{}) (CertPolicy, bool) {
 
 // ToJSONRules converts Rules to JSON format for Android.
 type JSONRules struct {
+	// Version is the file format version (see SchemaVersion).
+	Version      int              `json:"version"`
 	Rules        []JSONRule       `json:"rules"`
 	CertVerify   []JSONCertVerify `json:"cert_verify"`
 	NameServers  []string         `json:"nameservers,omitempty"`
@@ -370,12 +623,51 @@ type JSONRule struct {
 	TargetSNI  *string  `json:"target_sni"`
 	TargetIP   *string  `json:"target_ip"`
 	CertVerify any      `json:"cert_verify,omitempty"`
+	JSONRuleMeta
 }
 
 // JSONCertVerify represents a cert verify rule in JSON format.
 type JSONCertVerify struct {
 	Patterns []string `json:"patterns"`
 	Verify   any      `json:"verify"`
+	JSONRuleMeta
+}
+
+// JSONRuleMeta is RuleMeta in JSON format. Expires is a date ("2026-12-01")
+// or an RFC 3339 date-time.
+type JSONRuleMeta struct {
+	Apps    []string `json:"apps,omitempty"`
+	Enabled *bool    `json:"enabled,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Note    string   `json:"note,omitempty"`
+	Expires string   `json:"expires,omitempty"`
+}
+
+func jsonRuleMeta(m RuleMeta) JSONRuleMeta {
+	j := JSONRuleMeta{Apps: m.Apps, Tags: m.Tags, Note: m.Note}
+	if m.Disabled {
+		j.Enabled = new(bool)
+	}
+	if !m.Expires.IsZero() {
+		j.Expires = formatExpires(m.Expires)
+	}
+	return j
+}
+
+// ruleMeta converts j to RuleMeta.
+func (j JSONRuleMeta) ruleMeta() (RuleMeta, error) {
+	m := RuleMeta{Apps: j.Apps, Tags: j.Tags, Note: j.Note}
+	if j.Enabled != nil {
+		m.Disabled = !*j.Enabled
+	}
+	if j.Expires != "" {
+		t, err := parseExpires(j.Expires)
+		if err != nil {
+			return RuleMeta{}, err
+		}
+		m.Expires = t
+	}
+	return m, nil
 }
 
 // ToJSONRules converts Rules to JSONRules format.
@@ -384,54 +676,62 @@ func (r *Rules) ToJSONRules() *JSONRules {
 	defer r.mu.RUnlock()
 
 	jsonRules := &JSONRules{
+		Version:    SchemaVersion,
 		Rules:      make([]JSONRule, 0, len(r.AlterHostname)),
 		CertVerify: make([]JSONCertVerify, 0, len(r.CertVerify)),
 	}
 
 	for pattern, target := range r.AlterHostname {
 		jsonRules.Rules = append(jsonRules.Rules, JSONRule{
-			Patterns:  []string{pattern},
-			TargetSNI: &target,
+			Patterns:     []string{pattern},
+			TargetSNI:    &target,
+			JSONRuleMeta: jsonRuleMeta(r.Meta[SectionAlterHostname][pattern]),
 		})
 	}
 
 	for pattern, policy := range r.CertVerify {
 		jsonRules.CertVerify = append(jsonRules.CertVerify, JSONCertVerify{
-			Patterns: []string{pattern},
-			Verify:   policy,
+			Patterns:     []string{pattern},
+			Verify:       policy,
+			JSONRuleMeta: jsonRuleMeta(r.Meta[SectionCertVerify][pattern]),
 		})
 	}
 
 	return jsonRules
 }
 
-// FromJSONRules updates Rules from JSONRules format.
+// FromJSONRules updates Rules from JSONRules format. The metadata of a rule
+// applies to each of its patterns; an unparsable expiry is ignored (FromJSON
+// reports it).
 func (r *Rules) FromJSONRules(jsonRules *JSONRules) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	r.AlterHostname = make(map[string]string, len(jsonRules.Rules))
 	r.CertVerify = make(map[string]interface{}, len(jsonRules.CertVerify))
+	if r.Meta == nil {
+		r.Meta = make(map[Section]map[string]RuleMeta)
+	}
+	r.Meta[SectionAlterHostname] = make(map[string]RuleMeta)
+	r.Meta[SectionCertVerify] = make(map[string]RuleMeta)
 
 	for _, rule := range jsonRules.Rules {
+		meta, _ := rule.ruleMeta()
 		for _, pattern := range rule.Patterns {
 			if rule.TargetSNI != nil {
 				r.AlterHostname[pattern] = *rule.TargetSNI
+				r.Meta[SectionAlterHostname][pattern] = meta
 			}
 		}
 	}
 
 	for _, rule := range jsonRules.CertVerify {
+		meta, _ := rule.ruleMeta()
 		for _, pattern := range rule.Patterns {
 			r.CertVerify[pattern] = rule.Verify
+			r.Meta[SectionCertVerify][pattern] = meta
 		}
 	}
 
-	// Call Init logic inline to avoid deadlock (r.mu is already held)
-	r.AlterHostname = normalizeMap(r.AlterHostname)
-	r.CertVerify = normalizeMap(r.CertVerify)
-	r.Hosts = normalizeMap(r.Hosts)
-	r.alterHostnameKeys = getSortedKeys(r.AlterHostname)
-	r.certVerifyKeys = getSortedKeys(r.CertVerify)
-	r.hostsKeys = getSortedKeys(r.Hosts)
+	r.initLocked()
 }
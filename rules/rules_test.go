@@ -1,6 +1,7 @@
 package rules
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -176,3 +177,233 @@ func TestApplyOverrides_AutoMarkerDeletes(t *testing.T) {
 		t.Fatalf("hosts should be removed by auto marker")
 	}
 }
+
+func TestIPRangeRules(t *testing.T) {
+	tomlData := `
+[alter_hostname]
+"ip:203.0.113.0/24" = "cdn.example.com"
+
+[cert_verify]
+"2001:db8::/32" = false
+`
+
+	r := NewRules()
+	if err := r.FromTOML([]byte(tomlData)); err != nil {
+		t.Fatalf("FromTOML() error = %v", err)
+	}
+
+	if got, ok := r.GetAlterHostname("203.0.113.10"); !ok || got != "cdn.example.com" {
+		t.Fatalf("GetAlterHostname() = %q, %v; want cdn.example.com", got, ok)
+	}
+	if _, ok := r.GetAlterHostname("198.51.100.1"); ok {
+		t.Fatal("GetAlterHostname() matched an address outside the range")
+	}
+	if got, ok := r.GetCertVerify("[2001:db8::443]"); !ok || got.Verify {
+		t.Fatalf("GetCertVerify() = %+v, %v; want verify=false", got, ok)
+	}
+}
+
+func TestLookupWithPort(t *testing.T) {
+	tomlData := `
+[alter_hostname]
+"*.example.com" = "default.example.net"
+"*.example.com:443" = "tls.example.net"
+"*.example.com:8443" = "__AUTO__"
+
+[hosts]
+"example.com" = "192.0.2.1"
+"example.com:8080" = "192.0.2.80"
+`
+
+	r := NewRules()
+	if err := r.FromTOML([]byte(tomlData)); err != nil {
+		t.Fatalf("FromTOML() error = %v", err)
+	}
+
+	tests := []struct {
+		lookup func(string, int) (string, bool)
+		host   string
+		port   int
+		want   string
+	}{
+		{lookup: r.LookupAlterHostname, host: "www.example.com", port: 443, want: "tls.example.net"},
+		{lookup: r.LookupAlterHostname, host: "www.example.com", port: 8443, want: "__AUTO__"},
+		{lookup: r.LookupAlterHostname, host: "www.example.com", port: 80, want: "default.example.net"},
+		{lookup: r.LookupAlterHostname, host: "www.example.com", port: 0, want: "default.example.net"},
+		{lookup: r.LookupHost, host: "example.com", port: 8080, want: "192.0.2.80"},
+		{lookup: r.LookupHost, host: "example.com", port: 443, want: "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		if got, ok := tt.lookup(tt.host, tt.port); !ok || got != tt.want {
+			t.Errorf("lookup(%q, %d) = %q, %v; want %q", tt.host, tt.port, got, ok, tt.want)
+		}
+	}
+
+	if got, ok := r.GetAlterHostname("www.example.com"); !ok || got != "default.example.net" {
+		t.Errorf("GetAlterHostname() = %q, %v; want port-less rule", got, ok)
+	}
+}
+
+func TestLookupKey(t *testing.T) {
+	r := NewRules()
+	r.AlterHostname["*.example.com"] = "a"
+	r.AlterHostname["*.example.com:443"] = "b"
+	r.Hosts["Example.com"] = "192.0.2.1"
+	r.Hosts["example.com:8080"] = "192.0.2.80"
+	r.Init()
+
+	tests := []struct {
+		section Section
+		host    string
+		port    int
+		want    string
+	}{
+		{SectionAlterHostname, "www.example.com", 443, "*.example.com:443"},
+		{SectionAlterHostname, "www.example.com", 0, "*.example.com"},
+		{SectionHosts, "EXAMPLE.com.", 0, "Example.com"},
+		{SectionHosts, "example.com", 8080, "example.com:8080"},
+		{SectionCertVerify, "www.example.com", 443, ""},
+	}
+	for _, tt := range tests {
+		got, ok := r.LookupKey(tt.section, tt.host, tt.port)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("LookupKey(%s, %q, %d) = %q, %v; want %q", tt.section, tt.host, tt.port, got, ok, tt.want)
+		}
+	}
+}
+
+func TestIDNRules(t *testing.T) {
+	tomlData := `
+[alter_hostname]
+"*.例え.jp" = "g.cn"
+"*.xn--bcher-kva.example" = "books.example"
+`
+
+	r := NewRules()
+	if err := r.FromTOML([]byte(tomlData)); err != nil {
+		t.Fatalf("FromTOML() error = %v", err)
+	}
+	if err := r.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	if got, ok := r.GetAlterHostname("www.xn--r8jz45g.jp"); !ok || got != "g.cn" {
+		t.Errorf("GetAlterHostname(punycode) = %q, %v; want g.cn", got, ok)
+	}
+	if got, ok := r.GetAlterHostname("shop.Bücher.example"); !ok || got != "books.example" {
+		t.Errorf("GetAlterHostname(U-label) = %q, %v; want books.example", got, ok)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	r := NewRules()
+	r.AlterHostname["*.xn--zz.com"] = "g.cn"
+	r.Hosts["example.com:https"] = "192.0.2.1"
+	r.CertVerify["#*google*"] = true
+	r.Init()
+
+	err := r.Validate()
+	if err == nil {
+		t.Fatal("Validate() should reject invalid patterns")
+	}
+	for _, want := range []string{"alter_hostname", "xn--zz", "hosts", "example.com:https"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error %q does not mention %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "google") {
+		t.Errorf("Validate() should not report ignored patterns: %v", err)
+	}
+	if _, ok := r.GetAlterHostname("a.xn--zz.com"); ok {
+		t.Error("invalid pattern should never match")
+	}
+}
+
+func TestLoadRules_Validate(t *testing.T) {
+	r, err := LoadRules()
+	if err != nil {
+		t.Fatalf("LoadRules() error = %v", err)
+	}
+	if err := r.Validate(); err != nil {
+		t.Fatalf("embedded rules should be valid: %v", err)
+	}
+}
+
+func TestRegexRules(t *testing.T) {
+	tomlData := `
+[alter_hostname]
+"re:cdn[0-9]+\\.example\\.com" = "cdn.example.net"
+"*example.com" = "www.example.net"
+`
+
+	r := NewRules()
+	if err := r.FromTOML([]byte(tomlData)); err != nil {
+		t.Fatalf("FromTOML() error = %v", err)
+	}
+	if err := r.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	if got, ok := r.GetAlterHostname("cdn12.example.com"); !ok || got != "cdn.example.net" {
+		t.Errorf("GetAlterHostname(regex) = %q, %v; want cdn.example.net", got, ok)
+	}
+	if got, ok := r.GetAlterHostname("img.example.com"); !ok || got != "www.example.net" {
+		t.Errorf("GetAlterHostname(glob) = %q, %v; want www.example.net", got, ok)
+	}
+}
+
+func TestSpecificityOrdering(t *testing.T) {
+	tomlData := `
+[alter_hostname]
+"*google.com" = "infix"
+"*.google.com" = "suffix"
+"$*.mail.google.com" = "deeper suffix"
+"a*.com" = "tie a"
+"*b.com" = "tie b"
+
+[cert_verify]
+"*google.com" = "infix"
+"*.google.com" = "suffix"
+"$*.mail.google.com" = "deeper suffix"
+"a*.com" = "tie a"
+"*b.com" = "tie b"
+
+[hosts]
+"*google.com" = "infix"
+"*.google.com" = "suffix"
+"$*.mail.google.com" = "deeper suffix"
+"a*.com" = "tie a"
+"*b.com" = "tie b"
+`
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "fakegoogle.com", want: "infix"},
+		{host: "www.google.com", want: "suffix"},
+		{host: "inbox.mail.google.com", want: "deeper suffix"},
+		// Equal specificity breaks ties by key: "*b.com" < "a*.com".
+		{host: "ab.com", want: "tie b"},
+	}
+
+	// Repeat to catch ordering that depends on map iteration.
+	for i := 0; i < 20; i++ {
+		r := NewRules()
+		if err := r.FromTOML([]byte(tomlData)); err != nil {
+			t.Fatalf("FromTOML() error = %v", err)
+		}
+		for _, tt := range tests {
+			if got, _ := r.GetAlterHostname(tt.host); got != tt.want {
+				t.Fatalf("GetAlterHostname(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+			if got, _ := r.GetHost(tt.host); got != tt.want {
+				t.Fatalf("GetHost(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+			if got, _ := r.GetCertVerify(tt.host); len(got.Allow) != 1 || got.Allow[0] != tt.want {
+				t.Fatalf("GetCertVerify(%q) = %+v, want %q", tt.host, got, tt.want)
+			}
+		}
+	}
+}
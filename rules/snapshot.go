@@ -0,0 +1,315 @@
+package rules
+
+import (
+	"maps"
+	"slices"
+	"sync/atomic"
+)
+
+// Snapshot is an immutable, compiled rule set. Lookups take no locks, and a
+// snapshot never changes after Build, so readers always see a whole rule set.
+// Use a Builder to derive a modified snapshot and a Store to publish it.
+type Snapshot struct {
+	alterHostname map[string]string
+	certVerify    map[string]any
+	hosts         map[string]string
+	meta          map[Section]map[string]RuleMeta
+
+	alterHostnameRules compiledRules
+	certVerifyRules    compiledRules
+	hostsRules         compiledRules
+}
+
+// emptySnapshot has no rules.
+var emptySnapshot = NewBuilder().Build()
+
+// Snapshot returns an immutable snapshot of the current contents of r.
+func (r *Rules) Snapshot() *Snapshot {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	b := NewBuilder()
+	maps.Copy(b.alterHostname, r.AlterHostname)
+	maps.Copy(b.certVerify, r.CertVerify)
+	maps.Copy(b.hosts, r.Hosts)
+	b.meta = copyMeta(r.Meta)
+	return b.Build()
+}
+
+// LookupAlterHostname is Rules.LookupAlterHostname for the snapshot.
+func (s *Snapshot) LookupAlterHostname(host string, port int) (string, bool) {
+	return lookup(s.alterHostname, s.alterHostnameRules, LookupContext{Host: host, Port: port})
+}
+
+// LookupHost is Rules.LookupHost for the snapshot.
+func (s *Snapshot) LookupHost(host string, port int) (string, bool) {
+	return lookup(s.hosts, s.hostsRules, LookupContext{Host: host, Port: port})
+}
+
+// LookupCertVerify is Rules.LookupCertVerify for the snapshot.
+func (s *Snapshot) LookupCertVerify(host string, port int) (CertPolicy, bool) {
+	val, ok := lookup(s.certVerify, s.certVerifyRules, LookupContext{Host: host, Port: port})
+	if !ok {
+		return CertPolicy{}, false
+	}
+	p, _ := ParseCertPolicy(val)
+	return p, true
+}
+
+// GetAlterHostname is LookupAlterHostname with an unknown port.
+func (s *Snapshot) GetAlterHostname(host string) (string, bool) {
+	return s.LookupAlterHostname(host, 0)
+}
+
+// GetHost is LookupHost with an unknown port.
+func (s *Snapshot) GetHost(host string) (string, bool) {
+	return s.LookupHost(host, 0)
+}
+
+// GetCertVerify is LookupCertVerify with an unknown port.
+func (s *Snapshot) GetCertVerify(host string) (CertPolicy, bool) {
+	return s.LookupCertVerify(host, 0)
+}
+
+// LookupKey is Rules.LookupKey for the snapshot.
+func (s *Snapshot) LookupKey(section Section, host string, port int) (string, bool) {
+	return s.LookupKeyContext(section, LookupContext{Host: host, Port: port})
+}
+
+// Value returns the value of a key in a section.
+func (s *Snapshot) Value(section Section, key string) (any, bool) {
+	var v any
+	var ok bool
+	switch section {
+	case SectionAlterHostname:
+		v, ok = s.alterHostname[key]
+	case SectionCertVerify:
+		v, ok = s.certVerify[key]
+	case SectionHosts:
+		v, ok = s.hosts[key]
+	}
+	return v, ok
+}
+
+// Keys returns the keys of a section in sorted order.
+func (s *Snapshot) Keys(section Section) []string {
+	switch section {
+	case SectionAlterHostname:
+		return slices.Sorted(maps.Keys(s.alterHostname))
+	case SectionCertVerify:
+		return slices.Sorted(maps.Keys(s.certVerify))
+	case SectionHosts:
+		return slices.Sorted(maps.Keys(s.hosts))
+	}
+	return nil
+}
+
+// RuleMeta is Rules.RuleMeta for the snapshot.
+func (s *Snapshot) RuleMeta(section Section, key string) (RuleMeta, bool) {
+	m, ok := s.meta[section][key]
+	return m, ok
+}
+
+// Rules returns a mutable, initialized copy of the snapshot, e.g. for
+// serialization with ToTOML.
+func (s *Snapshot) Rules() *Rules {
+	r := &Rules{
+		AlterHostname: maps.Clone(s.alterHostname),
+		CertVerify:    maps.Clone(s.certVerify),
+		Hosts:         maps.Clone(s.hosts),
+		Meta:          copyMeta(s.meta),
+	}
+	r.Init()
+	return r
+}
+
+// Builder accumulates changes for a new Snapshot. Its methods return the
+// builder so calls can be chained; a Builder is not safe for concurrent use.
+type Builder struct {
+	alterHostname map[string]string
+	certVerify    map[string]any
+	hosts         map[string]string
+	meta          map[Section]map[string]RuleMeta
+}
+
+// NewBuilder returns a builder with no rules.
+func NewBuilder() *Builder {
+	return &Builder{
+		alterHostname: make(map[string]string),
+		certVerify:    make(map[string]any),
+		hosts:         make(map[string]string),
+		meta:          make(map[Section]map[string]RuleMeta),
+	}
+}
+
+// Builder returns a builder starting from the snapshot's rules. The snapshot
+// itself is not affected by the builder.
+func (s *Snapshot) Builder() *Builder {
+	return &Builder{
+		alterHostname: maps.Clone(s.alterHostname),
+		certVerify:    maps.Clone(s.certVerify),
+		hosts:         maps.Clone(s.hosts),
+		meta:          copyMeta(s.meta),
+	}
+}
+
+// SetAlterHostname sets the target SNI of a pattern.
+func (b *Builder) SetAlterHostname(key, sni string) *Builder {
+	b.alterHostname[key] = sni
+	return b
+}
+
+// SetHost sets the address of a pattern.
+func (b *Builder) SetHost(key, addr string) *Builder {
+	b.hosts[key] = addr
+	return b
+}
+
+// SetCertVerify sets the certificate policy of a pattern (see ParseCertPolicy).
+func (b *Builder) SetCertVerify(key string, policy any) *Builder {
+	b.certVerify[key] = policy
+	return b
+}
+
+// SetRuleMeta sets the metadata of a pattern; zero metadata removes it.
+func (b *Builder) SetRuleMeta(section Section, key string, meta RuleMeta) *Builder {
+	if meta.IsZero() {
+		delete(b.meta[section], key)
+		return b
+	}
+	if b.meta[section] == nil {
+		b.meta[section] = make(map[string]RuleMeta)
+	}
+	b.meta[section][key] = meta
+	return b
+}
+
+// Delete removes a key and its metadata from a section.
+func (b *Builder) Delete(section Section, key string) *Builder {
+	switch section {
+	case SectionAlterHostname:
+		delete(b.alterHostname, key)
+	case SectionCertVerify:
+		delete(b.certVerify, key)
+	case SectionHosts:
+		delete(b.hosts, key)
+	}
+	delete(b.meta[section], key)
+	return b
+}
+
+// Merge adds the rules of other, which take precedence for conflicting keys
+// (see Rules.Merge).
+func (b *Builder) Merge(other *Rules) *Builder {
+	other.mu.RLock()
+	defer other.mu.RUnlock()
+
+	maps.Copy(b.alterHostname, other.AlterHostname)
+	maps.Copy(b.certVerify, other.CertVerify)
+	maps.Copy(b.hosts, other.Hosts)
+	mergeMeta(b.meta, other.Meta, SectionAlterHostname, maps.Keys(other.AlterHostname))
+	mergeMeta(b.meta, other.Meta, SectionCertVerify, maps.Keys(other.CertVerify))
+	mergeMeta(b.meta, other.Meta, SectionHosts, maps.Keys(other.Hosts))
+	return b
+}
+
+// ApplyOverrides applies user overrides, deleting keys whose override value is
+// autoMarker (see ApplyOverrides).
+func (b *Builder) ApplyOverrides(override *Rules, autoMarker string) *Builder {
+	if autoMarker == "" {
+		autoMarker = DefaultAutoMarker
+	}
+	override.mu.RLock()
+	defer override.mu.RUnlock()
+
+	for k, v := range override.AlterHostname {
+		if v == autoMarker {
+			delete(b.alterHostname, k)
+		} else {
+			b.alterHostname[k] = v
+		}
+	}
+	for k, v := range override.CertVerify {
+		if marker, ok := v.(string); ok && marker == autoMarker {
+			delete(b.certVerify, k)
+		} else {
+			b.certVerify[k] = v
+		}
+	}
+	for k, v := range override.Hosts {
+		if v == autoMarker {
+			delete(b.hosts, k)
+		} else {
+			b.hosts[k] = v
+		}
+	}
+	// Metadata of deleted keys is dropped by Build.
+	mergeMeta(b.meta, override.Meta, SectionAlterHostname, maps.Keys(override.AlterHostname))
+	mergeMeta(b.meta, override.Meta, SectionCertVerify, maps.Keys(override.CertVerify))
+	mergeMeta(b.meta, override.Meta, SectionHosts, maps.Keys(override.Hosts))
+	return b
+}
+
+// Build normalizes and compiles the rules into a new snapshot. The builder can
+// keep being used; later changes do not affect the snapshot.
+func (b *Builder) Build() *Snapshot {
+	meta := map[Section]map[string]RuleMeta{
+		SectionAlterHostname: normalizeMeta(b.alterHostname, b.meta[SectionAlterHostname]),
+		SectionCertVerify:    normalizeMeta(b.certVerify, b.meta[SectionCertVerify]),
+		SectionHosts:         normalizeMeta(b.hosts, b.meta[SectionHosts]),
+	}
+	alterHostname, _ := normalizeMap(b.alterHostname)
+	certVerify, _ := normalizeMap(b.certVerify)
+	hosts, _ := normalizeMap(b.hosts)
+	return &Snapshot{
+		alterHostname:      alterHostname,
+		certVerify:         certVerify,
+		hosts:              hosts,
+		meta:               meta,
+		alterHostnameRules: compileRules(alterHostname, meta[SectionAlterHostname]),
+		certVerifyRules:    compileRules(certVerify, meta[SectionCertVerify]),
+		hostsRules:         compileRules(hosts, meta[SectionHosts]),
+	}
+}
+
+// Store publishes snapshots to concurrent readers through an atomic pointer.
+// Readers call Load and use the snapshot for as long as they need; writers
+// publish whole new snapshots with Store or Update.
+type Store struct {
+	current atomic.Pointer[Snapshot]
+}
+
+// NewStore returns a store publishing s, or an empty snapshot if s is nil.
+func NewStore(s *Snapshot) *Store {
+	st := &Store{}
+	st.Store(s)
+	return st
+}
+
+// Load returns the current snapshot.
+func (st *Store) Load() *Snapshot {
+	return st.current.Load()
+}
+
+// Store publishes s, or an empty snapshot if s is nil.
+func (st *Store) Store(s *Snapshot) {
+	if s == nil {
+		s = emptySnapshot
+	}
+	st.current.Store(s)
+}
+
+// Update derives a new snapshot from the current one with fn and publishes it.
+// If another writer publishes first, fn is called again on a fresh builder, so
+// it must not have side effects. It returns the published snapshot.
+func (st *Store) Update(fn func(*Builder)) *Snapshot {
+	for {
+		old := st.current.Load()
+		b := old.Builder()
+		fn(b)
+		next := b.Build()
+		if st.current.CompareAndSwap(old, next) {
+			return next
+		}
+	}
+}
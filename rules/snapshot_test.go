@@ -0,0 +1,223 @@
+package rules
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSnapshotMatchesRules(t *testing.T) {
+	r, err := LoadRules()
+	if err != nil {
+		t.Fatalf("LoadRules() error = %v", err)
+	}
+	s := r.Snapshot()
+
+	for _, host := range SampleHosts(r) {
+		for _, port := range []int{0, 443} {
+			want, wantOK := r.LookupAlterHostname(host, port)
+			if got, ok := s.LookupAlterHostname(host, port); got != want || ok != wantOK {
+				t.Errorf("LookupAlterHostname(%q, %d) = %q, %v; want %q, %v", host, port, got, ok, want, wantOK)
+			}
+			want, wantOK = r.LookupHost(host, port)
+			if got, ok := s.LookupHost(host, port); got != want || ok != wantOK {
+				t.Errorf("LookupHost(%q, %d) = %q, %v; want %q, %v", host, port, got, ok, want, wantOK)
+			}
+			wantPolicy, wantOK := r.LookupCertVerify(host, port)
+			if got, ok := s.LookupCertVerify(host, port); !slices.Equal(got.Allow, wantPolicy.Allow) || got.Verify != wantPolicy.Verify || ok != wantOK {
+				t.Errorf("LookupCertVerify(%q, %d) = %+v, %v; want %+v, %v", host, port, got, ok, wantPolicy, wantOK)
+			}
+		}
+	}
+	for _, section := range Sections {
+		if got, want := s.Keys(section), r.Keys(section); !slices.Equal(got, want) {
+			t.Errorf("Keys(%s) = %d keys, want %d", section, len(got), len(want))
+		}
+	}
+	if d := Diff(r, s.Rules()); !d.Empty() {
+		t.Errorf("Rules() differs from the source:\n%s", d)
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	s := NewBuilder().
+		SetAlterHostname("*.example.com", "front.example.net").
+		SetHost("$legacy.example", "192.0.2.9").
+		SetCertVerify("*.example.com", []any{"front.example.net"}).
+		Build()
+
+	next := s.Builder().
+		SetAlterHostname("*.example.com", "other.example.net").
+		Delete(SectionHosts, "legacy.example").
+		Build()
+
+	if got, _ := s.GetAlterHostname("www.example.com"); got != "front.example.net" {
+		t.Errorf("source snapshot changed: %q", got)
+	}
+	if got, ok := s.GetHost("legacy.example"); !ok || got != "192.0.2.9" {
+		t.Errorf("legacy $ key = %q, %v", got, ok)
+	}
+	if got, _ := next.GetAlterHostname("www.example.com"); got != "other.example.net" {
+		t.Errorf("derived snapshot = %q", got)
+	}
+	if _, ok := next.GetHost("legacy.example"); ok {
+		t.Error("Delete() left the key in place")
+	}
+	if p, ok := next.GetCertVerify("www.example.com"); !ok || p.Verify || !slices.Equal(p.Allow, []string{"front.example.net"}) {
+		t.Errorf("GetCertVerify() = %+v, %v", p, ok)
+	}
+	if key, ok := next.LookupKey(SectionAlterHostname, "www.example.com", 443); !ok || key != "*.example.com" {
+		t.Errorf("LookupKey() = %q, %v", key, ok)
+	}
+
+	// A builder keeps working after Build without affecting earlier snapshots.
+	b := NewBuilder().SetHost("example.com", "192.0.2.1")
+	first := b.Build()
+	b.SetHost("example.com", "192.0.2.2")
+	if got, _ := first.GetHost("example.com"); got != "192.0.2.1" {
+		t.Errorf("Build() snapshot changed after further edits: %q", got)
+	}
+}
+
+func TestBuilderApplyOverrides(t *testing.T) {
+	base := NewRules()
+	base.AlterHostname["example.com"] = "target.com"
+	base.Hosts["example.com"] = "192.0.2.1"
+	base.Init()
+
+	override := NewRules()
+	override.AlterHostname["example.com"] = DefaultAutoMarker
+	override.Hosts["example.com"] = "192.0.2.2"
+	override.Init()
+
+	s := NewBuilder().Merge(base).ApplyOverrides(override, "").Build()
+	if _, ok := s.GetAlterHostname("example.com"); ok {
+		t.Error("alter_hostname should be removed by auto marker")
+	}
+	if got, _ := s.GetHost("example.com"); got != "192.0.2.2" {
+		t.Errorf("GetHost() = %q, want the override", got)
+	}
+}
+
+func TestStore(t *testing.T) {
+	st := NewStore(nil)
+	if _, ok := st.Load().GetHost("example.com"); ok {
+		t.Fatal("empty store has rules")
+	}
+
+	var wg sync.WaitGroup
+	var stop atomic.Bool
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				s := st.Load()
+				// Both keys are always set together, so a reader sees both or neither.
+				a, okA := s.GetHost("a.example")
+				b, okB := s.GetHost("b.example")
+				if okA != okB || a != b {
+					t.Errorf("torn snapshot: %q, %v / %q, %v", a, okA, b, okB)
+					return
+				}
+			}
+		}()
+	}
+
+	const writers, updates = 4, 50
+	var writerWG sync.WaitGroup
+	for w := range writers {
+		writerWG.Add(1)
+		go func() {
+			defer writerWG.Done()
+			for i := range updates {
+				addr := fmt.Sprintf("192.0.%d.%d", w, i)
+				st.Update(func(b *Builder) {
+					b.SetHost("a.example", addr).SetHost("b.example", addr)
+					b.SetAlterHostname(fmt.Sprintf("w%d-%d.example", w, i), "x")
+				})
+			}
+		}()
+	}
+	writerWG.Wait()
+	stop.Store(true)
+	wg.Wait()
+
+	// No update was lost to a concurrent writer.
+	if got := len(st.Load().Keys(SectionAlterHostname)); got != writers*updates {
+		t.Errorf("after concurrent updates: %d keys, want %d", got, writers*updates)
+	}
+}
+
+// benchmarkLookup runs parallel lookups of hosts; if write is set, it is
+// called in a loop in the background for the duration of the benchmark.
+func benchmarkLookup(b *testing.B, hosts []string, lookup func(host string) bool, write func()) {
+	if write != nil {
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					write()
+				}
+			}
+		}()
+		defer func() {
+			close(stop)
+			<-done
+		}()
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			lookup(hosts[i%len(hosts)])
+			i++
+		}
+	})
+}
+
+func BenchmarkLookup(b *testing.B) {
+	r, err := LoadRules()
+	if err != nil {
+		b.Fatal(err)
+	}
+	hosts := SampleHosts(r)
+	lookupRules := func(host string) bool {
+		_, ok := r.LookupAlterHostname(host, 443)
+		return ok
+	}
+	st := NewStore(r.Snapshot())
+	lookupSnapshot := func(host string) bool {
+		_, ok := st.Load().LookupAlterHostname(host, 443)
+		return ok
+	}
+
+	b.Run("RWMutex", func(b *testing.B) {
+		benchmarkLookup(b, hosts, lookupRules, nil)
+	})
+	b.Run("Snapshot", func(b *testing.B) {
+		benchmarkLookup(b, hosts, lookupSnapshot, nil)
+	})
+	// The writer replaces one key, as an editor or a rule update would.
+	b.Run("RWMutexWriter", func(b *testing.B) {
+		benchmarkLookup(b, hosts, lookupRules, func() {
+			r.mu.Lock()
+			r.Hosts["bench.example"] = "192.0.2.1"
+			r.initLocked()
+			r.mu.Unlock()
+		})
+	})
+	b.Run("SnapshotWriter", func(b *testing.B) {
+		benchmarkLookup(b, hosts, lookupSnapshot, func() {
+			st.Update(func(b *Builder) { b.SetHost("bench.example", "192.0.2.1") })
+		})
+	})
+}
@@ -1,58 +1,232 @@
 package rules
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
 	"github.com/pelletier/go-toml/v2"
 )
 
 // TOMLRules represents rules in TOML format (used by desktop Go project).
+// It only holds rules in the short form; see RuleMeta for the extended form.
 type TOMLRules struct {
 	AlterHostname map[string]string      `toml:"alter_hostname"`
 	CertVerify    map[string]interface{} `toml:"cert_verify"`
 	Hosts         map[string]string      `toml:"hosts"`
 }
 
+// tomlFile is a rules file as read, with rules in either form.
+type tomlFile struct {
+	Version       int            `toml:"version"`
+	AlterHostname map[string]any `toml:"alter_hostname"`
+	CertVerify    map[string]any `toml:"cert_verify"`
+	Hosts         map[string]any `toml:"hosts"`
+}
+
 // FromTOML parses TOML data and updates Rules.
 func (r *Rules) FromTOML(data []byte) error {
-	var tomlRules TOMLRules
-	if err := toml.Unmarshal(data, &tomlRules); err != nil {
+	var file tomlFile
+	if err := toml.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	if err := checkVersion(file.Version); err != nil {
+		return err
+	}
+	return r.fromFile(file)
+}
+
+// fromFile is FromTOML for a parsed file.
+func (r *Rules) fromFile(file tomlFile) error {
+	alterHostname, alterMeta, err := stringSection(SectionAlterHostname, file.AlterHostname)
+	if err != nil {
+		return err
+	}
+	certVerify, certMeta, err := splitSection(SectionCertVerify, file.CertVerify)
+	if err != nil {
+		return err
+	}
+	hosts, hostsMeta, err := stringSection(SectionHosts, file.Hosts)
+	if err != nil {
 		return err
 	}
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if r.Meta == nil {
+		r.Meta = make(map[Section]map[string]RuleMeta)
+	}
 	// Only overwrite maps if the TOML provided them; preserve existing non-nil maps
-	if tomlRules.AlterHostname != nil {
-		r.AlterHostname = tomlRules.AlterHostname
+	if file.AlterHostname != nil {
+		r.AlterHostname, r.Meta[SectionAlterHostname] = alterHostname, alterMeta
 	}
-	if tomlRules.CertVerify != nil {
-		r.CertVerify = tomlRules.CertVerify
+	if file.CertVerify != nil {
+		r.CertVerify, r.Meta[SectionCertVerify] = certVerify, certMeta
 	}
-	if tomlRules.Hosts != nil {
-		r.Hosts = tomlRules.Hosts
+	if file.Hosts != nil {
+		r.Hosts, r.Meta[SectionHosts] = hosts, hostsMeta
 	}
 
-	// Call Init logic inline to avoid deadlock (r.mu is already held)
-	r.AlterHostname = normalizeMap(r.AlterHostname)
-	r.CertVerify = normalizeMap(r.CertVerify)
-	r.Hosts = normalizeMap(r.Hosts)
-	r.alterHostnameKeys = getSortedKeys(r.AlterHostname)
-	r.certVerifyKeys = getSortedKeys(r.CertVerify)
-	r.hostsKeys = getSortedKeys(r.Hosts)
+	r.initLocked()
 
 	return nil
 }
 
-// ToTOML converts Rules to TOML format.
+// splitSection separates the values and metadata of a section read from TOML.
+func splitSection(section Section, m map[string]any) (map[string]any, map[string]RuleMeta, error) {
+	values := make(map[string]any, len(m))
+	metas := make(map[string]RuleMeta)
+	for k, v := range m {
+		value, meta, err := parseRule(section, v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %q: %w", section, k, err)
+		}
+		values[k] = value
+		if !meta.IsZero() {
+			metas[k] = meta
+		}
+	}
+	return values, metas, nil
+}
+
+// stringSection is splitSection for sections whose values are strings.
+func stringSection(section Section, m map[string]any) (map[string]string, map[string]RuleMeta, error) {
+	values, metas, err := splitSection(section, m)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := make(map[string]string, len(values))
+	for k, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: %q: value must be a string, got %v", section, k, v)
+		}
+		out[k] = s
+	}
+	return out, metas, nil
+}
+
+// ToTOML converts Rules to TOML format. Sections and keys are sorted; rules
+// with metadata are written in the extended form.
 func (r *Rules) ToTOML() ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "version = %d\n", SchemaVersion)
+	if err := WriteTOML(&b, r); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// WriteTOML writes the sections of r to w as ToTOML does, but without the
+// root "version" key, for files that start with a header of their own.
+// Empty sections are omitted.
+func WriteTOML(w io.Writer, r *Rules) error {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	tomlRules := TOMLRules{
-		AlterHostname: r.AlterHostname,
-		CertVerify:    r.CertVerify,
-		Hosts:         r.Hosts,
+	var b bytes.Buffer
+	for _, section := range Sections {
+		var values map[string]any
+		switch section {
+		case SectionAlterHostname:
+			values = toAny(r.AlterHostname)
+		case SectionCertVerify:
+			values = r.CertVerify
+		case SectionHosts:
+			values = toAny(r.Hosts)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n[%s]\n", section)
+		for _, k := range slices.Sorted(maps.Keys(values)) {
+			v, err := tomlValue(extendedValue(section, values[k], r.Meta[section][k]))
+			if err != nil {
+				return fmt.Errorf("%s: %q: %w", section, k, err)
+			}
+			fmt.Fprintf(&b, "%s = %s\n", tomlString(k), v)
+		}
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func toAny(m map[string]string) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// tomlFieldOrder is the order of the fields of an extended rule.
+var tomlFieldOrder = []string{"sni", "ip", "verify", fieldApps, fieldEnabled, fieldTags, fieldNote, fieldExpires}
+
+// tomlValue formats a rule value, or an extended rule as an inline table.
+func tomlValue(v any) (string, error) {
+	switch v := v.(type) {
+	case bool:
+		return strconv.FormatBool(v), nil
+	case string:
+		return tomlString(v), nil
+	case toml.LocalDate:
+		return v.String(), nil
+	case time.Time:
+		return v.Format(time.RFC3339), nil
+	case []string:
+		items := make([]string, len(v))
+		for i, s := range v {
+			items[i] = tomlString(s)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("unsupported list item %T", item)
+			}
+			items[i] = tomlString(s)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case map[string]any:
+		var fields []string
+		for _, k := range tomlFieldOrder {
+			if f, ok := v[k]; ok {
+				s, err := tomlValue(f)
+				if err != nil {
+					return "", err
+				}
+				fields = append(fields, k+" = "+s)
+			}
+		}
+		return "{ " + strings.Join(fields, ", ") + " }", nil
 	}
+	return "", fmt.Errorf("unsupported value %T", v)
+}
 
-	return toml.Marshal(tomlRules)
+// tomlString quotes s as a TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case c == utf8.RuneError, c < 0x20, c == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
 }
@@ -0,0 +1,325 @@
+// Package update downloads signed rule updates and keeps them on disk as a
+// replacement for the embedded fetched layer (see rules.LoadLayers), so rule
+// fixes reach users without an app release.
+//
+// An update is a JSON envelope holding a TOML rules file, its version and an
+// Ed25519 signature over both:
+//
+//	{"version": 42, "rules": "[alter_hostname]\n...", "signature": "<base64>"}
+//
+// The signed message is the text "snirect-rules\n", the decimal version, a
+// newline, then the rules. Sign produces an envelope for publishing.
+//
+// Versions must increase: an update older than the highest version ever
+// accepted is rejected, so a replayed or stale response cannot roll the rules
+// back. That version is kept in its own file, so the check holds even if the
+// stored envelope is lost or damaged. The embedded rules have version
+// rules.FetchedRulesVersion, and whichever of them and the installed update is
+// newer is used, so an app release with fresher rules is not overridden by an
+// older download.
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xihale/snirect-shared/rules"
+)
+
+// Names of the files kept in Config.Dir.
+const (
+	// EnvelopeFile is the last installed envelope, re-verified on every load.
+	EnvelopeFile = "fetched.json"
+	// ETagFile is the ETag of the response EnvelopeFile came from.
+	ETagFile = "fetched.etag"
+	// VersionFile is the highest version ever accepted, in decimal.
+	VersionFile = "fetched.version"
+)
+
+// MaxSize is the largest envelope Update accepts.
+const MaxSize = 16 << 20
+
+var (
+	// ErrSignature is returned for an envelope whose signature does not verify.
+	ErrSignature = errors.New("update: invalid signature")
+	// ErrRollback is returned for an envelope older than an accepted one.
+	ErrRollback = errors.New("update: version is older than the accepted rules")
+)
+
+// Config configures an Updater.
+type Config struct {
+	// URL is where the envelope is downloaded from.
+	URL string
+	// PublicKey verifies the envelope signatures.
+	PublicKey ed25519.PublicKey
+	// Dir holds the installed envelope, its ETag and the highest accepted
+	// version; it is created if needed.
+	Dir string
+	// Client sends the requests; nil means http.DefaultClient.
+	Client *http.Client
+}
+
+// Envelope is a signed rule update.
+type Envelope struct {
+	Version   uint64 `json:"version"`
+	Rules     string `json:"rules"`
+	Signature []byte `json:"signature"`
+}
+
+// message returns the signed bytes of an envelope.
+func message(version uint64, rulesTOML string) []byte {
+	return []byte("snirect-rules\n" + strconv.FormatUint(version, 10) + "\n" + rulesTOML)
+}
+
+// Sign returns the JSON envelope for rulesTOML at version.
+func Sign(key ed25519.PrivateKey, version uint64, rulesTOML []byte) ([]byte, error) {
+	env := Envelope{Version: version, Rules: string(rulesTOML)}
+	env.Signature = ed25519.Sign(key, message(env.Version, env.Rules))
+	return json.Marshal(env)
+}
+
+// Verify parses a JSON envelope, checks its signature against key and parses
+// and validates its rules.
+func Verify(data []byte, key ed25519.PublicKey) (*Envelope, *rules.Rules, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, nil, fmt.Errorf("update: %w", err)
+	}
+	if !ed25519.Verify(key, message(env.Version, env.Rules), env.Signature) {
+		return nil, nil, ErrSignature
+	}
+	r := rules.NewRules()
+	err := r.FromTOML([]byte(env.Rules))
+	if err == nil {
+		err = r.Validate()
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("update: version %d: %w", env.Version, err)
+	}
+	return &env, r, nil
+}
+
+// Result is the outcome of Update.
+type Result struct {
+	// Updated reports whether new rules were installed.
+	Updated bool
+	// Version is the version of the rules in use after the update.
+	Version uint64
+}
+
+// Updater downloads and installs rule updates. It is safe for concurrent use.
+type Updater struct {
+	cfg Config
+	mu  sync.Mutex
+}
+
+// New returns an Updater for cfg.
+func New(cfg Config) (*Updater, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("update: no URL")
+	}
+	if len(cfg.PublicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("update: public key has %d bytes, want %d", len(cfg.PublicKey), ed25519.PublicKeySize)
+	}
+	if cfg.Dir == "" {
+		return nil, errors.New("update: no directory")
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &Updater{cfg: cfg}, nil
+}
+
+// installed returns the verified installed envelope and its rules, or a nil
+// envelope if none is installed or the stored one does not verify.
+func (u *Updater) installed() (*Envelope, *rules.Rules) {
+	data, err := os.ReadFile(filepath.Join(u.cfg.Dir, EnvelopeFile))
+	if err != nil {
+		return nil, nil
+	}
+	env, r, err := Verify(data, u.cfg.PublicKey)
+	if err != nil {
+		return nil, nil
+	}
+	return env, r
+}
+
+// inUse returns the version of the rules Layer serves: that of the installed
+// envelope if it is newer than the embedded rules, else
+// rules.FetchedRulesVersion.
+func inUse(current *Envelope) uint64 {
+	if current != nil && current.Version > rules.FetchedRulesVersion {
+		return current.Version
+	}
+	return rules.FetchedRulesVersion
+}
+
+// accepted returns the highest version ever accepted: that of VersionFile, of
+// the installed envelope or of the embedded rules, whichever is higher.
+func (u *Updater) accepted(current *Envelope) uint64 {
+	v := inUse(current)
+	if data, err := os.ReadFile(filepath.Join(u.cfg.Dir, VersionFile)); err == nil {
+		if stored, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err == nil && stored > v {
+			v = stored
+		}
+	}
+	return v
+}
+
+// Version returns the version of the rules in use; rules.FetchedRulesVersion
+// means the embedded rules are used.
+func (u *Updater) Version() uint64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	env, _ := u.installed()
+	return inUse(env)
+}
+
+// Layer returns the installed rules as the fetched layer if they are newer
+// than the embedded fetched rules, else the embedded rules.
+func (u *Updater) Layer() (rules.Layer, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if env, r := u.installed(); env != nil && env.Version > rules.FetchedRulesVersion {
+		return rules.Layer{Name: rules.LayerFetched, Rules: r}, nil
+	}
+	r := rules.NewRules()
+	if err := r.FromTOML([]byte(rules.FetchedRulesTOML)); err != nil {
+		return rules.Layer{}, fmt.Errorf("%s rules: %w", rules.LayerFetched, err)
+	}
+	return rules.Layer{Name: rules.LayerFetched, Rules: r}, nil
+}
+
+// Layers is rules.LoadLayers with the fetched layer replaced by Layer.
+func (u *Updater) Layers() ([]rules.Layer, error) {
+	layers, err := rules.LoadLayers()
+	if err != nil {
+		return nil, err
+	}
+	fetched, err := u.Layer()
+	if err != nil {
+		return nil, err
+	}
+	layers[0] = fetched
+	return layers, nil
+}
+
+// Update downloads the envelope and installs it if it verifies and is not
+// older than the highest accepted version. The request carries the ETag of
+// the installed envelope, so an unchanged update costs no download. On error
+// the installed rules are unchanged.
+func (u *Updater) Update(ctx context.Context) (Result, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	current, _ := u.installed()
+	res := Result{Version: inUse(current)}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.cfg.URL, nil)
+	if err != nil {
+		return res, fmt.Errorf("update: %w", err)
+	}
+	if current != nil {
+		if etag, err := os.ReadFile(filepath.Join(u.cfg.Dir, ETagFile)); err == nil && len(etag) > 0 {
+			req.Header.Set("If-None-Match", string(etag))
+		}
+	}
+	resp, err := u.cfg.Client.Do(req)
+	if err != nil {
+		return res, fmt.Errorf("update: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && current != nil:
+		return res, nil
+	case resp.StatusCode != http.StatusOK:
+		return res, fmt.Errorf("update: %s: %s", u.cfg.URL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxSize+1))
+	if err != nil {
+		return res, fmt.Errorf("update: %w", err)
+	}
+	if len(data) > MaxSize {
+		return res, fmt.Errorf("update: %s: envelope exceeds %d bytes", u.cfg.URL, MaxSize)
+	}
+
+	env, _, err := Verify(data, u.cfg.PublicKey)
+	if err != nil {
+		return res, err
+	}
+	etag := resp.Header.Get("ETag")
+	accepted := u.accepted(current)
+	if env.Version < accepted {
+		return res, fmt.Errorf("%w: got %d, accepted %d", ErrRollback, env.Version, accepted)
+	}
+	if current != nil && env.Version == current.Version {
+		if env.Rules != current.Rules {
+			return res, fmt.Errorf("update: version %d changed without a new version number", env.Version)
+		}
+		// Same rules; only remember the ETag.
+		return res, u.write(ETagFile, []byte(etag))
+	}
+	if env.Version == rules.FetchedRulesVersion {
+		// The embedded rules are this version already.
+		return res, nil
+	}
+
+	// Record the version first: if installing fails after this, the same
+	// version can still be installed again, but no older one.
+	if env.Version > accepted {
+		if err := u.write(VersionFile, []byte(strconv.FormatUint(env.Version, 10)+"\n")); err != nil {
+			return res, err
+		}
+	}
+	if err := u.write(EnvelopeFile, data); err != nil {
+		return res, err
+	}
+	if err := u.write(ETagFile, []byte(etag)); err != nil {
+		return res, err
+	}
+	return Result{Updated: true, Version: env.Version}, nil
+}
+
+// write replaces a file in Dir atomically.
+func (u *Updater) write(name string, data []byte) error {
+	if err := os.MkdirAll(u.cfg.Dir, 0o755); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	path := filepath.Join(u.cfg.Dir, name)
+	if name == ETagFile && len(data) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("update: %w", err)
+		}
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(u.cfg.Dir, "."+name+".*")
+	if err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("update: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/xihale/snirect-shared/rules"
+)
+
+// server serves one envelope with an ETag derived from its contents.
+type server struct {
+	t   *testing.T
+	key ed25519.PrivateKey
+
+	mu     sync.Mutex
+	body   []byte
+	etag   string
+	notMod int
+}
+
+func (s *server) publish(version uint64, rulesTOML string) {
+	s.t.Helper()
+	body, err := Sign(s.key, version, []byte(rulesTOML))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	sum := sha256.Sum256(body)
+	s.set(body, `"`+hex.EncodeToString(sum[:8])+`"`)
+}
+
+func (s *server) set(body []byte, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body, s.etag = body, etag
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Header.Get("If-None-Match") == s.etag {
+		s.notMod++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	w.Write(s.body)
+}
+
+func newTestUpdater(t *testing.T) (*Updater, *server) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &server{t: t, key: priv}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	u, err := New(Config{URL: ts.URL, PublicKey: pub, Dir: filepath.Join(t.TempDir(), "rules"), Client: ts.Client()})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return u, srv
+}
+
+func fetchedSNI(t *testing.T, u *Updater, host string) string {
+	t.Helper()
+	layer, err := u.Layer()
+	if err != nil {
+		t.Fatalf("Layer() error = %v", err)
+	}
+	if layer.Name != rules.LayerFetched {
+		t.Errorf("Layer().Name = %q", layer.Name)
+	}
+	sni, _ := layer.Rules.GetAlterHostname(host)
+	return sni
+}
+
+func TestUpdate(t *testing.T) {
+	u, srv := newTestUpdater(t)
+	ctx := context.Background()
+
+	// Nothing installed: the embedded copy is used.
+	embedded := rules.NewRules()
+	if err := embedded.FromTOML([]byte(rules.FetchedRulesTOML)); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := u.Layer()
+	if err != nil || !rules.Diff(embedded, layer.Rules).Empty() || u.Version() != rules.FetchedRulesVersion {
+		t.Fatalf("Layer() before any update = %v, version %d", err, u.Version())
+	}
+
+	srv.publish(3, "[alter_hostname]\n\"*.example.com\" = \"v3.example.net\"\n")
+	res, err := u.Update(ctx)
+	if err != nil || res != (Result{Updated: true, Version: 3}) {
+		t.Fatalf("Update() = %+v, %v", res, err)
+	}
+	if got := fetchedSNI(t, u, "www.example.com"); got != "v3.example.net" {
+		t.Errorf("after update: %q", got)
+	}
+
+	// Unchanged: the ETag avoids a download.
+	res, err = u.Update(ctx)
+	if err != nil || res != (Result{Version: 3}) || srv.notMod != 1 {
+		t.Errorf("Update() unchanged = %+v, %v, %d not modified", res, err, srv.notMod)
+	}
+
+	srv.publish(4, "[alter_hostname]\n\"*.example.com\" = \"v4.example.net\"\n")
+	if res, err := u.Update(ctx); err != nil || !res.Updated || res.Version != 4 {
+		t.Fatalf("Update() to 4 = %+v, %v", res, err)
+	}
+
+	layers, err := u.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 3 || layers[0].Name != rules.LayerFetched {
+		t.Fatalf("Layers() = %v", layers)
+	}
+	if got, _ := layers[0].Rules.GetAlterHostname("www.example.com"); got != "v4.example.net" {
+		t.Errorf("Layers() fetched layer = %q", got)
+	}
+
+	// A fresh updater on the same directory picks up the installed rules.
+	again, err := New(u.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Version() != 4 {
+		t.Errorf("Version() = %d, want 4", again.Version())
+	}
+}
+
+func TestUpdateRejected(t *testing.T) {
+	u, srv := newTestUpdater(t)
+	ctx := context.Background()
+	srv.publish(5, "[hosts]\n\"example.com\" = \"192.0.2.5\"\n")
+	if _, err := u.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	forged, _ := Sign(otherKey, 6, []byte("[hosts]\n\"example.com\" = \"203.0.113.1\"\n"))
+
+	tests := []struct {
+		name    string
+		publish func()
+		wantErr error
+	}{
+		{name: "rollback", publish: func() { srv.publish(4, "[hosts]\n\"example.com\" = \"192.0.2.4\"\n") }, wantErr: ErrRollback},
+		{name: "forged", publish: func() { srv.set(forged, `"forged"`) }, wantErr: ErrSignature},
+		{name: "same version, other rules", publish: func() { srv.publish(5, "[hosts]\n\"example.com\" = \"192.0.2.6\"\n") }},
+		{name: "invalid rules", publish: func() { srv.publish(6, "[hosts]\n\"bad:port\" = \"192.0.2.1\"\n") }},
+		{name: "not JSON", publish: func() { srv.set([]byte("<html>"), `"html"`) }},
+	}
+	for _, tt := range tests {
+		tt.publish()
+		res, err := u.Update(ctx)
+		if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+			t.Errorf("%s: Update() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if res.Updated || res.Version != 5 || u.Version() != 5 {
+			t.Errorf("%s: Update() = %+v, installed %d", tt.name, res, u.Version())
+		}
+	}
+
+	// A tampered installed envelope falls back to the embedded rules.
+	path := filepath.Join(u.cfg.Dir, EnvelopeFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 1
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := u.Layer()
+	if err != nil || u.Version() != rules.FetchedRulesVersion {
+		t.Fatalf("Layer() = %v, version %d", err, u.Version())
+	}
+	if got, _ := layer.Rules.GetHost("example.com"); got == "192.0.2.5" {
+		t.Error("Layer() used a tampered envelope")
+	}
+}
+
+func TestUpdateEmbeddedVersion(t *testing.T) {
+	u, srv := newTestUpdater(t)
+	ctx := context.Background()
+	const stale = "[hosts]\n\"example.com\" = \"192.0.2.1\"\n"
+
+	// An update no newer than the embedded rules is not installed.
+	srv.publish(rules.FetchedRulesVersion-1, stale)
+	if res, err := u.Update(ctx); !errors.Is(err, ErrRollback) || res != (Result{Version: rules.FetchedRulesVersion}) {
+		t.Errorf("Update() older than embedded = %+v, %v, want %v", res, err, ErrRollback)
+	}
+	srv.publish(rules.FetchedRulesVersion, stale)
+	if res, err := u.Update(ctx); err != nil || res != (Result{Version: rules.FetchedRulesVersion}) {
+		t.Errorf("Update() at the embedded version = %+v, %v", res, err)
+	}
+
+	// An installed envelope that is not newer, as left by an app release
+	// with fresher embedded rules, is not served.
+	if err := u.write(EnvelopeFile, srv.body); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := u.Layer()
+	if err != nil || u.Version() != rules.FetchedRulesVersion {
+		t.Fatalf("Layer() = %v, version %d", err, u.Version())
+	}
+	if got, _ := layer.Rules.GetHost("example.com"); got == "192.0.2.1" {
+		t.Error("Layer() served an envelope no newer than the embedded rules")
+	}
+}
+
+func TestUpdateRollbackWithoutEnvelope(t *testing.T) {
+	u, srv := newTestUpdater(t)
+	ctx := context.Background()
+	srv.publish(4, "[hosts]\n\"example.com\" = \"192.0.2.4\"\n")
+	old, etag := srv.body, srv.etag
+	srv.publish(5, "[hosts]\n\"example.com\" = \"192.0.2.5\"\n")
+	if _, err := u.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(u.cfg.Dir, EnvelopeFile)
+	for _, damage := range []struct {
+		name string
+		do   func() error
+	}{
+		{name: "missing", do: func() error { return os.Remove(path) }},
+		{name: "corrupt", do: func() error { return os.WriteFile(path, []byte("{"), 0o644) }},
+		{name: "forged", do: func() error {
+			_, otherKey, _ := ed25519.GenerateKey(nil)
+			forged, _ := Sign(otherKey, 9, []byte(""))
+			return os.WriteFile(path, forged, 0o644)
+		}},
+	} {
+		if err := damage.do(); err != nil {
+			t.Fatal(err)
+		}
+		srv.set(old, etag)
+		if res, err := u.Update(ctx); !errors.Is(err, ErrRollback) || res.Updated {
+			t.Errorf("%s envelope: Update() of version 4 = %+v, %v, want %v", damage.name, res, err, ErrRollback)
+		}
+
+		// The accepted version itself can be installed again.
+		srv.publish(5, "[hosts]\n\"example.com\" = \"192.0.2.5\"\n")
+		if res, err := u.Update(ctx); err != nil || res != (Result{Updated: true, Version: 5}) {
+			t.Errorf("%s envelope: Update() of version 5 = %+v, %v", damage.name, res, err)
+		}
+	}
+}
+
+func TestUpdateHTTPError(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	pub, _, _ := ed25519.GenerateKey(nil)
+	u, err := New(Config{URL: ts.URL, PublicKey: pub, Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Update(context.Background()); err == nil {
+		t.Error("Update() of a 404 succeeded")
+	}
+
+	for _, cfg := range []Config{
+		{PublicKey: pub, Dir: "x"},
+		{URL: ts.URL, PublicKey: pub[:8], Dir: "x"},
+		{URL: ts.URL, PublicKey: pub},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) succeeded", cfg)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// SchemaVersion is the version of the rules file format this library reads
+// and writes, given by the root "version" key of TOML files and the "version"
+// field of JSON files. Files without one are version 0, the legacy format:
+//
+//   - version 0 allows the "$" key prefix, which Init strips, and overrides
+//     written for a custom auto marker (see ApplyOverrides);
+//   - version 1 uses plain keys and DefaultAutoMarker only.
+//
+// Older files are still read; MigrateTOML and MigrateJSON upgrade them.
+const SchemaVersion = 1
+
+// ErrUnsupportedVersion is returned for a file written for a newer format
+// than SchemaVersion, which this build could misread.
+var ErrUnsupportedVersion = errors.New("rules: unsupported file version")
+
+// checkVersion rejects file versions this library does not understand.
+func checkVersion(v int) error {
+	switch {
+	case v > SchemaVersion:
+		return fmt.Errorf("%w: file version %d is newer than the supported version %d; update the app to read it", ErrUnsupportedVersion, v, SchemaVersion)
+	case v < 0:
+		return fmt.Errorf("%w: invalid file version %d", ErrUnsupportedVersion, v)
+	}
+	return nil
+}
+
+// MigrateOptions configures a migration.
+type MigrateOptions struct {
+	// AutoMarker is the auto marker the file was written for, if it is not
+	// DefaultAutoMarker; its values are rewritten to DefaultAutoMarker.
+	AutoMarker string
+}
+
+// MigrationStep is one change made by a migration.
+type MigrationStep struct {
+	// Version is the version the change upgrades to.
+	Version int     `json:"version"`
+	Section Section `json:"section,omitempty"`
+	Key     string  `json:"key,omitempty"`
+	Detail  string  `json:"detail"`
+}
+
+func (c MigrationStep) String() string {
+	if c.Key == "" {
+		return fmt.Sprintf("v%d: %s", c.Version, c.Detail)
+	}
+	return fmt.Sprintf("v%d: %s: %q: %s", c.Version, c.Section, c.Key, c.Detail)
+}
+
+// MigrationReport lists what a migration changed.
+type MigrationReport struct {
+	From    int             `json:"from"`
+	To      int             `json:"to"`
+	Changes []MigrationStep `json:"changes"`
+}
+
+// Migrated reports whether the file was upgraded.
+func (rep *MigrationReport) Migrated() bool {
+	return rep.From != rep.To
+}
+
+func (rep *MigrationReport) String() string {
+	if !rep.Migrated() {
+		return fmt.Sprintf("already at version %d\n", rep.To)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "version %d -> %d\n", rep.From, rep.To)
+	for _, c := range rep.Changes {
+		b.WriteString(c.String() + "\n")
+	}
+	return b.String()
+}
+
+func (rep *MigrationReport) add(version int, section Section, key, format string, args ...any) {
+	rep.Changes = append(rep.Changes, MigrationStep{Version: version, Section: section, Key: key, Detail: fmt.Sprintf(format, args...)})
+}
+
+// migration upgrades a file from the previous version to version.
+type migration struct {
+	version int
+	toml    func(d *Document, opts MigrateOptions, rep *MigrationReport) error
+	json    func(j *JSONRules, opts MigrateOptions, rep *MigrationReport)
+}
+
+// migrations are the upgrade steps in order, one per version.
+var migrations = []migration{
+	{version: 1, toml: migrateTOML1, json: migrateJSON1},
+}
+
+// MigrateTOML upgrades a TOML rules file to SchemaVersion, editing it in place
+// like Document so comments and layout are kept. A file already at
+// SchemaVersion is returned unchanged; a newer one is rejected.
+func MigrateTOML(data []byte, opts MigrateOptions) ([]byte, *MigrationReport, error) {
+	d, err := ParseDocument(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	from, err := d.Version()
+	if err != nil {
+		return nil, nil, err
+	}
+	rep := &MigrationReport{From: from, To: from, Changes: []MigrationStep{}}
+	for _, m := range migrations {
+		if m.version <= from {
+			continue
+		}
+		if err := m.toml(d, opts, rep); err != nil {
+			return nil, nil, err
+		}
+		rep.To = m.version
+	}
+	if !rep.Migrated() {
+		return data, rep, nil
+	}
+	d.SetVersion(rep.To)
+	if _, err := d.Rules(); err != nil {
+		return nil, nil, fmt.Errorf("rules: migrated file is invalid: %w", err)
+	}
+	return d.Bytes(), rep, nil
+}
+
+// MigrateJSON is MigrateTOML for the JSON format. The result is re-encoded.
+func MigrateJSON(data []byte, opts MigrateOptions) ([]byte, *MigrationReport, error) {
+	var j JSONRules
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, nil, err
+	}
+	if err := checkVersion(j.Version); err != nil {
+		return nil, nil, err
+	}
+	rep := &MigrationReport{From: j.Version, To: j.Version, Changes: []MigrationStep{}}
+	for _, m := range migrations {
+		if m.version > j.Version {
+			m.json(&j, opts, rep)
+			rep.To = m.version
+		}
+	}
+	if !rep.Migrated() {
+		return data, rep, nil
+	}
+	j.Version = rep.To
+	out, err := json.Marshal(&j)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, rep, nil
+}
+
+// sectionTable returns the section whose rules a TOML table holds: a section
+// itself or a section of a profile.
+func sectionTable(table string) (Section, bool) {
+	for _, section := range Sections {
+		if table == string(section) {
+			return section, true
+		}
+		if rest, ok := strings.CutPrefix(table, "profiles."); ok && strings.HasSuffix(rest, "."+string(section)) {
+			return section, true
+		}
+	}
+	return "", false
+}
+
+// migrateTOML1 drops the "$" key prefix and rewrites a custom auto marker.
+func migrateTOML1(d *Document, opts MigrateOptions, rep *MigrationReport) error {
+	for i := 0; i < len(d.stmts); i++ {
+		st := d.stmts[i]
+		section, ok := sectionTable(st.table)
+		if st.header || !ok || len(st.path) != 1 {
+			continue
+		}
+		key := st.path[0]
+		if plain, ok := strings.CutPrefix(key, "$"); ok && d.find(st.table, plain) >= 0 {
+			d.replace(st.start, st.end)
+			rep.add(1, section, key, "removed; %q is also defined and takes precedence", plain)
+			i--
+			continue
+		}
+
+		value, meta, err := d.rule(section, i)
+		if err != nil {
+			return err
+		}
+		var changes []string
+		if plain, ok := strings.CutPrefix(key, "$"); ok {
+			changes = append(changes, fmt.Sprintf("renamed to %q", plain))
+		}
+		if marker := opts.AutoMarker; marker != "" && marker != DefaultAutoMarker && value == marker {
+			value = DefaultAutoMarker
+			changes = append(changes, fmt.Sprintf("auto marker %q replaced by %q", marker, DefaultAutoMarker))
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		if err := d.rewrite(section, i, value, meta); err != nil {
+			return err
+		}
+		rep.add(1, section, key, "%s", strings.Join(changes, ", "))
+	}
+	return nil
+}
+
+// migrateJSON1 is migrateTOML1 for JSON. A pattern repeated once its prefix is
+// dropped is kept once.
+func migrateJSON1(j *JSONRules, opts MigrateOptions, rep *MigrationReport) {
+	marker := opts.AutoMarker
+	custom := marker != "" && marker != DefaultAutoMarker
+	stripPatterns := func(section Section, patterns []string) []string {
+		out := make([]string, 0, len(patterns))
+		for _, p := range patterns {
+			if plain, ok := strings.CutPrefix(p, "$"); ok {
+				rep.add(1, section, p, "renamed to %q", plain)
+				p = plain
+			}
+			if !slices.Contains(out, p) {
+				out = append(out, p)
+			}
+		}
+		return out
+	}
+	replaceMarker := func(section Section, patterns []string, v *string) {
+		if custom && v != nil && *v == marker {
+			*v = DefaultAutoMarker
+			rep.add(1, section, strings.Join(patterns, ", "), "auto marker %q replaced by %q", marker, DefaultAutoMarker)
+		}
+	}
+
+	for i := range j.Rules {
+		rule := &j.Rules[i]
+		rule.Patterns = stripPatterns(SectionAlterHostname, rule.Patterns)
+		replaceMarker(SectionAlterHostname, rule.Patterns, rule.TargetSNI)
+		replaceMarker(SectionHosts, rule.Patterns, rule.TargetIP)
+	}
+	for i := range j.CertVerify {
+		rule := &j.CertVerify[i]
+		rule.Patterns = stripPatterns(SectionCertVerify, rule.Patterns)
+		if s, ok := rule.Verify.(string); ok {
+			replaceMarker(SectionCertVerify, rule.Patterns, &s)
+			rule.Verify = s
+		}
+	}
+}
+
+// Version returns the file version of the document; 0 means a legacy file
+// without one.
+func (d *Document) Version() (int, error) {
+	var file struct {
+		Version int `toml:"version"`
+	}
+	if err := toml.Unmarshal(d.Bytes(), &file); err != nil {
+		return 0, err
+	}
+	return file.Version, nil
+}
+
+// SetVersion sets the root "version" key, adding it above the first statement
+// and the comments attached to it if it is missing. It does not migrate the
+// rules; use MigrateTOML for that.
+func (d *Document) SetVersion(v int) {
+	line := "version = " + strconv.Itoa(v)
+	if i := d.find("", "version"); i >= 0 {
+		st := d.stmts[i]
+		d.replace(st.start, st.end, st.indent+st.keyText+" = "+strconv.Itoa(v)+st.comment)
+		return
+	}
+	if len(d.stmts) == 0 {
+		d.replace(len(d.lines), len(d.lines), line)
+		d.trailingNewline = true
+		return
+	}
+	at := d.stmts[0].start
+	for at > 0 && strings.HasPrefix(strings.TrimSpace(d.lines[at-1]), "#") {
+		at--
+	}
+	d.replace(at, at, line, "")
+}
@@ -0,0 +1,140 @@
+package rules
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	r := NewRules()
+	r.Hosts["github.com"] = "192.0.2.1"
+	r.Init()
+
+	data, err := r.ToTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "version = 1\n\n[hosts]\n") {
+		t.Errorf("ToTOML() =\n%s", data)
+	}
+	data, err = r.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), `{"version":1,`) {
+		t.Errorf("ToJSON() = %s", data)
+	}
+
+	for _, input := range []string{"version = 2\n", "version = -1\n"} {
+		if err := NewRules().FromTOML([]byte(input)); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("FromTOML(%q) error = %v", input, err)
+		}
+	}
+	if _, err := ParseDocument([]byte("version = 2\n")); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("ParseDocument() error = %v", err)
+	}
+	err = NewRules().FromJSON([]byte(`{"version": 2, "rules": []}`))
+	if !errors.Is(err, ErrUnsupportedVersion) || !strings.Contains(err.Error(), "newer than the supported version 1") {
+		t.Errorf("FromJSON() error = %v", err)
+	}
+
+	// Legacy files without a version are still read.
+	if err := NewRules().FromTOML([]byte("[hosts]\n\"$a.example\" = \"192.0.2.1\"\n")); err != nil {
+		t.Errorf("FromTOML() of a legacy file: %v", err)
+	}
+}
+
+func TestMigrateTOML(t *testing.T) {
+	const input = `# my rules
+
+[alter_hostname]
+"$a.example" = "front.example" # legacy
+"$b.example" = "old.example"
+"b.example" = "new.example"
+"c.example" = { sni = "AUTO", tags = ["x"] }
+
+[profiles.home.hosts]
+"$d.example" = "AUTO"
+`
+	const want = `# my rules
+
+version = 1
+
+[alter_hostname]
+"a.example" = "front.example" # legacy
+"b.example" = "new.example"
+"c.example" = { sni = "__AUTO__", tags = ["x"] }
+
+[profiles.home.hosts]
+"d.example" = "__AUTO__"
+`
+	out, rep, err := MigrateTOML([]byte(input), MigrateOptions{AutoMarker: "AUTO"})
+	if err != nil {
+		t.Fatalf("MigrateTOML() error = %v", err)
+	}
+	if string(out) != want {
+		t.Errorf("MigrateTOML() =\n%s\nwant\n%s", out, want)
+	}
+	if rep.From != 0 || rep.To != 1 || len(rep.Changes) != 4 {
+		t.Errorf("report = %+v", rep)
+	}
+	for _, line := range []string{
+		`v1: alter_hostname: "$b.example": removed; "b.example" is also defined and takes precedence`,
+		`v1: hosts: "$d.example": renamed to "d.example", auto marker "AUTO" replaced by "__AUTO__"`,
+	} {
+		if !strings.Contains(rep.String(), line) {
+			t.Errorf("report lacks %s:\n%s", line, rep)
+		}
+	}
+
+	// Migrating again changes nothing.
+	again, rep, err := MigrateTOML(out, MigrateOptions{AutoMarker: "AUTO"})
+	if err != nil || string(again) != want || rep.Migrated() {
+		t.Errorf("second MigrateTOML() = %v, %+v", err, rep)
+	}
+
+	// The migrated file keeps the rules Init made of the legacy keys.
+	before, after := NewRules(), NewRules()
+	if err := before.FromTOML([]byte(input)); err != nil {
+		t.Fatal(err)
+	}
+	if err := after.FromTOML(out); err != nil {
+		t.Fatal(err)
+	}
+	if d := Diff(before, after); len(d.Changes) != 1 || d.Changes[0].Key != "c.example" {
+		t.Errorf("migration changed more than the auto marker:\n%s", d)
+	}
+
+	if _, _, err := MigrateTOML([]byte("version = 7\n"), MigrateOptions{}); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("MigrateTOML() of a newer file error = %v", err)
+	}
+}
+
+func TestMigrateJSON(t *testing.T) {
+	input := `{"rules": [{"patterns": ["$a.example", "a.example"], "target_sni": "AUTO", "target_ip": null}],
+"cert_verify": [{"patterns": ["$b.example"], "verify": "AUTO"}], "check_hostname": false}`
+	out, rep, err := MigrateJSON([]byte(input), MigrateOptions{AutoMarker: "AUTO"})
+	if err != nil {
+		t.Fatalf("MigrateJSON() error = %v", err)
+	}
+	for _, want := range []string{
+		`"version":1`,
+		`"patterns":["a.example"],"target_sni":"__AUTO__"`,
+		`"patterns":["b.example"],"verify":"__AUTO__"`,
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("MigrateJSON() lacks %s: %s", want, out)
+		}
+	}
+	if rep.From != 0 || rep.To != 1 || len(rep.Changes) != 4 {
+		t.Errorf("report = %s", rep)
+	}
+
+	if again, rep, err := MigrateJSON(out, MigrateOptions{}); err != nil || string(again) != string(out) || rep.Migrated() {
+		t.Errorf("second MigrateJSON() = %v, %+v", err, rep)
+	}
+	if _, _, err := MigrateJSON([]byte(`{"version": 3}`), MigrateOptions{}); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("MigrateJSON() of a newer file error = %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default polling settings of a Watcher.
+const (
+	DefaultWatchInterval = 500 * time.Millisecond
+	DefaultWatchDebounce = 200 * time.Millisecond
+)
+
+// WatcherOptions configures a Watcher.
+type WatcherOptions struct {
+	// Base, if set, holds the rules the file overrides (e.g. from LoadRules).
+	// The file is applied with ApplyOverrides, so AutoMarker values delete base keys.
+	Base *Rules
+	// AutoMarker is passed to ApplyOverrides; empty means DefaultAutoMarker.
+	AutoMarker string
+	// Interval is how often the file is checked; zero means DefaultWatchInterval.
+	Interval time.Duration
+	// Debounce is how long the file must stay unchanged before it is reloaded,
+	// so an editor's partial writes are not parsed; zero means DefaultWatchDebounce.
+	Debounce time.Duration
+}
+
+// WatchEvent is delivered to subscribers after each reload attempt that
+// changed the rules or failed, and after the first successful reload following
+// a failure, even if the file is back to the rules already in effect.
+type WatchEvent struct {
+	// Rules is the rule set in effect after the event.
+	Rules *Rules
+	// Diff lists what changed; nil if the reload failed, empty if the file
+	// recovered without changing the rules.
+	Diff *DiffReport
+	// Err is the reason the file was rejected; the previous rules stay in effect.
+	Err error
+}
+
+// Watcher keeps a rule set in sync with a TOML rules file. It polls the file,
+// waits for it to settle, then parses and validates it, applying the file's
+// active profile if it selects one (see Profiles). Valid rules are
+// published atomically as a new *Rules; a file that fails to read, parse or
+// validate is reported to subscribers and never replaces the current rules.
+//
+// Published rule sets are not modified afterwards, so lookups in flight on an
+// older set are unaffected by a reload.
+type Watcher struct {
+	path string
+	opts WatcherOptions
+
+	current atomic.Pointer[Rules]
+
+	reloadMu sync.Mutex
+	lastData []byte
+	failed   bool // the last reload failed
+
+	subMu  sync.Mutex
+	subs   map[int]func(WatchEvent)
+	nextID int
+}
+
+// NewWatcher loads path and returns a watcher for it. It fails if the initial
+// file cannot be loaded; call Run to start watching.
+func NewWatcher(path string, opts WatcherOptions) (*Watcher, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultWatchInterval
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultWatchDebounce
+	}
+	w := &Watcher{path: path, opts: opts, subs: make(map[int]func(WatchEvent))}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("rules: %w", err)
+	}
+	r, err := w.build(data)
+	if err != nil {
+		return nil, err
+	}
+	w.current.Store(r)
+	w.lastData = data
+	return w, nil
+}
+
+// Rules returns the rule set currently in effect. It is safe for concurrent
+// use and never returns a partially applied set.
+func (w *Watcher) Rules() *Rules {
+	return w.current.Load()
+}
+
+// Subscribe registers fn to be called after every reload that changes the rules,
+// fails or recovers from a failure. Calls are made one at a time from the goroutine that reloaded. The
+// returned function unsubscribes.
+func (w *Watcher) Subscribe(fn func(WatchEvent)) (cancel func()) {
+	w.subMu.Lock()
+	defer w.subMu.Unlock()
+
+	id := w.nextID
+	w.nextID++
+	w.subs[id] = fn
+	return func() {
+		w.subMu.Lock()
+		defer w.subMu.Unlock()
+		delete(w.subs, id)
+	}
+}
+
+// Run polls the file until ctx is done and returns ctx.Err().
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	stamp := statFile(w.path)
+	var pending bool
+	var changed time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			if s := statFile(w.path); s != stamp {
+				stamp, pending, changed = s, true, now
+				continue
+			}
+			if pending && now.Sub(changed) >= w.opts.Debounce {
+				pending = false
+				w.Reload()
+			}
+		}
+	}
+}
+
+// Reload reads the file now, applies it if it is valid and differs from the
+// last applied content, and notifies subscribers. It returns the reason the
+// file was rejected, if any.
+func (w *Watcher) Reload() error {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		err = fmt.Errorf("rules: %w", err)
+		w.failed = true
+		w.notify(WatchEvent{Rules: w.Rules(), Err: err})
+		return err
+	}
+	if bytes.Equal(data, w.lastData) {
+		if w.failed {
+			// Restored to the content in effect: report the recovery.
+			w.failed = false
+			cur := w.Rules()
+			w.notify(WatchEvent{Rules: cur, Diff: Diff(cur, cur)})
+		}
+		return nil
+	}
+
+	next, err := w.build(data)
+	if err != nil {
+		w.failed = true
+		w.notify(WatchEvent{Rules: w.Rules(), Err: err})
+		return err
+	}
+	prev := w.current.Swap(next)
+	w.lastData = data
+
+	if d := Diff(prev, next); !d.Empty() || w.failed {
+		w.notify(WatchEvent{Rules: next, Diff: d})
+	}
+	w.failed = false
+	return nil
+}
+
+// build parses and validates file content into a new rule set.
+func (w *Watcher) build(data []byte) (*Rules, error) {
+	user := NewRules()
+	if err := user.FromTOML(data); err != nil {
+		return nil, fmt.Errorf("rules: %s: %w", w.path, err)
+	}
+	if err := user.Validate(); err != nil {
+		return nil, fmt.Errorf("rules: %s: %w", w.path, err)
+	}
+	profiles, err := ParseProfiles(data)
+	if err == nil {
+		err = profiles.Validate()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rules: %s: %w", w.path, err)
+	}
+
+	r := user
+	if w.opts.Base != nil {
+		r = w.opts.Base.DeepCopy()
+		ApplyOverrides(r, user, w.opts.AutoMarker)
+	}
+	return profiles.Apply(r, profiles.Active, w.opts.AutoMarker)
+}
+
+func (w *Watcher) notify(ev WatchEvent) {
+	w.subMu.Lock()
+	subs := make([]func(WatchEvent), 0, len(w.subs))
+	for id := range w.nextID {
+		if fn, ok := w.subs[id]; ok {
+			subs = append(subs, fn)
+		}
+	}
+	w.subMu.Unlock()
+
+	for _, fn := range subs {
+		fn(ev)
+	}
+}
+
+// fileStamp identifies a version of a file for change detection.
+type fileStamp struct {
+	modTime int64
+	size    int64
+	exists  bool
+}
+
+func statFile(path string) fileStamp {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: fi.ModTime().UnixNano(), size: fi.Size(), exists: true}
+}
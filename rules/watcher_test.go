@@ -0,0 +1,200 @@
+package rules
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeRulesFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.toml")
+	writeRulesFile(t, path, "[alter_hostname]\n\"*.example.com\" = \"a\"\n")
+
+	w, err := NewWatcher(path, WatcherOptions{})
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	var events []WatchEvent
+	cancel := w.Subscribe(func(ev WatchEvent) { events = append(events, ev) })
+
+	first := w.Rules()
+	if got, _ := first.GetAlterHostname("www.example.com"); got != "a" {
+		t.Fatalf("initial rules = %q", got)
+	}
+
+	// Unchanged content is not re-applied.
+	if err := w.Reload(); err != nil || len(events) != 0 || w.Rules() != first {
+		t.Fatalf("Reload() of unchanged file = %v, %d events", err, len(events))
+	}
+
+	writeRulesFile(t, path, "[alter_hostname]\n\"*.example.com\" = \"b\"\n")
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(events) != 1 || events[0].Err != nil || len(events[0].Diff.Changes) != 1 || events[0].Diff.Changes[0].New != "b" {
+		t.Fatalf("events = %+v", events)
+	}
+	if got, _ := w.Rules().GetAlterHostname("www.example.com"); got != "b" || events[0].Rules != w.Rules() {
+		t.Errorf("rules after reload = %q", got)
+	}
+	if got, _ := first.GetAlterHostname("www.example.com"); got != "a" {
+		t.Errorf("previous rule set was modified: %q", got)
+	}
+
+	// Bad edits are reported and never applied.
+	good := w.Rules()
+	for _, bad := range []string{
+		"[alter_hostname\n",
+		"[hosts]\n\"bad:port\" = \"192.0.2.1\"\n",
+	} {
+		writeRulesFile(t, path, bad)
+		if err := w.Reload(); err == nil {
+			t.Errorf("Reload() of %q succeeded", bad)
+		}
+		if w.Rules() != good {
+			t.Errorf("Reload() of %q replaced the rules", bad)
+		}
+		if ev := events[len(events)-1]; ev.Err == nil || ev.Diff != nil || ev.Rules != good {
+			t.Errorf("event for %q = %+v", bad, ev)
+		}
+	}
+	os.Remove(path)
+	if err := w.Reload(); err == nil || w.Rules() != good {
+		t.Errorf("Reload() of a missing file = %v", err)
+	}
+
+	cancel()
+	n := len(events)
+	writeRulesFile(t, path, "[alter_hostname]\n\"*.example.com\" = \"c\"\n")
+	w.Reload()
+	if len(events) != n {
+		t.Error("canceled subscriber was notified")
+	}
+}
+
+func TestWatcherRecover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.toml")
+	const good = "[alter_hostname]\n\"*.example.com\" = \"a\"\n"
+	writeRulesFile(t, path, good)
+
+	w, err := NewWatcher(path, WatcherOptions{})
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	var events []WatchEvent
+	w.Subscribe(func(ev WatchEvent) { events = append(events, ev) })
+	first := w.Rules()
+
+	writeRulesFile(t, path, "[alter_hostname\n")
+	if err := w.Reload(); err == nil || len(events) != 1 || events[0].Err == nil {
+		t.Fatalf("Reload() of a broken file = %v, events %+v", err, events)
+	}
+
+	// Restoring the content in effect reports the recovery once.
+	writeRulesFile(t, path, good)
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload() of the restored file = %v", err)
+	}
+	if len(events) != 2 || events[1].Err != nil || events[1].Diff == nil || !events[1].Diff.Empty() || events[1].Rules != first {
+		t.Fatalf("recovery event = %+v", events[1:])
+	}
+	if err := w.Reload(); err != nil || len(events) != 2 {
+		t.Errorf("Reload() after recovery = %v, %d events", err, len(events))
+	}
+}
+
+func TestWatcherBase(t *testing.T) {
+	base := NewRules()
+	base.AlterHostname["*.example.com"] = "base"
+	base.Hosts["*.example.com"] = "192.0.2.1"
+	base.Init()
+
+	path := filepath.Join(t.TempDir(), "rules.toml")
+	writeRulesFile(t, path, "[alter_hostname]\n\"*.example.com\" = \"__AUTO__\"\n\"api.example.com\" = \"user\"\n")
+	w, err := NewWatcher(path, WatcherOptions{Base: base})
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	r := w.Rules()
+	if _, ok := r.GetAlterHostname("www.example.com"); ok {
+		t.Error("__AUTO__ did not remove the base rule")
+	}
+	if got, _ := r.GetAlterHostname("api.example.com"); got != "user" {
+		t.Errorf("user rule = %q", got)
+	}
+	if got, _ := r.GetHost("www.example.com"); got != "192.0.2.1" {
+		t.Errorf("base hosts rule = %q", got)
+	}
+	if got := base.AlterHostname["*.example.com"]; got != "base" {
+		t.Errorf("base rules were modified: %q", got)
+	}
+}
+
+func TestNewWatcherInvalid(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewWatcher(filepath.Join(dir, "missing.toml"), WatcherOptions{}); err == nil {
+		t.Error("NewWatcher() of a missing file succeeded")
+	}
+	path := filepath.Join(dir, "bad.toml")
+	writeRulesFile(t, path, "[hosts]\n\"bad:port\" = \"192.0.2.1\"\n")
+	if _, err := NewWatcher(path, WatcherOptions{}); err == nil || !strings.Contains(err.Error(), "bad:port") {
+		t.Errorf("NewWatcher() of an invalid file = %v", err)
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.toml")
+	writeRulesFile(t, path, "[hosts]\n\"example.com\" = \"192.0.2.1\"\n")
+	w, err := NewWatcher(path, WatcherOptions{Interval: 5 * time.Millisecond, Debounce: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	events := make(chan WatchEvent, 4)
+	w.Subscribe(func(ev WatchEvent) { events <- ev })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		w.Run(ctx)
+	}()
+	// Lookups keep working while the rules are swapped underneath them.
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			if _, ok := w.Rules().GetHost("example.com"); !ok {
+				t.Error("lookup during reload found no rule")
+				return
+			}
+		}
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	writeRulesFile(t, path, "[hosts]\n\"example.com\" = \"192.0.2.22\"\n")
+	select {
+	case ev := <-events:
+		if ev.Err != nil || ev.Diff.Summary() != "0 added, 0 removed, 1 changed" {
+			t.Errorf("event = %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event after the file changed")
+	}
+	cancel()
+	wg.Wait()
+
+	if got, _ := w.Rules().GetHost("example.com"); got != "192.0.2.22" {
+		t.Errorf("rules after Run = %q", got)
+	}
+}
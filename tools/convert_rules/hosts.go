@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/xihale/snirect-shared/rules"
+)
+
+// hostsImport converts an /etc/hosts style file into a TOML rules file with a
+// [hosts] section.
+func hostsImport(args []string) {
+	if len(args) < 2 {
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+
+	in, err := os.Open(args[0])
+	if err != nil {
+		fmt.Printf("Error reading input: %v\n", err)
+		os.Exit(1)
+	}
+	defer in.Close()
+
+	r := rules.NewRules()
+	if err := r.FromHostsFile(in); err != nil {
+		fmt.Printf("Error parsing input: %v\n", err)
+		os.Exit(1)
+	}
+
+	data, err := r.ToTOML()
+	if err != nil {
+		fmt.Printf("Error encoding rules: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(args[1], data, 0o644); err != nil {
+		fmt.Printf("Error writing output: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Successfully converted %d hosts to %s\n", len(r.Hosts), args[1])
+}
+
+// hostsExport writes the [hosts] section of a TOML rules file in /etc/hosts
+// format, listing the patterns the format cannot express.
+func hostsExport(args []string) {
+	if len(args) < 2 {
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Printf("Error reading input: %v\n", err)
+		os.Exit(1)
+	}
+	r := rules.NewRules()
+	if err := r.FromTOML(data); err != nil {
+		fmt.Printf("Error parsing input: %v\n", err)
+		os.Exit(1)
+	}
+
+	out, err := os.Create(args[1])
+	if err != nil {
+		fmt.Printf("Error creating output: %v\n", err)
+		os.Exit(1)
+	}
+	defer out.Close()
+
+	written, skipped, err := r.ToHostsFile(out)
+	if err != nil {
+		fmt.Printf("Error writing output: %v\n", err)
+		os.Exit(1)
+	}
+	for _, k := range skipped {
+		fmt.Printf("Skipped %q: not expressible in hosts format\n", k)
+	}
+
+	fmt.Printf("Successfully exported %d hosts to %s\n", written, args[1])
+}
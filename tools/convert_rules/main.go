@@ -1,92 +1,122 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
+	"flag"
 	"fmt"
 	"os"
-	"strings"
+
+	"github.com/xihale/snirect-shared/rules"
+	"github.com/xihale/snirect-shared/rules/cealing"
 )
 
+const usage = `Usage:
+  convert [-compact] [-check] <input_json_path> <output_toml_path>
+  convert hosts-import <hosts_file> <output_toml_path>
+  convert hosts-export <rules_toml_path> <output_hosts_file>`
+
 func main() {
-	if len(os.Args) < 3 {
-		fmt.Println("Usage: convert <input_json_path> <output_toml_path>")
-		os.Exit(1)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "hosts-import":
+			hostsImport(os.Args[2:])
+			return
+		case "hosts-export":
+			hostsExport(os.Args[2:])
+			return
+		}
 	}
 
-	inputPath := os.Args[1]
-	outputPath := os.Args[2]
-
-	data, err := os.ReadFile(inputPath)
-	if err != nil {
-		fmt.Printf("Error reading input: %v\n", err)
+	compact := flag.Bool("compact", false, "drop entries that a more general entry with the same value already covers")
+	check := flag.Bool("check", false, "exit with status 1 if the output file differs from the regenerated rules instead of writing it")
+	flag.Parse()
+	if flag.NArg() < 2 {
+		fmt.Println(usage)
 		os.Exit(1)
 	}
 
-	var rawRules [][]interface{}
-	if err := json.Unmarshal(data, &rawRules); err != nil {
-		// Try TOML parsing if JSON fails? No, the input is clearly JSON-like array.
-		fmt.Printf("Error parsing input: %v\n", err)
+	if err := convert(flag.Arg(0), flag.Arg(1), *compact, *check); err != nil {
+		fmt.Printf("Error %v\n", err)
 		os.Exit(1)
 	}
+}
 
-	out, err := os.Create(outputPath)
+// convert regenerates outputPath from the Cealing-Host list at inputPath, or
+// with check only compares the regenerated rules with it.
+func convert(inputPath, outputPath string, compact, check bool) error {
+	in, err := os.Open(inputPath)
 	if err != nil {
-		fmt.Printf("Error creating output: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("reading input: %w", err)
+	}
+	res, err := cealing.Parse(in)
+	in.Close()
+	if err != nil {
+		return fmt.Errorf("parsing input: %w", err)
+	}
+	for _, n := range res.Commented {
+		fmt.Printf("Disabled %s\n", n)
+	}
+	for _, n := range res.Skipped {
+		fmt.Printf("Skipped %s\n", n)
+	}
+	if compact {
+		compactRules(res.Rules)
 	}
-	defer out.Close()
-
-	fmt.Fprintln(out, "# Generated from Cealing-Host")
-	fmt.Fprintln(out, "[alter_hostname]")
-	for _, rule := range rawRules {
-		if len(rule) < 2 {
-			continue
-		}
-		domains, ok := rule[0].([]interface{})
-		if !ok {
-			continue
-		}
-		sni, _ := rule[1].(string)
 
-		for _, d := range domains {
-			domain, ok := d.(string)
-			if !ok {
-				continue
-			}
-			if strings.HasPrefix(domain, "#") {
-				continue
-			}
-			fmt.Fprintf(out, "%q = %q\n", domain, sni)
-		}
+	var buf bytes.Buffer
+	if err := cealing.WriteTOML(&buf, res.Rules); err != nil {
+		return fmt.Errorf("encoding rules: %w", err)
 	}
 
-	fmt.Fprintln(out, "\n[hosts]")
-	for _, rule := range rawRules {
-		if len(rule) < 3 {
-			continue
+	if check {
+		current, err := os.ReadFile(outputPath)
+		if err != nil {
+			return fmt.Errorf("reading output: %w", err)
 		}
-		domains, ok := rule[0].([]interface{})
-		if !ok {
-			continue
-		}
-		ip, ok := rule[2].(string)
-		if !ok || ip == "" {
-			continue
+		if line, ok := firstDifference(current, buf.Bytes()); !ok {
+			return fmt.Errorf("%s is out of date (first difference at line %d); regenerate it from %s", outputPath, line, inputPath)
 		}
+		fmt.Printf("%s is up to date\n", outputPath)
+		return nil
+	}
 
-		for _, d := range domains {
-			domain, ok := d.(string)
-			if !ok {
-				continue
-			}
-			if strings.HasPrefix(domain, "#") {
-				continue
+	if err := os.WriteFile(outputPath, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	fmt.Printf("Successfully converted %d rules to %s\n", res.Entries, outputPath)
+	return nil
+}
+
+// compactRules removes the keys that rules.Compact would remove. Compact runs
+// on a copy because initializing the rules would also rewrite legacy "$" keys,
+// which the output keeps as written upstream; findings carry the key without
+// the prefix, so both spellings are removed, as Document.Remove does.
+func compactRules(r *rules.Rules) {
+	c := r.DeepCopy()
+	for _, f := range c.Compact() {
+		for _, k := range []string{f.Key, "$" + f.Key} {
+			switch f.Section {
+			case rules.SectionAlterHostname:
+				delete(r.AlterHostname, k)
+			case rules.SectionHosts:
+				delete(r.Hosts, k)
 			}
-			fmt.Fprintf(out, "%q = %q\n", domain, ip)
 		}
+		fmt.Printf("Dropping %s\n", f)
 	}
+}
 
-	fmt.Fprintln(out, "\n[cert_verify]")
-
-	fmt.Printf("Successfully converted %d rules to %s\n", len(rawRules), outputPath)
+// firstDifference compares two files line by line, returning the 1-based
+// number of the first differing line, or ok if they are identical.
+func firstDifference(a, b []byte) (line int, ok bool) {
+	if bytes.Equal(a, b) {
+		return 0, true
+	}
+	al, bl := bytes.Split(a, []byte("\n")), bytes.Split(b, []byte("\n"))
+	for i := range min(len(al), len(bl)) {
+		if !bytes.Equal(al[i], bl[i]) {
+			return i + 1, false
+		}
+	}
+	return min(len(al), len(bl)) + 1, false
 }
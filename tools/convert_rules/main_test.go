@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// upstreamList is where an unmodified snapshot of the upstream Cealing-Host
+// list is checked in, next to the layer generated from it.
+const upstreamList = "../../rules/Cealing-Host.json"
+
+// TestFetchedUpToDate is the -check run: rules/fetched.toml must be what the
+// converter generates from the upstream snapshot.
+func TestFetchedUpToDate(t *testing.T) {
+	if _, err := os.Stat(upstreamList); os.IsNotExist(err) {
+		t.Skip("no upstream Cealing-Host.json snapshot checked in")
+	}
+	if err := convert(upstreamList, "../../rules/fetched.toml", false, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConvertCheck(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "list.json")
+	out := filepath.Join(dir, "out.toml")
+	if err := os.WriteFile(list, []byte(`[[["*pixiv.net", "#off.example"], "pixivision.net", "210.140.139.155"]]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := convert(list, out, false, true); err == nil {
+		t.Error("check of a missing output succeeded")
+	}
+	if err := convert(list, out, false, false); err != nil {
+		t.Fatalf("convert() error = %v", err)
+	}
+	if err := convert(list, out, false, true); err != nil {
+		t.Errorf("check of a fresh output = %v", err)
+	}
+	if err := os.WriteFile(out, []byte("# Generated from Cealing-Host\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := convert(list, out, false, true); err == nil {
+		t.Error("check of a stale output succeeded")
+	}
+}
+
+func TestConvertCompact(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "list.json")
+	out := filepath.Join(dir, "out.toml")
+	input := `[
+  [["*.example.com", "$www.example.com", "$other.example.org"], "front.example.net", "192.0.2.1"]
+]`
+	if err := os.WriteFile(list, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := convert(list, out, true, false); err != nil {
+		t.Fatalf("convert(-compact) error = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "www.example.com") {
+		t.Errorf("redundant \"$\" key kept:\n%s", data)
+	}
+	if !strings.Contains(string(data), `"$other.example.org" = "front.example.net"`) {
+		t.Errorf("needed \"$\" key dropped:\n%s", data)
+	}
+}